@@ -11,6 +11,7 @@ import (
 	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/controller"
 	handler "github.com/dgt4l/avito_shop/internal/avito_shop/handler"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/repository/memory"
 	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
 	"github.com/sirupsen/logrus"
 )
@@ -23,15 +24,41 @@ func main() {
 		logrus.Fatalf("Failed to load Config: %v", err)
 	}
 
-	db, err := repository.NewRepository(cfg.DBConfig)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg.DBConfig, os.Args[2:]); err != nil {
+			logrus.Fatalf("Failed to migrate: %v", err)
+		}
+		return
+	}
+
+	if err := cfg.ServiceConfig.Validate(); err != nil {
+		logrus.Fatalf("Invalid service config: %v", err)
+	}
+
+	if err := cfg.HandlerConfig.Validate(); err != nil {
+		logrus.Fatalf("Invalid handler config: %v", err)
+	}
+
+	if err := cfg.ServiceConfig.Policy.LoadPasswordDenylist(); err != nil {
+		logrus.Fatalf("Failed to load password denylist: %v", err)
+	}
+
+	db, err := newStorage(cfg.DBConfig)
 	if err != nil {
 		logrus.Fatalf("Failed to init db: %v", err)
 	}
 
-	auth := auth.NewAuth(cfg.AuthConfig)
+	auth, err := auth.NewAuth(cfg.AuthConfig, db, db)
+	if err != nil {
+		logrus.Fatalf("Failed to init auth: %v", err)
+	}
+
 	srv := controller.NewShopService(db, auth, cfg.ServiceConfig)
+	if err := srv.BootstrapAdmin(context.Background()); err != nil {
+		logrus.Fatalf("Failed to bootstrap admin: %v", err)
+	}
 
-	sh := handler.NewShopHandler(srv, auth, cfg.AppPort)
+	sh := handler.NewShopHandler(srv, auth, cfg.AppPort, cfg.HandlerConfig)
 
 	go sh.Start()
 
@@ -55,3 +82,31 @@ func main() {
 	}
 	logrus.Println("Server exiting")
 }
+
+// storage is what the service keeps in its database: the shop data, sessions
+// and login attempts.
+type storage interface {
+	controller.Repository
+	auth.SessionStore
+	auth.LoginAttemptStore
+	Close() error
+}
+
+// newStorage picks the repository named by db_driver. The in-memory one gets
+// the default catalog that migrations seed into Postgres.
+func newStorage(cfg repository.DBConfig) (storage, error) {
+	if cfg.DBDriver == memory.Driver {
+		repo := memory.NewRepository(cfg)
+		repo.SeedCatalog()
+
+		logrus.Warn("Using the in-memory repository, data is lost on restart")
+		return repo, nil
+	}
+
+	repo, err := repository.NewRepository(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
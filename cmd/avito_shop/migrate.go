@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/repository/memory"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+)
+
+const migrateUsage = "usage: avito_shop migrate [up | down [steps] | version]"
+
+// runMigrate implements the migrate command: up applies pending migrations,
+// down reverts the latest ones, one by default, and version prints the
+// schema version of the database and of the binary.
+func runMigrate(cfg repository.DBConfig, args []string) error {
+	if cfg.DBDriver == memory.Driver {
+		return errors.New("the in-memory repository has no schema to migrate")
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	steps := 1
+	if command == "down" && len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return errors.New(migrateUsage)
+		}
+		steps = n
+	}
+
+	migrator, err := repository.NewMigrator(cfg)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		return migrator.Down(ctx, steps)
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("database: %d, binary: %d\n", version, migrator.Latest())
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/controller"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/handler"
 	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
 	"github.com/spf13/viper"
 )
@@ -15,6 +16,7 @@ type Config struct {
 	AuthConfig    auth.AuthConfig          `mapstructure:"auth_config"`
 	DBConfig      repository.DBConfig      `mapstructure:"db_config"`
 	ServiceConfig controller.ServiceConfig `mapstructure:"service_config"`
+	HandlerConfig handler.HandlerConfig    `mapstructure:"handler_config"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
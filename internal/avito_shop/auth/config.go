@@ -2,8 +2,38 @@ package auth
 
 import "time"
 
-const TokenTTL = 12 * time.Hour
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
 
+	DefaultIssuer   = "avito_shop"
+	DefaultAudience = "avito_shop"
+)
+
+// AuthConfig selects how tokens are signed. With no SigningKeys the single
+// HS256 SigningKey is used as before; otherwise tokens are signed with the
+// ActiveKeyId key and SigningKey only verifies old tokens that carry no kid.
 type AuthConfig struct {
-	SigningKey string `mapstructure:"jwt_signing_key"`
+	SigningKey      string             `mapstructure:"jwt_signing_key"`
+	SigningKeys     []SigningKeyConfig `mapstructure:"signing_keys"`
+	ActiveKeyId     string             `mapstructure:"active_key_id"`
+	KeyGracePeriod  time.Duration      `mapstructure:"key_grace_period"`
+	AccessTokenTTL  time.Duration      `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL time.Duration      `mapstructure:"refresh_token_ttl"`
+	Issuer          string             `mapstructure:"issuer"`
+	Audience        string             `mapstructure:"audience"`
+	// AcceptLegacyTokens keeps accepting tokens in the pre-registered-claims
+	// format until they expire. Turn it off once the old tokens are gone.
+	AcceptLegacyTokens bool                `mapstructure:"accept_legacy_tokens"`
+	LoginThrottle      LoginThrottleConfig `mapstructure:"login_throttle"`
+}
+
+// SigningKeyConfig describes one key of the key set. A retired key no longer
+// signs tokens but still verifies them for KeyGracePeriod after RetiredAt.
+type SigningKeyConfig struct {
+	Id             string `mapstructure:"kid"`
+	Algorithm      string `mapstructure:"alg"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	Secret         string `mapstructure:"secret"`
+	RetiredAt      string `mapstructure:"retired_at"`
 }
@@ -9,3 +9,33 @@ var ErrClaimIdFails = errors.New("claim parsing id fails")
 var ErrClaimMissing = errors.New("claim missing")
 
 var ErrTokenExpired = errors.New("token expired")
+
+var ErrClaimSessionFails = errors.New("claim parsing session id fails")
+
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+var ErrSessionRevoked = errors.New("session revoked or expired")
+
+var ErrSessionNotFound = errors.New("session not found")
+
+var ErrInvalidSigningKey = errors.New("invalid signing key config")
+
+var ErrActiveKeyNotFound = errors.New("active signing key not found")
+
+var ErrUnknownKeyId = errors.New("unknown signing key id")
+
+var ErrKeyRetired = errors.New("signing key retired")
+
+var ErrInvalidIssuer = errors.New("invalid token issuer")
+
+var ErrInvalidAudience = errors.New("invalid token audience")
+
+var ErrLegacyToken = errors.New("legacy token format is not accepted")
+
+var ErrMalformedToken = errors.New("malformed token")
+
+var ErrInvalidSignature = errors.New("invalid token signature")
+
+var ErrTokenNotValidYet = errors.New("token not valid yet")
+
+var ErrTooManyLoginAttempts = errors.New("too many login attempts")
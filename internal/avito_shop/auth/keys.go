@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+type signingKey struct {
+	id        string
+	method    jwt.SigningMethod
+	private   interface{}
+	public    interface{}
+	retiredAt *time.Time
+}
+
+// keySet holds every key that may verify a token. legacy verifies tokens
+// issued before key ids were introduced.
+type keySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	legacy *signingKey
+	grace  time.Duration
+}
+
+func loadKeySet(cfg AuthConfig) (*keySet, error) {
+	set := &keySet{
+		keys:  make(map[string]*signingKey, len(cfg.SigningKeys)),
+		grace: cfg.KeyGracePeriod,
+	}
+
+	if cfg.SigningKey != "" {
+		set.legacy = &signingKey{
+			method:  jwt.SigningMethodHS256,
+			private: []byte(cfg.SigningKey),
+			public:  []byte(cfg.SigningKey),
+		}
+	}
+
+	if len(cfg.SigningKeys) == 0 {
+		if set.legacy == nil {
+			return nil, fmt.Errorf("%w: no signing keys", ErrInvalidSigningKey)
+		}
+
+		set.active = set.legacy
+		return set, nil
+	}
+
+	for _, keyCfg := range cfg.SigningKeys {
+		key, err := loadSigningKey(keyCfg)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := set.keys[key.id]; ok {
+			return nil, fmt.Errorf("%w: duplicate kid %q", ErrInvalidSigningKey, key.id)
+		}
+
+		set.keys[key.id] = key
+	}
+
+	active, ok := set.keys[cfg.ActiveKeyId]
+	if !ok || active.retiredAt != nil {
+		return nil, ErrActiveKeyNotFound
+	}
+
+	set.active = active
+	return set, nil
+}
+
+func loadSigningKey(cfg SigningKeyConfig) (*signingKey, error) {
+	if cfg.Id == "" {
+		return nil, fmt.Errorf("%w: kid is required", ErrInvalidSigningKey)
+	}
+
+	key := &signingKey{id: cfg.Id}
+
+	if cfg.RetiredAt != "" {
+		retiredAt, err := time.Parse(time.RFC3339, cfg.RetiredAt)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidSigningKey, cfg.Id, err)
+		}
+
+		key.retiredAt = &retiredAt
+	}
+
+	switch cfg.Algorithm {
+	case AlgHS256:
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("%w: key %q: secret is required", ErrInvalidSigningKey, cfg.Id)
+		}
+
+		key.method = jwt.SigningMethodHS256
+		key.private, key.public = []byte(cfg.Secret), []byte(cfg.Secret)
+	case AlgRS256:
+		pem, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidSigningKey, cfg.Id, err)
+		}
+
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidSigningKey, cfg.Id, err)
+		}
+
+		key.method = jwt.SigningMethodRS256
+		key.private, key.public = private, &private.PublicKey
+	case AlgEdDSA:
+		pem, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidSigningKey, cfg.Id, err)
+		}
+
+		parsed, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", ErrInvalidSigningKey, cfg.Id, err)
+		}
+
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%w: key %q: not an ed25519 key", ErrInvalidSigningKey, cfg.Id)
+		}
+
+		key.method = jwt.SigningMethodEdDSA
+		key.private, key.public = private, private.Public()
+	default:
+		return nil, fmt.Errorf("%w: key %q: unsupported alg %q", ErrInvalidSigningKey, cfg.Id, cfg.Algorithm)
+	}
+
+	return key, nil
+}
+
+// lookup returns the key a token with the given kid must be verified with.
+func (k *keySet) lookup(kid string, now time.Time) (*signingKey, error) {
+	if kid == "" {
+		if k.legacy == nil {
+			return nil, ErrUnknownKeyId
+		}
+
+		return k.legacy, nil
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKeyId
+	}
+
+	if !key.usable(now, k.grace) {
+		return nil, ErrKeyRetired
+	}
+
+	return key, nil
+}
+
+func (k *signingKey) usable(now time.Time, grace time.Duration) bool {
+	return k.retiredAt == nil || now.Before(k.retiredAt.Add(grace))
+}
+
+// jwks publishes the asymmetric keys that can still verify tokens. Shared
+// HS256 secrets are never exposed.
+func (k *keySet) jwks(now time.Time) *dto.JWKS {
+	set := &dto.JWKS{Keys: make([]dto.JWK, 0, len(k.keys))}
+
+	for _, key := range k.keys {
+		if !key.usable(now, k.grace) {
+			continue
+		}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, dto.JWK{
+				Kty: "RSA",
+				Kid: key.id,
+				Use: "sig",
+				Alg: AlgRS256,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, dto.JWK{
+				Kty: "OKP",
+				Kid: key.id,
+				Use: "sig",
+				Alg: AlgEdDSA,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
@@ -1,62 +1,386 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
 	"github.com/golang-jwt/jwt"
 )
 
 type AuthService interface {
-	GenerateToken(user *models.User) (string, error)
-	ParseToken(tokenString string) (int, error)
+	CreateSession(ctx context.Context, user *models.User) (*Tokens, error)
+	ParseRefreshToken(ctx context.Context, refreshToken string) (*Session, error)
+	RotateSession(ctx context.Context, session *Session, user *models.User) (*Tokens, error)
+	RevokeSession(ctx context.Context, sessionId string) error
+	RevokeUserSessions(ctx context.Context, userId int, exceptSessionId string) error
+	CheckSession(ctx context.Context, sessionId string) error
+	CheckLogin(ctx context.Context, username, ip string) error
+	LoginSucceeded(ctx context.Context, username, ip string) error
+	LoginFailed(ctx context.Context, username, ip string) error
+	ParseToken(tokenString string) (*UserClaims, error)
+	JWKS() *dto.JWKS
+}
+
+// UserClaims is the principal of an access token. SessionId is empty only for
+// legacy tokens issued before sessions existed.
+type UserClaims struct {
+	Id        int
+	Role      string
+	SessionId string
+	TokenId   string
+}
+
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
 }
 
 type ServiceAuth struct {
-	cfg AuthConfig
+	cfg      AuthConfig
+	keys     *keySet
+	sessions SessionStore
+	attempts LoginAttemptStore
 }
 
-func NewAuth(cfg AuthConfig) *ServiceAuth {
-	return &ServiceAuth{
-		cfg: cfg,
+func NewAuth(cfg AuthConfig, sessions SessionStore, attempts LoginAttemptStore) (*ServiceAuth, error) {
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+
+	if cfg.RefreshTokenTTL <= 0 {
+		cfg.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+
+	if cfg.Issuer == "" {
+		cfg.Issuer = DefaultIssuer
+	}
+
+	if cfg.Audience == "" {
+		cfg.Audience = DefaultAudience
+	}
+
+	cfg.LoginThrottle = cfg.LoginThrottle.withDefaults()
+
+	// A retired key has to outlive every access token it signed.
+	if cfg.KeyGracePeriod <= 0 {
+		cfg.KeyGracePeriod = cfg.AccessTokenTTL
+	}
+
+	keys, err := loadKeySet(cfg)
+	if err != nil {
+		return nil, err
 	}
+
+	return &ServiceAuth{
+		cfg:      cfg,
+		keys:     keys,
+		sessions: sessions,
+		attempts: attempts,
+	}, nil
 }
 
-func (s *ServiceAuth) GenerateToken(user *models.User) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.MapClaims{
-		"id":         user.Id,
-		"username":   user.Username,
-		"password":   user.Password,
-		"expires_at": time.Now().Add(TokenTTL).Unix(),
+// CreateSession starts a new login session and returns its first token pair.
+func (s *ServiceAuth) CreateSession(ctx context.Context, user *models.User) (*Tokens, error) {
+	sessionId, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.sessions.CreateSession(ctx, &Session{
+		Id:          sessionId,
+		UserId:      user.Id,
+		Username:    user.Username,
+		RefreshHash: hashSecret(secret),
+		ExpiresAt:   time.Now().Add(s.cfg.RefreshTokenTTL),
 	})
+	if err != nil {
+		return nil, err
+	}
 
-	return token.SignedString([]byte(s.cfg.SigningKey))
+	return s.newTokens(user, sessionId, secret)
 }
 
-func (s *ServiceAuth) ParseToken(tokenString string) (int, error) {
+// ParseRefreshToken returns the live session the refresh token belongs to.
+// Presenting a refresh token that has already been rotated means it leaked,
+// so the whole session is revoked.
+func (s *ServiceAuth) ParseRefreshToken(ctx context.Context, refreshToken string) (*Session, error) {
+	sessionId, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionId == "" || secret == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessions.GetSession(ctx, sessionId)
+	if err != nil && errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(session.RefreshHash)) != 1 {
+		if err := s.sessions.RevokeSession(ctx, session.Id); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return session, nil
+}
+
+// RotateSession replaces the refresh secret of session and issues a new token
+// pair for user. It fails if another refresh rotated the session first.
+func (s *ServiceAuth) RotateSession(ctx context.Context, session *Session, user *models.User) (*Tokens, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := s.sessions.RotateSession(
+		ctx, session.Id, session.RefreshHash, hashSecret(secret), time.Now().Add(s.cfg.RefreshTokenTTL),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if !rotated {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.newTokens(user, session.Id, secret)
+}
+
+func (s *ServiceAuth) RevokeSession(ctx context.Context, sessionId string) error {
+	return s.sessions.RevokeSession(ctx, sessionId)
+}
+
+// RevokeUserSessions logs a user out everywhere except exceptSessionId; pass
+// an empty id to revoke every session.
+func (s *ServiceAuth) RevokeUserSessions(ctx context.Context, userId int, exceptSessionId string) error {
+	return s.sessions.RevokeUserSessions(ctx, userId, exceptSessionId)
+}
+
+// CheckSession reports ErrSessionRevoked for access tokens whose session was
+// logged out or has expired.
+func (s *ServiceAuth) CheckSession(ctx context.Context, sessionId string) error {
+	session, err := s.sessions.GetSession(ctx, sessionId)
+	if err != nil && errors.Is(err, ErrSessionNotFound) {
+		return ErrSessionRevoked
+	} else if err != nil {
+		return err
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return ErrSessionRevoked
+	}
+
+	return nil
+}
+
+func (s *ServiceAuth) ParseToken(tokenString string) (*UserClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := s.keys.lookup(kid, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method.Alg() != key.method.Alg() {
 			return nil, ErrInvalidSignMethod
 		}
 
-		return []byte(s.cfg.SigningKey), nil
+		return key.public, nil
 	})
+
+	// jwt v3 does not implement Unwrap, so translate its bit flags into our
+	// own errors. Signature problems win over claim problems: an expired token
+	// with a forged signature is a forged token.
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) {
+		switch {
+		case validationErr.Errors&jwt.ValidationErrorMalformed != 0:
+			return nil, ErrMalformedToken
+		case validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+			return nil, ErrInvalidSignature
+		case validationErr.Errors&jwt.ValidationErrorUnverifiable != 0 && validationErr.Inner != nil:
+			return nil, validationErr.Inner
+		case validationErr.Errors&jwt.ValidationErrorExpired != 0:
+			return nil, ErrTokenExpired
+		case validationErr.Errors&(jwt.ValidationErrorNotValidYet|jwt.ValidationErrorIssuedAt) != 0:
+			return nil, ErrTokenNotValidYet
+		case validationErr.Inner != nil:
+			return nil, validationErr.Inner
+		}
+	}
+
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		id, ok := claims["id"].(float64)
-		if !ok {
-			return 0, ErrClaimIdFails
-		}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrClaimMissing
+	}
 
-		expiresAt, ok := claims["expires_at"].(float64)
-		if !ok || time.Now().After(time.Unix(int64(expiresAt), 0)) {
-			return 0, ErrTokenExpired
-		}
+	if isLegacyClaims(claims) {
+		return s.parseLegacyClaims(claims)
+	}
+
+	subject, _ := claims["sub"].(string)
+	id, err := strconv.Atoi(subject)
+	if err != nil {
+		return nil, ErrClaimIdFails
+	}
+
+	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, ErrTokenExpired
+	}
+
+	if !claims.VerifyIssuer(s.cfg.Issuer, true) {
+		return nil, ErrInvalidIssuer
+	}
+
+	if !claims.VerifyAudience(s.cfg.Audience, true) {
+		return nil, ErrInvalidAudience
+	}
+
+	tokenId, ok := claims["jti"].(string)
+	if !ok || tokenId == "" {
+		return nil, ErrClaimMissing
+	}
+
+	userClaims, err := sessionClaims(claims, id)
+	if err != nil {
+		return nil, err
+	}
+
+	userClaims.TokenId = tokenId
+	return userClaims, nil
+}
+
+// isLegacyClaims recognises tokens issued before the switch to registered
+// claims: they carry a custom expires_at instead of exp.
+func isLegacyClaims(claims jwt.MapClaims) bool {
+	_, hasExp := claims["exp"]
+	_, hasExpiresAt := claims["expires_at"]
+
+	return hasExpiresAt && !hasExp
+}
+
+// parseLegacyClaims accepts old-format tokens only in compatibility mode, and
+// only until their own expires_at, so a rolling deploy does not log users out.
+// Tokens issued before sessions existed carry no sid; they get claims without
+// a session, which skip the session check.
+func (s *ServiceAuth) parseLegacyClaims(claims jwt.MapClaims) (*UserClaims, error) {
+	if !s.cfg.AcceptLegacyTokens {
+		return nil, ErrLegacyToken
+	}
+
+	id, ok := claims["id"].(float64)
+	if !ok {
+		return nil, ErrClaimIdFails
+	}
+
+	expiresAt, ok := claims["expires_at"].(float64)
+	if !ok || time.Now().After(time.Unix(int64(expiresAt), 0)) {
+		return nil, ErrTokenExpired
+	}
+
+	if _, ok := claims["sid"]; !ok {
+		return &UserClaims{Id: int(id), Role: models.RoleUser}, nil
+	}
+
+	return sessionClaims(claims, int(id))
+}
+
+func sessionClaims(claims jwt.MapClaims, id int) (*UserClaims, error) {
+	sessionId, ok := claims["sid"].(string)
+	if !ok || sessionId == "" {
+		return nil, ErrClaimSessionFails
+	}
+
+	role, ok := claims["role"].(string)
+	if !ok || role == "" {
+		role = models.RoleUser
+	}
+
+	return &UserClaims{Id: id, Role: role, SessionId: sessionId}, nil
+}
+
+func (s *ServiceAuth) JWKS() *dto.JWKS {
+	return s.keys.jwks(time.Now())
+}
 
-		return int(id), nil
+func (s *ServiceAuth) newTokens(user *models.User, sessionId, secret string) (*Tokens, error) {
+	accessToken, err := s.generateToken(user, sessionId)
+	if err != nil {
+		return nil, err
 	}
-	return 0, ErrClaimMissing
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: sessionId + "." + secret,
+		ExpiresIn:    s.cfg.AccessTokenTTL,
+	}, nil
+}
+
+func (s *ServiceAuth) generateToken(user *models.User, sessionId string) (string, error) {
+	key := s.keys.active
+
+	tokenId, err := randomString(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(key.method, &jwt.MapClaims{
+		"sub":  strconv.Itoa(user.Id),
+		"iss":  s.cfg.Issuer,
+		"aud":  s.cfg.Audience,
+		"iat":  now.Unix(),
+		"exp":  now.Add(s.cfg.AccessTokenTTL).Unix(),
+		"jti":  tokenId,
+		"sid":  sessionId,
+		"role": user.Role,
+	})
+
+	if key.id != "" {
+		token.Header["kid"] = key.id
+	}
+
+	return token.SignedString(key.private)
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
 }
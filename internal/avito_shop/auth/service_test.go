@@ -1,139 +1,623 @@
 package auth
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
 	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestServiceAuth_GenerateToken(t *testing.T) {
+func TestServiceAuth_CreateSession(t *testing.T) {
 	cfg := AuthConfig{
 		SigningKey: "test-key",
 	}
-	service := NewAuth(cfg)
+	service := newTestAuth(t, cfg)
 
 	user := &models.User{
 		Id:       1,
 		Username: "testuser",
 		Password: "testpassword",
+		Role:     models.RoleAdmin,
 	}
 
-	token, err := service.GenerateToken(user)
+	tokens, err := service.CreateSession(context.Background(), user)
 	assert.NoError(t, err)
-	assert.NotEmpty(t, token)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, DefaultAccessTokenTTL, tokens.ExpiresIn)
 
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
+	parsedToken, err := jwt.Parse(tokens.AccessToken, func(token *jwt.Token) (interface{}, error) {
 		return []byte(cfg.SigningKey), nil
 	})
 	assert.NoError(t, err)
 
 	claims, ok := parsedToken.Claims.(jwt.MapClaims)
 	assert.True(t, ok)
-	assert.Equal(t, float64(user.Id), claims["id"])
-	assert.Equal(t, user.Username, claims["username"])
-	assert.Equal(t, user.Password, claims["password"])
-	assert.InDelta(t, time.Now().Add(TokenTTL).Unix(), claims["expires_at"].(float64), 1)
+	assert.Equal(t, "1", claims["sub"])
+	assert.Equal(t, DefaultIssuer, claims["iss"])
+	assert.Equal(t, DefaultAudience, claims["aud"])
+	assert.Equal(t, user.Role, claims["role"])
+	assert.NotEmpty(t, claims["sid"])
+	assert.NotEmpty(t, claims["jti"])
+	assert.InDelta(t, time.Now().Unix(), claims["iat"].(float64), 1)
+	assert.InDelta(t, time.Now().Add(DefaultAccessTokenTTL).Unix(), claims["exp"].(float64), 1)
+	assert.NotContains(t, claims, "password")
+	assert.NotContains(t, claims, "username")
 }
 
 func TestServiceAuth_ParseToken_ValidToken(t *testing.T) {
 	cfg := AuthConfig{
 		SigningKey: "test-key",
 	}
-	service := NewAuth(cfg)
+	service := newTestAuth(t, cfg)
 
 	user := &models.User{
 		Id:       1,
 		Username: "testuser",
 		Password: "testpassword",
+		Role:     models.RoleAdmin,
 	}
 
-	token, err := service.GenerateToken(user)
+	tokens, err := service.CreateSession(context.Background(), user)
 	assert.NoError(t, err)
 
-	userId, err := service.ParseToken(token)
+	claims, err := service.ParseToken(tokens.AccessToken)
 	assert.NoError(t, err)
-	assert.Equal(t, user.Id, userId)
+	assert.Equal(t, user.Id, claims.Id)
+	assert.Equal(t, user.Role, claims.Role)
+	assert.NoError(t, service.CheckSession(context.Background(), claims.SessionId))
+}
+
+func TestServiceAuthParseTokenWithoutRole(t *testing.T) {
+	service := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+
+	claims, err := service.ParseToken(signClaims(t, "test-key", validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleUser, claims.Role)
+	assert.Equal(t, 1, claims.Id)
+	assert.Equal(t, "token", claims.TokenId)
 }
 
 func TestServiceAuthParseTokenInvalidKey(t *testing.T) {
-	cfg := AuthConfig{
-		SigningKey: "test-key",
-	}
-	service := NewAuth(cfg)
+	service := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":         1,
-		"expires_at": time.Now().Add(TokenTTL).Unix(),
-	})
+	_, err := service.ParseToken(signClaims(t, "wrong-key", validClaims()))
+	assert.Equal(t, ErrInvalidSignature, err)
 
-	tokenString, err := token.SignedString([]byte("wrong-key"))
-	assert.NoError(t, err)
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	_, err = service.ParseToken(signClaims(t, "wrong-key", expired))
+	assert.Equal(t, ErrInvalidSignature, err)
+}
+
+func TestServiceAuthParseTokenInvalidSignMethod(t *testing.T) {
+	service := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS512, validClaims()).SignedString([]byte("test-key"))
+	require.NoError(t, err)
 
 	_, err = service.ParseToken(tokenString)
-	assert.Error(t, err)
+	assert.Equal(t, ErrInvalidSignMethod, err)
 }
 
 func TestServiceAuthParseTokenInvalidToken(t *testing.T) {
 	cfg := AuthConfig{
 		SigningKey: "test-key",
 	}
-	service := NewAuth(cfg)
+	service := newTestAuth(t, cfg)
 
 	_, err := service.ParseToken("invalid-token")
-	assert.Error(t, err)
+	assert.Equal(t, ErrMalformedToken, err)
 }
 
-func TestServiceAuthParseTokenExpiredToken(t *testing.T) {
-	cfg := AuthConfig{
-		SigningKey: "test-key",
+func TestServiceAuthParseTokenClaims(t *testing.T) {
+	service := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+
+	tests := []struct {
+		name    string
+		modify  func(claims jwt.MapClaims)
+		wantErr error
+	}{
+		{
+			name:    "Expired",
+			modify:  func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:    "NotValidYet",
+			modify:  func(claims jwt.MapClaims) { claims["nbf"] = time.Now().Add(time.Hour).Unix() },
+			wantErr: ErrTokenNotValidYet,
+		},
+		{
+			name:    "MissingExpiry",
+			modify:  func(claims jwt.MapClaims) { delete(claims, "exp") },
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:    "MissingSubject",
+			modify:  func(claims jwt.MapClaims) { delete(claims, "sub") },
+			wantErr: ErrClaimIdFails,
+		},
+		{
+			name:    "InvalidSubject",
+			modify:  func(claims jwt.MapClaims) { claims["sub"] = "not-a-number" },
+			wantErr: ErrClaimIdFails,
+		},
+		{
+			name:    "WrongIssuer",
+			modify:  func(claims jwt.MapClaims) { claims["iss"] = "someone-else" },
+			wantErr: ErrInvalidIssuer,
+		},
+		{
+			name:    "WrongAudience",
+			modify:  func(claims jwt.MapClaims) { claims["aud"] = "someone-else" },
+			wantErr: ErrInvalidAudience,
+		},
+		{
+			name:    "MissingTokenId",
+			modify:  func(claims jwt.MapClaims) { delete(claims, "jti") },
+			wantErr: ErrClaimMissing,
+		},
+		{
+			name:    "MissingSession",
+			modify:  func(claims jwt.MapClaims) { delete(claims, "sid") },
+			wantErr: ErrClaimSessionFails,
+		},
 	}
-	service := NewAuth(cfg)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":         1,
-		"expires_at": time.Now().Add(-time.Hour).Unix(),
-	})
-	tokenString, err := token.SignedString([]byte(cfg.SigningKey))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+
+			_, err := service.ParseToken(signClaims(t, "test-key", claims))
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestServiceAuthParseTokenConfiguredIssuer(t *testing.T) {
+	cfg := AuthConfig{SigningKey: "test-key", Issuer: "shop-auth", Audience: "shop-api"}
+	service := newTestAuth(t, cfg)
+
+	tokens, err := service.CreateSession(context.Background(), &models.User{Id: 1, Role: models.RoleUser})
+	require.NoError(t, err)
+
+	_, err = service.ParseToken(tokens.AccessToken)
 	assert.NoError(t, err)
 
-	_, err = service.ParseToken(tokenString)
-	assert.Error(t, err)
+	_, err = service.ParseToken(signClaims(t, "test-key", validClaims()))
+	assert.Equal(t, ErrInvalidIssuer, err)
 }
 
-func TestServiceAuthParseTokenMissingClaim(t *testing.T) {
-	cfg := AuthConfig{
-		SigningKey: "test-key",
+func TestServiceAuthParseTokenLegacy(t *testing.T) {
+	// The claims the original GenerateToken signed.
+	legacyClaims := func(expiresAt time.Time) jwt.MapClaims {
+		return jwt.MapClaims{
+			"id":         1,
+			"username":   "testuser",
+			"password":   "password1",
+			"expires_at": expiresAt.Unix(),
+		}
 	}
-	service := NewAuth(cfg)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": "testuser",
-	})
-	tokenString, err := token.SignedString([]byte(cfg.SigningKey))
+	strict := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+	_, err := strict.ParseToken(signClaims(t, "test-key", legacyClaims(time.Now().Add(time.Hour))))
+	assert.Equal(t, ErrLegacyToken, err)
+
+	compat := newTestAuth(t, AuthConfig{SigningKey: "test-key", AcceptLegacyTokens: true})
+	claims, err := compat.ParseToken(signClaims(t, "test-key", legacyClaims(time.Now().Add(time.Hour))))
 	assert.NoError(t, err)
+	assert.Equal(t, &UserClaims{Id: 1, Role: models.RoleUser}, claims)
 
-	_, err = service.ParseToken(tokenString)
-	assert.Error(t, err)
-	assert.Equal(t, ErrClaimIdFails, err)
+	_, err = compat.ParseToken(signClaims(t, "test-key", legacyClaims(time.Now().Add(-time.Hour))))
+	assert.Equal(t, ErrTokenExpired, err)
+
+	// Legacy tokens issued once sessions existed are still checked against
+	// their session.
+	withSession := legacyClaims(time.Now().Add(time.Hour))
+	withSession["sid"] = "session"
+	claims, err = compat.ParseToken(signClaims(t, "test-key", withSession))
+	assert.NoError(t, err)
+	assert.Equal(t, "session", claims.SessionId)
 }
 
-func TestServiceAuthParseTokenInvalidClaimType(t *testing.T) {
+func TestServiceAuthRefreshRotatesToken(t *testing.T) {
+	ctx := context.Background()
+	service := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+	user := &models.User{Id: 1, Username: "testuser", Role: models.RoleUser}
+
+	tokens, err := service.CreateSession(ctx, user)
+	assert.NoError(t, err)
+
+	session, err := service.ParseRefreshToken(ctx, tokens.RefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, user.Username, session.Username)
+
+	rotated, err := service.RotateSession(ctx, session, user)
+	assert.NoError(t, err)
+	assert.NotEqual(t, tokens.RefreshToken, rotated.RefreshToken)
+
+	_, err = service.ParseRefreshToken(ctx, rotated.RefreshToken)
+	assert.NoError(t, err)
+
+	_, err = service.RotateSession(ctx, session, user)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+}
+
+func TestServiceAuthRefreshTokenReuseRevokesSession(t *testing.T) {
+	ctx := context.Background()
+	service := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+	user := &models.User{Id: 1, Username: "testuser", Role: models.RoleUser}
+
+	tokens, err := service.CreateSession(ctx, user)
+	assert.NoError(t, err)
+
+	session, err := service.ParseRefreshToken(ctx, tokens.RefreshToken)
+	assert.NoError(t, err)
+
+	rotated, err := service.RotateSession(ctx, session, user)
+	assert.NoError(t, err)
+
+	_, err = service.ParseRefreshToken(ctx, tokens.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	_, err = service.ParseRefreshToken(ctx, rotated.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	claims, err := service.ParseToken(rotated.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrSessionRevoked, service.CheckSession(ctx, claims.SessionId))
+}
+
+func TestServiceAuthRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	service := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+	user := &models.User{Id: 1, Username: "testuser", Role: models.RoleUser}
+
+	tokens, err := service.CreateSession(ctx, user)
+	assert.NoError(t, err)
+
+	claims, err := service.ParseToken(tokens.AccessToken)
+	assert.NoError(t, err)
+
+	assert.NoError(t, service.RevokeSession(ctx, claims.SessionId))
+	assert.Equal(t, ErrSessionRevoked, service.CheckSession(ctx, claims.SessionId))
+
+	_, err = service.ParseRefreshToken(ctx, tokens.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+
+	_, err = service.ParseRefreshToken(ctx, "malformed")
+	assert.Equal(t, ErrInvalidRefreshToken, err)
+}
+
+func TestServiceAuthRevokeUserSessions(t *testing.T) {
+	ctx := context.Background()
+	service := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+	user := &models.User{Id: 1, Username: "testuser", Role: models.RoleUser}
+	other := &models.User{Id: 2, Username: "otheruser", Role: models.RoleUser}
+
+	sessionIds := make([]string, 0, 3)
+	for _, u := range []*models.User{user, user, other} {
+		tokens, err := service.CreateSession(ctx, u)
+		require.NoError(t, err)
+
+		claims, err := service.ParseToken(tokens.AccessToken)
+		require.NoError(t, err)
+
+		sessionIds = append(sessionIds, claims.SessionId)
+	}
+
+	require.NoError(t, service.RevokeUserSessions(ctx, user.Id, sessionIds[0]))
+	assert.NoError(t, service.CheckSession(ctx, sessionIds[0]))
+	assert.Equal(t, ErrSessionRevoked, service.CheckSession(ctx, sessionIds[1]))
+	assert.NoError(t, service.CheckSession(ctx, sessionIds[2]))
+
+	require.NoError(t, service.RevokeUserSessions(ctx, user.Id, ""))
+	assert.Equal(t, ErrSessionRevoked, service.CheckSession(ctx, sessionIds[0]))
+}
+
+func TestServiceAuthLoginThrottle(t *testing.T) {
+	ctx := context.Background()
 	cfg := AuthConfig{
 		SigningKey: "test-key",
+		LoginThrottle: LoginThrottleConfig{
+			MaxUsernameFailures: 3,
+			MaxIpFailures:       4,
+			BaseDelay:           time.Minute,
+			MaxDelay:            2 * time.Minute,
+			LockoutDuration:     time.Hour,
+		},
 	}
-	service := NewAuth(cfg)
+	store := newMemoryLoginAttemptStore()
+	service, err := NewAuth(cfg, newMemorySessionStore(), store)
+	require.NoError(t, err)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":       "not-a-number",
-		"username": "testuser",
-	})
-	tokenString, err := token.SignedString([]byte(cfg.SigningKey))
+	// wait moves the last failure of both keys back, as if d had passed.
+	wait := func(d time.Duration) {
+		for _, key := range []string{"user:user1", "ip:192.0.2.1"} {
+			attempts := store.attempts[key]
+			attempts.LastFailureAt = attempts.LastFailureAt.Add(-d)
+			store.attempts[key] = attempts
+		}
+	}
+
+	// A check in flight does not slow down anyone, a failure does.
+	require.NoError(t, service.CheckLogin(ctx, "user1", "192.0.2.1"))
+	assert.NoError(t, service.CheckLogin(ctx, "User1", ""))
+	require.NoError(t, service.LoginFailed(ctx, "user1", "192.0.2.1"))
+	require.NoError(t, service.LoginFailed(ctx, "user1", ""))
+
+	var throttleErr *ThrottleError
+	err = service.CheckLogin(ctx, "User1", "")
+	require.ErrorAs(t, err, &throttleErr)
+	assert.ErrorIs(t, err, ErrTooManyLoginAttempts)
+	assert.InDelta(t, (2 * time.Minute).Seconds(), throttleErr.RetryAfter.Seconds(), 1)
+
+	wait(2 * time.Minute)
+	require.NoError(t, service.CheckLogin(ctx, "user1", "192.0.2.1"))
+	require.NoError(t, service.LoginFailed(ctx, "user1", "192.0.2.1"))
+	require.ErrorAs(t, service.CheckLogin(ctx, "user1", ""), &throttleErr)
+	assert.InDelta(t, time.Hour.Seconds(), throttleErr.RetryAfter.Seconds(), 1)
+
+	// Other usernames from the same address are slowed down too.
+	require.ErrorAs(t, service.CheckLogin(ctx, "user2", "192.0.2.1"), &throttleErr)
+	assert.InDelta(t, (2 * time.Minute).Seconds(), throttleErr.RetryAfter.Seconds(), 1)
+	require.NoError(t, service.CheckLogin(ctx, "user2", "192.0.2.2"))
+	require.NoError(t, service.LoginSucceeded(ctx, "user2", "192.0.2.2"))
+
+	// A successful login clears the username but not the address.
+	require.NoError(t, service.LoginSucceeded(ctx, "user1", "192.0.2.1"))
+	assert.NotContains(t, store.attempts, "user:user1")
+	assert.Equal(t, 2, store.attempts["ip:192.0.2.1"].Failures)
+
+	// Every reservation was settled.
+	for key := range store.attempts {
+		assert.NotContains(t, key, "pending:")
+	}
+}
+
+func TestServiceAuthLoginThrottleInFlight(t *testing.T) {
+	ctx := context.Background()
+	cfg := AuthConfig{
+		SigningKey:    "test-key",
+		LoginThrottle: LoginThrottleConfig{MaxIpFailures: 2, BaseDelay: time.Minute},
+	}
+	service := newTestAuth(t, cfg)
+
+	// Two users log in from one address at the same time and neither login
+	// settles before both passed the check.
+	var checked, settled sync.WaitGroup
+	settle := make(chan struct{})
+	errs := make(chan error, 2)
+	for _, username := range []string{"user1", "user2"} {
+		checked.Add(1)
+		settled.Add(1)
+		go func() {
+			defer settled.Done()
+
+			err := service.CheckLogin(ctx, username, "192.0.2.1")
+			checked.Done()
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			<-settle
+			errs <- service.LoginSucceeded(ctx, username, "192.0.2.1")
+		}()
+	}
+
+	checked.Wait()
+
+	// A third one waits for a login in flight to settle.
+	var throttleErr *ThrottleError
+	if assert.ErrorAs(t, service.CheckLogin(ctx, "user3", "192.0.2.1"), &throttleErr) {
+		assert.Equal(t, time.Minute, throttleErr.RetryAfter)
+	}
+
+	close(settle)
+	settled.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, service.CheckLogin(ctx, "user3", "192.0.2.1"))
+}
+
+// racingLoginAttemptStore holds every read until n of them arrived, so all
+// concurrent logins are reserved before any of them reads the failures.
+type racingLoginAttemptStore struct {
+	*memoryLoginAttemptStore
+	reads sync.WaitGroup
+}
+
+func (s *racingLoginAttemptStore) GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error) {
+	attempts, err := s.memoryLoginAttemptStore.GetLoginAttempts(ctx, key)
+	s.reads.Done()
+	s.reads.Wait()
+	return attempts, err
+}
+
+func TestServiceAuthLoginThrottleConcurrent(t *testing.T) {
+	const guesses = 20
+
+	ctx := context.Background()
+	cfg := AuthConfig{
+		SigningKey:    "test-key",
+		LoginThrottle: LoginThrottleConfig{MaxUsernameFailures: 3},
+	}
+	store := &racingLoginAttemptStore{memoryLoginAttemptStore: newMemoryLoginAttemptStore()}
+	store.reads.Add(guesses)
+	service, err := NewAuth(cfg, newMemorySessionStore(), store)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, guesses)
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- service.CheckLogin(ctx, "user1", "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var passed int
+	for err := range errs {
+		if err == nil {
+			passed++
+			continue
+		}
+		assert.ErrorIs(t, err, ErrTooManyLoginAttempts)
+	}
+
+	assert.Equal(t, 3, passed, "only MaxUsernameFailures guesses reach the password check")
+	assert.Equal(t, 3, store.attempts["pending:user:user1"].Failures, "rejected guesses give their reservation back")
+}
+
+func newTestAuth(t *testing.T, cfg AuthConfig) *ServiceAuth {
+	service, err := NewAuth(cfg, newMemorySessionStore(), newMemoryLoginAttemptStore())
+	require.NoError(t, err)
+
+	return service
+}
+
+func TestServiceAuthAsymmetricKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaFile := writePrivateKey(t, dir, "rsa.pem", rsaKey)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edFile := writePrivateKey(t, dir, "ed.pem", edKey)
+
+	user := &models.User{Id: 1, Username: "testuser", Role: models.RoleUser}
+	keys := []SigningKeyConfig{
+		{Id: "rsa-1", Algorithm: AlgRS256, PrivateKeyFile: rsaFile},
+		{Id: "ed-1", Algorithm: AlgEdDSA, PrivateKeyFile: edFile},
+		{Id: "hs-1", Algorithm: AlgHS256, Secret: "shared"},
+	}
+
+	for _, kid := range []string{"rsa-1", "ed-1"} {
+		t.Run(kid, func(t *testing.T) {
+			service := newTestAuth(t, AuthConfig{SigningKeys: keys, ActiveKeyId: kid})
+
+			tokens, err := service.CreateSession(context.Background(), user)
+			require.NoError(t, err)
+
+			parsed, _, err := new(jwt.Parser).ParseUnverified(tokens.AccessToken, jwt.MapClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, kid, parsed.Header["kid"])
+
+			claims, err := service.ParseToken(tokens.AccessToken)
+			assert.NoError(t, err)
+			assert.Equal(t, user.Id, claims.Id)
+		})
+	}
+
+	service := newTestAuth(t, AuthConfig{SigningKeys: keys, ActiveKeyId: "rsa-1"})
+	jwks := service.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "ed-1", jwks.Keys[0].Kid)
+	assert.Equal(t, "Ed25519", jwks.Keys[0].Crv)
+	assert.Equal(t, "rsa-1", jwks.Keys[1].Kid)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+}
+
+func TestServiceAuthKeyRotation(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edFile := writePrivateKey(t, t.TempDir(), "ed.pem", edKey)
+
+	user := &models.User{Id: 1, Username: "testuser", Role: models.RoleUser}
+	oldKey := SigningKeyConfig{Id: "old", Algorithm: AlgEdDSA, PrivateKeyFile: edFile}
+	newKey := SigningKeyConfig{Id: "new", Algorithm: AlgHS256, Secret: "new-secret"}
+
+	before := newTestAuth(t, AuthConfig{SigningKeys: []SigningKeyConfig{oldKey}, ActiveKeyId: "old"})
+	tokens, err := before.CreateSession(context.Background(), user)
+	require.NoError(t, err)
+
+	oldKey.RetiredAt = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	rotated := newTestAuth(t, AuthConfig{SigningKeys: []SigningKeyConfig{oldKey, newKey}, ActiveKeyId: "new"})
+
+	_, err = rotated.ParseToken(tokens.AccessToken)
 	assert.NoError(t, err)
 
-	_, err = service.ParseToken(tokenString)
-	assert.Error(t, err)
-	assert.Equal(t, ErrClaimIdFails, err)
+	oldKey.RetiredAt = time.Now().Add(-time.Hour).Format(time.RFC3339)
+	expired := newTestAuth(t, AuthConfig{SigningKeys: []SigningKeyConfig{oldKey, newKey}, ActiveKeyId: "new"})
+
+	_, err = expired.ParseToken(tokens.AccessToken)
+	assert.Equal(t, ErrKeyRetired, err)
+	assert.Empty(t, expired.JWKS().Keys)
+
+	_, err = NewAuth(AuthConfig{SigningKeys: []SigningKeyConfig{oldKey, newKey}, ActiveKeyId: "old"}, newMemorySessionStore(), newMemoryLoginAttemptStore())
+	assert.ErrorIs(t, err, ErrActiveKeyNotFound)
+}
+
+func TestServiceAuthLegacyTokenWithoutKid(t *testing.T) {
+	legacy := newTestAuth(t, AuthConfig{SigningKey: "test-key"})
+	user := &models.User{Id: 1, Username: "testuser", Role: models.RoleUser}
+
+	tokens, err := legacy.CreateSession(context.Background(), user)
+	require.NoError(t, err)
+
+	keys := []SigningKeyConfig{{Id: "hs-1", Algorithm: AlgHS256, Secret: "new-secret"}}
+
+	withLegacy := newTestAuth(t, AuthConfig{SigningKey: "test-key", SigningKeys: keys, ActiveKeyId: "hs-1"})
+	_, err = withLegacy.ParseToken(tokens.AccessToken)
+	assert.NoError(t, err)
+
+	withoutLegacy := newTestAuth(t, AuthConfig{SigningKeys: keys, ActiveKeyId: "hs-1"})
+	_, err = withoutLegacy.ParseToken(tokens.AccessToken)
+	assert.Equal(t, ErrUnknownKeyId, err)
+}
+
+func writePrivateKey(t *testing.T, dir, name string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, name)
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	require.NoError(t, err)
+
+	return path
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+
+	return jwt.MapClaims{
+		"sub": "1",
+		"iss": DefaultIssuer,
+		"aud": DefaultAudience,
+		"iat": now.Unix(),
+		"exp": now.Add(DefaultAccessTokenTTL).Unix(),
+		"jti": "token",
+		"sid": "session",
+	}
+}
+
+func signClaims(t *testing.T, key string, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(key))
+	require.NoError(t, err)
+
+	return token
 }
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Session backs a refresh token. Only a hash of the refresh secret is kept,
+// so a leaked store cannot be used to mint new access tokens.
+type Session struct {
+	Id          string     `db:"id"`
+	UserId      int        `db:"user_id"`
+	Username    string     `db:"username"`
+	RefreshHash string     `db:"refresh_hash"`
+	ExpiresAt   time.Time  `db:"expires_at"`
+	RevokedAt   *time.Time `db:"revoked_at"`
+}
+
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *Session) error
+	GetSession(ctx context.Context, id string) (*Session, error)
+	RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error)
+	RevokeSession(ctx context.Context, id string) error
+	RevokeUserSessions(ctx context.Context, userId int, exceptId string) error
+}
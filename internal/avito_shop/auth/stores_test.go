@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySessionStore is a SessionStore for the tests of this package, which
+// cannot import the memory repository without an import cycle.
+type memorySessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{
+		sessions: make(map[string]Session),
+	}
+}
+
+func (m *memorySessionStore) CreateSession(_ context.Context, session *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[session.Id] = *session
+	return nil
+}
+
+func (m *memorySessionStore) GetSession(_ context.Context, id string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+
+	return &session, nil
+}
+
+func (m *memorySessionStore) RotateSession(_ context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.RevokedAt != nil || session.RefreshHash != oldHash {
+		return false, nil
+	}
+
+	session.RefreshHash, session.ExpiresAt = newHash, expiresAt
+	m.sessions[id] = session
+	return true, nil
+}
+
+func (m *memorySessionStore) RevokeSession(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	session.RevokedAt = &now
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *memorySessionStore) RevokeUserSessions(_ context.Context, userId int, exceptId string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, session := range m.sessions {
+		if session.UserId != userId || id == exceptId || session.RevokedAt != nil {
+			continue
+		}
+
+		session.RevokedAt = &now
+		m.sessions[id] = session
+	}
+
+	return nil
+}
+
+// memoryLoginAttemptStore is the LoginAttemptStore counterpart of
+// memorySessionStore.
+type memoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempts
+}
+
+func newMemoryLoginAttemptStore() *memoryLoginAttemptStore {
+	return &memoryLoginAttemptStore{
+		attempts: make(map[string]LoginAttempts),
+	}
+}
+
+func (m *memoryLoginAttemptStore) GetLoginAttempts(_ context.Context, key string) (*LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.attempts[key]
+	if !ok {
+		return &LoginAttempts{Key: key}, nil
+	}
+
+	return &attempts, nil
+}
+
+func (m *memoryLoginAttemptStore) RecordLoginFailure(_ context.Context, key string, now time.Time, window time.Duration) (*LoginAttempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.attempts[key]
+	if !ok || attempts.LastFailureAt.Before(now.Add(-window)) {
+		attempts = LoginAttempts{Key: key}
+	}
+
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	m.attempts[key] = attempts
+
+	return &attempts, nil
+}
+
+func (m *memoryLoginAttemptStore) ReleaseLoginAttempt(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts, ok := m.attempts[key]
+	if !ok {
+		return nil
+	}
+
+	if attempts.Failures <= 1 {
+		delete(m.attempts, key)
+		return nil
+	}
+
+	attempts.Failures--
+	m.attempts[key] = attempts
+	return nil
+}
+
+func (m *memoryLoginAttemptStore) ResetLoginAttempts(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultMaxUsernameFailures = 5
+	DefaultMaxIpFailures       = 50
+	DefaultLoginBaseDelay      = time.Second
+	DefaultLoginMaxDelay       = time.Minute
+	DefaultLockoutDuration     = 15 * time.Minute
+)
+
+// LoginThrottleConfig bounds password guessing. Every failure doubles the
+// wait before the next attempt, starting at BaseDelay and capped at MaxDelay;
+// once a counter reaches its maximum the key is locked for LockoutDuration.
+// Failures older than LockoutDuration are forgotten.
+type LoginThrottleConfig struct {
+	MaxUsernameFailures int           `mapstructure:"max_username_failures"`
+	MaxIpFailures       int           `mapstructure:"max_ip_failures"`
+	BaseDelay           time.Duration `mapstructure:"base_delay"`
+	MaxDelay            time.Duration `mapstructure:"max_delay"`
+	LockoutDuration     time.Duration `mapstructure:"lockout_duration"`
+}
+
+// LoginAttempts is the failure counter of one username or client address, or
+// the counter of its attempts in flight.
+type LoginAttempts struct {
+	Key           string    `db:"key"`
+	Failures      int       `db:"failures"`
+	LastFailureAt time.Time `db:"last_failure_at"`
+}
+
+// LoginAttemptStore keeps failure counters. RecordLoginFailure must be atomic
+// and return the counter it produced, so that concurrent guesses cannot
+// undercount; it starts over from one when the previous failure is older than
+// window. ReleaseLoginAttempt takes one failure back and drops the counter at
+// zero. GetLoginAttempts returns a zero counter for unknown keys.
+type LoginAttemptStore interface {
+	GetLoginAttempts(ctx context.Context, key string) (*LoginAttempts, error)
+	RecordLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*LoginAttempts, error)
+	ReleaseLoginAttempt(ctx context.Context, key string) error
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+// ThrottleError is returned while a username or client address is backing
+// off. It matches ErrTooManyLoginAttempts with errors.Is.
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+func (e *ThrottleError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrTooManyLoginAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *ThrottleError) Unwrap() error {
+	return ErrTooManyLoginAttempts
+}
+
+func (c LoginThrottleConfig) withDefaults() LoginThrottleConfig {
+	if c.MaxUsernameFailures <= 0 {
+		c.MaxUsernameFailures = DefaultMaxUsernameFailures
+	}
+
+	if c.MaxIpFailures <= 0 {
+		c.MaxIpFailures = DefaultMaxIpFailures
+	}
+
+	if c.BaseDelay <= 0 {
+		c.BaseDelay = DefaultLoginBaseDelay
+	}
+
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = DefaultLoginMaxDelay
+	}
+
+	if c.LockoutDuration <= 0 {
+		c.LockoutDuration = DefaultLockoutDuration
+	}
+
+	return c
+}
+
+// blockedUntil is the earliest time the next attempt for a key is allowed.
+func (c LoginThrottleConfig) blockedUntil(attempts *LoginAttempts, maxFailures int) time.Time {
+	if attempts.Failures == 0 {
+		return time.Time{}
+	}
+
+	if attempts.Failures >= maxFailures {
+		return attempts.LastFailureAt.Add(c.LockoutDuration)
+	}
+
+	delay := c.BaseDelay
+	for i := 1; i < attempts.Failures && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	return attempts.LastFailureAt.Add(min(delay, c.MaxDelay))
+}
+
+func usernameAttemptKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// pendingAttemptKey counts the attempts on key that passed CheckLogin and are
+// not settled yet, apart from the failures on key itself.
+func pendingAttemptKey(key string) string {
+	return "pending:" + key
+}
+
+// CheckLogin reserves a login attempt for the username and the client
+// address before the password is checked. Reservations are counted apart
+// from failures, so logins in flight do not slow each other down, but
+// failures and reservations together may not exceed the maximum: concurrent
+// guesses cannot all pass before any of them is recorded. It fails with a
+// *ThrottleError if either key is still backing off or has no attempt left.
+// A passed check is settled with LoginSucceeded or LoginFailed. An empty ip
+// skips the address.
+func (s *ServiceAuth) CheckLogin(ctx context.Context, username, ip string) error {
+	now := time.Now()
+	throttle := s.cfg.LoginThrottle
+
+	var retryAfter time.Duration
+	reserved := make([]string, 0, 2)
+	for key, maxFailures := range s.attemptKeys(username, ip) {
+		pending, err := s.attempts.RecordLoginFailure(ctx, pendingAttemptKey(key), now, throttle.LockoutDuration)
+		if err != nil {
+			s.releaseLoginAttempts(ctx, reserved)
+			return err
+		}
+		reserved = append(reserved, pendingAttemptKey(key))
+
+		// Failures are read after the reservation: an attempt settled in
+		// between is counted twice rather than not at all.
+		attempts, err := s.attempts.GetLoginAttempts(ctx, key)
+		if err != nil {
+			s.releaseLoginAttempts(ctx, reserved)
+			return err
+		}
+
+		wait := throttle.blockedUntil(attempts, maxFailures).Sub(now)
+		if wait <= 0 && attempts.Failures+pending.Failures > maxFailures {
+			// Only attempts in flight are in the way, one of them settles soon.
+			wait = throttle.BaseDelay
+		}
+		retryAfter = max(retryAfter, wait)
+	}
+
+	if retryAfter > 0 {
+		s.releaseLoginAttempts(ctx, reserved)
+		return &ThrottleError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// LoginSucceeded clears the username counter and gives the reservations back.
+// The address is not cleared: that would let one valid account unlock
+// guessing against every other one.
+func (s *ServiceAuth) LoginSucceeded(ctx context.Context, username, ip string) error {
+	defer s.releaseLoginAttempts(ctx, s.pendingAttemptKeys(username, ip))
+
+	return s.attempts.ResetLoginAttempts(ctx, usernameAttemptKey(username))
+}
+
+// LoginFailed turns the reservations of CheckLogin into failures of the
+// username and the client address.
+func (s *ServiceAuth) LoginFailed(ctx context.Context, username, ip string) error {
+	defer s.releaseLoginAttempts(ctx, s.pendingAttemptKeys(username, ip))
+
+	now := time.Now()
+	for key := range s.attemptKeys(username, ip) {
+		if _, err := s.attempts.RecordLoginFailure(ctx, key, now, s.cfg.LoginThrottle.LockoutDuration); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseLoginAttempts gives reservations back. Failing to do so only leaves
+// the attempt counted until the window runs out, so errors are logged rather
+// than returned.
+func (s *ServiceAuth) releaseLoginAttempts(ctx context.Context, keys []string) {
+	const op = "internal.avito_shop.auth.ServiceAuth.releaseLoginAttempts"
+
+	for _, key := range keys {
+		if err := s.attempts.ReleaseLoginAttempt(ctx, key); err != nil {
+			logrus.WithFields(logrus.Fields{"event": op, "key": key}).Warn(err)
+		}
+	}
+}
+
+func (s *ServiceAuth) attemptKeys(username, ip string) map[string]int {
+	keys := map[string]int{usernameAttemptKey(username): s.cfg.LoginThrottle.MaxUsernameFailures}
+	if ip != "" {
+		keys[ipAttemptKey(ip)] = s.cfg.LoginThrottle.MaxIpFailures
+	}
+
+	return keys
+}
+
+func (s *ServiceAuth) pendingAttemptKeys(username, ip string) []string {
+	keys := make([]string, 0, 2)
+	for key := range s.attemptKeys(username, ip) {
+		keys = append(keys, pendingAttemptKey(key))
+	}
+
+	return keys
+}
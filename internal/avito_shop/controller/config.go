@@ -1,6 +1,72 @@
 package controller
 
+// Registration modes control how new accounts are created.
+const (
+	// RegistrationAuto keeps the original behaviour: /api/auth creates an
+	// account for any unknown username, and /api/register is open as well.
+	RegistrationAuto = "auto"
+	// RegistrationOff turns implicit signup off: /api/auth only logs existing
+	// users in and accounts are created through /api/register.
+	RegistrationOff = "off"
+	// RegistrationInvite is RegistrationOff plus a mandatory invite code
+	// issued by an admin on every /api/register call.
+	RegistrationInvite = "invite"
+)
+
 type ServiceConfig struct {
-	Salt string `mapstructure:"hash_salt"`
-	Cost int    `mapstructure:"hash_cost"`
+	Salt             string `mapstructure:"hash_salt"`
+	Cost             int    `mapstructure:"hash_cost"`
+	AdminUsername    string `mapstructure:"admin_username"`
+	AdminPassword    string `mapstructure:"admin_password"`
+	RegistrationMode string `mapstructure:"registration_mode"`
+	// PasswordHasher picks the algorithm for new hashes; stored hashes of the
+	// other algorithm keep working and are upgraded on the next login.
+	PasswordHasher string         `mapstructure:"password_hasher"`
+	Argon2         Argon2Config   `mapstructure:"argon2"`
+	Policy         PolicyConfig   `mapstructure:"policy"`
+	Transfers      TransferConfig `mapstructure:"transfers"`
+}
+
+// TransferConfig limits coin transfers between users. DailyLimit caps the
+// total a user sends over any 24 hours. Zero disables a limit.
+type TransferConfig struct {
+	MaxAmount  int `mapstructure:"max_amount"`
+	DailyLimit int `mapstructure:"daily_limit"`
+}
+
+// Validate checks the options that have a fixed set of values and that the
+// pepper leaves room for a password. An empty registration mode means
+// RegistrationAuto and an empty hasher HasherBcrypt.
+func (c ServiceConfig) Validate() error {
+	switch c.RegistrationMode {
+	case "", RegistrationAuto, RegistrationOff, RegistrationInvite:
+	default:
+		return ErrInvalidRegistrationMode
+	}
+
+	switch c.PasswordHasher {
+	case "", HasherBcrypt, HasherArgon2id:
+	default:
+		return ErrInvalidPasswordHasher
+	}
+
+	if c.Transfers.MaxAmount < 0 || c.Transfers.DailyLimit < 0 {
+		return ErrInvalidTransferLimits
+	}
+
+	// The pepper is hashed with every password and has to leave room for the
+	// shortest one allowed.
+	if len(c.Salt)+c.Policy.minPasswordLength() > bcryptMaxBytes {
+		return ErrInvalidPolicy
+	}
+
+	return c.Policy.validate()
+}
+
+func (c ServiceConfig) registrationMode() string {
+	if c.RegistrationMode == "" {
+		return RegistrationAuto
+	}
+
+	return c.RegistrationMode
 }
@@ -2,13 +2,19 @@ package controller
 
 import (
 	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
 	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
 	"github.com/dgt4l/avito_shop/test/mocks"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -25,10 +31,37 @@ func TestShopService_BuyItem(t *testing.T) {
 	ctx := context.Background()
 	req := &dto.BuyItemRequest{Id: 1, Item: "item1"}
 
-	mockRepo.EXPECT().BuyItem(ctx, req.Id, req.Item).Return(nil)
+	mockRepo.EXPECT().BuyItem(ctx, req.Id, req.Item, 1, nil).Return(&dto.OrderResponse{}, nil)
 
-	err := service.BuyItem(ctx, req)
+	_, err := service.BuyItem(ctx, req)
 	assert.NoError(t, err)
+
+	_, err = service.BuyItem(ctx, &dto.BuyItemRequest{Id: 1, Item: "item1", Quantity: -2})
+	assert.Equal(t, ErrInvalidQuantity, err)
+}
+
+func TestShopService_CreateOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	req := &dto.OrderRequest{Id: 1, Items: []dto.OrderItem{{Item: "pen", Quantity: 5}, {Item: "cup", Quantity: 1}}}
+
+	mockRepo.EXPECT().CreateOrder(ctx, 1, req.Items, nil).Return(&dto.OrderResponse{}, nil)
+
+	_, err := service.CreateOrder(ctx, req)
+	assert.NoError(t, err)
+
+	_, err = service.CreateOrder(ctx, &dto.OrderRequest{Id: 1})
+	assert.Equal(t, ErrEmptyOrder, err)
+
+	_, err = service.CreateOrder(ctx, &dto.OrderRequest{Id: 1, Items: []dto.OrderItem{{Item: "pen"}}})
+	assert.Equal(t, ErrInvalidQuantity, err)
 }
 
 func TestShopService_GetInfo(t *testing.T) {
@@ -57,11 +90,84 @@ func TestShopService_GetInfo(t *testing.T) {
 		},
 	}
 
-	mockRepo.EXPECT().GetInfo(ctx, userId).Return(expectedInfo, nil)
+	mockRepo.EXPECT().GetInfo(ctx, &dto.InfoRequest{Id: userId}).Return(expectedInfo, nil)
 
-	info, err := service.GetInfo(ctx, userId)
+	info, err := service.GetInfo(ctx, &dto.InfoRequest{Id: userId})
 	assert.NoError(t, err)
 	assert.Equal(t, expectedInfo, info)
+
+	_, err = service.GetInfo(ctx, &dto.InfoRequest{Id: userId, Limit: -1})
+	assert.Equal(t, ErrInvalidLimit, err)
+}
+
+func TestShopService_GetHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	createdAt := time.Date(2025, 2, 14, 12, 0, 0, 123456000, time.UTC)
+	entries := []dto.HistoryEntry{
+		{Id: 9, Type: dto.HistoryTypeReceived, Counterparty: "user2", Amount: 50, CreatedAt: createdAt},
+		{Id: 8, Type: dto.HistoryTypeReceived, Counterparty: "user2", Amount: 20, CreatedAt: createdAt},
+		{Id: 7, Type: dto.HistoryTypeReceived, Counterparty: "user2", Amount: 10, CreatedAt: createdAt},
+	}
+
+	mockRepo.EXPECT().
+		GetHistory(ctx, &dto.HistoryFilter{UserId: 1, Type: dto.HistoryTypeReceived, Counterparty: "user2", Limit: 3}).
+		Return(entries, nil)
+
+	response, err := service.GetHistory(ctx, &dto.HistoryRequest{
+		Id:           1,
+		Direction:    dto.DirectionReceived,
+		Counterparty: "user2",
+		Limit:        2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, entries[:2], response.Entries)
+	assert.NotEmpty(t, response.NextCursor)
+
+	mockRepo.EXPECT().
+		GetHistory(ctx, &dto.HistoryFilter{
+			UserId: 1,
+			After:  &dto.HistoryCursor{CreatedAt: createdAt, Type: dto.HistoryTypeReceived, Id: 8},
+			Limit:  3,
+		}).
+		Return(entries[2:], nil)
+
+	response, err = service.GetHistory(ctx, &dto.HistoryRequest{Id: 1, Limit: 2, Cursor: response.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, entries[2:], response.Entries)
+	assert.Empty(t, response.NextCursor)
+}
+
+func TestShopService_GetHistory_InvalidRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := service.GetHistory(ctx, &dto.HistoryRequest{Id: 1, Direction: "sideways"})
+	assert.Equal(t, ErrInvalidDirection, err)
+
+	_, err = service.GetHistory(ctx, &dto.HistoryRequest{Id: 1, Limit: 1000})
+	assert.Equal(t, ErrInvalidLimit, err)
+
+	_, err = service.GetHistory(ctx, &dto.HistoryRequest{Id: 1, From: now, To: now.Add(-time.Hour)})
+	assert.Equal(t, ErrInvalidDateRange, err)
+
+	_, err = service.GetHistory(ctx, &dto.HistoryRequest{Id: 1, Cursor: "not-a-cursor"})
+	assert.Equal(t, ErrInvalidCursor, err)
 }
 
 func TestShopService_SendCoin(t *testing.T) {
@@ -77,12 +183,139 @@ func TestShopService_SendCoin(t *testing.T) {
 	fromUserId := 1
 	req := &dto.SendCoinRequest{ToUser: "user2", Amount: 50}
 
-	mockRepo.EXPECT().SendCoin(ctx, req.ToUser, fromUserId, req.Amount).Return(nil)
+	mockRepo.EXPECT().GetUser(ctx, req.ToUser).Return(&models.User{Id: 2, Username: "user2", Status: models.UserStatusActive}, nil)
+	mockRepo.EXPECT().SendCoin(ctx, req.ToUser, fromUserId, req.Amount, 0, nil).Return(&dto.SendCoinResponse{}, nil)
 
-	err := service.SendCoin(ctx, fromUserId, req)
+	_, err := service.SendCoin(ctx, fromUserId, req)
 	assert.NoError(t, err)
 }
 
+func TestShopService_SendCoin_Rules(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		request    *dto.SendCoinRequest
+		mockExpect func(mockRepo *mocks.MockRepository)
+		wantErr    error
+	}{
+		{
+			name:    "above per-transfer limit",
+			request: &dto.SendCoinRequest{ToUser: "user2", Amount: 501},
+			wantErr: ErrTransferLimit,
+		},
+		{
+			name:    "unknown recipient",
+			request: &dto.SendCoinRequest{ToUser: "ghost", Amount: 50},
+			mockExpect: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().GetUser(ctx, "ghost").Return(nil, repository.ErrUserNotFound)
+			},
+			wantErr: repository.ErrUserToNotFound,
+		},
+		{
+			name:    "self transfer",
+			request: &dto.SendCoinRequest{ToUser: "user1", Amount: 50},
+			mockExpect: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().GetUser(ctx, "user1").Return(&models.User{Id: 1, Username: "user1", Status: models.UserStatusActive}, nil)
+			},
+			wantErr: ErrSelfTransfer,
+		},
+		{
+			name:    "blocked recipient",
+			request: &dto.SendCoinRequest{ToUser: "user2", Amount: 50},
+			mockExpect: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().GetUser(ctx, "user2").Return(&models.User{Id: 2, Username: "user2", Status: models.UserStatusActive}, nil)
+				mockRepo.EXPECT().SendCoin(ctx, "user2", 1, 50, 1000, nil).Return(nil, repository.ErrRecipientBlocked)
+			},
+			wantErr: repository.ErrRecipientBlocked,
+		},
+		{
+			name:    "disabled recipient",
+			request: &dto.SendCoinRequest{ToUser: "user2", Amount: 50},
+			mockExpect: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().GetUser(ctx, "user2").Return(&models.User{Id: 2, Username: "user2", Status: models.UserStatusActive}, nil)
+				mockRepo.EXPECT().SendCoin(ctx, "user2", 1, 50, 1000, nil).Return(nil, repository.ErrRecipientDisabled)
+			},
+			wantErr: repository.ErrRecipientDisabled,
+		},
+		{
+			name:    "daily limit is passed to the repository",
+			request: &dto.SendCoinRequest{ToUser: "user2", Amount: 500},
+			mockExpect: func(mockRepo *mocks.MockRepository) {
+				mockRepo.EXPECT().GetUser(ctx, "user2").Return(&models.User{Id: 2, Username: "user2", Status: models.UserStatusActive}, nil)
+				mockRepo.EXPECT().SendCoin(ctx, "user2", 1, 500, 1000, nil).Return(nil, repository.ErrDailyTransferLimit)
+			},
+			wantErr: repository.ErrDailyTransferLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockAuth := mocks.NewMockAuthService(ctrl)
+			service := NewShopService(mockRepo, mockAuth, ServiceConfig{
+				Salt:      "test-salt",
+				Transfers: TransferConfig{MaxAmount: 500, DailyLimit: 1000},
+			})
+
+			if tt.mockExpect != nil {
+				tt.mockExpect(mockRepo)
+			}
+
+			_, err := service.SendCoin(ctx, 1, tt.request)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+}
+
+func TestShopService_SendCoin_IdempotencyKey(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	req := &dto.SendCoinRequest{ToUser: "user2", Amount: 50, IdempotencyKey: "key-1"}
+	other := &dto.SendCoinRequest{ToUser: "user2", Amount: 60, IdempotencyKey: "key-1"}
+
+	key, err := newIdempotencyKey(req.IdempotencyKey, operationSendCoin, req)
+	assert.NoError(t, err)
+	otherKey, err := newIdempotencyKey(other.IdempotencyKey, operationSendCoin, other)
+	assert.NoError(t, err)
+	assert.NotEqual(t, key.RequestHash, otherKey.RequestHash)
+
+	mockRepo.EXPECT().GetIdempotentResponse(ctx, 1, key, gomock.Any()).Return(false, nil)
+	mockRepo.EXPECT().GetUser(ctx, req.ToUser).Return(&models.User{Id: 2, Username: "user2", Status: models.UserStatusActive}, nil)
+	mockRepo.EXPECT().SendCoin(ctx, req.ToUser, 1, req.Amount, 0, key).Return(&dto.SendCoinResponse{Id: 7}, nil)
+
+	response, err := service.SendCoin(ctx, 1, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, response.Id)
+
+	// The retry is replayed before the recipient, disabled meanwhile, is
+	// looked at.
+	mockRepo.EXPECT().GetIdempotentResponse(ctx, 1, key, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ int, _ *dto.IdempotencyKey, response any) (bool, error) {
+			*response.(*dto.SendCoinResponse) = dto.SendCoinResponse{Id: 7}
+			return true, nil
+		})
+
+	response, err = service.SendCoin(ctx, 1, req)
+	assert.NoError(t, err)
+	assert.Equal(t, &dto.SendCoinResponse{Id: 7, Replayed: true}, response)
+
+	_, err = service.SendCoin(ctx, 1, &dto.SendCoinRequest{
+		ToUser: "user2", Amount: 50, IdempotencyKey: strings.Repeat("k", maxIdempotencyKeyLength+1),
+	})
+	assert.Equal(t, ErrInvalidIdempotencyKey, err)
+}
+
 func TestShopService_CreateUser(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -94,7 +327,7 @@ func TestShopService_CreateUser(t *testing.T) {
 
 	ctx := context.Background()
 	req := &dto.AuthRequest{Username: "user1", Password: "password1"}
-	expectedUser := &models.User{Id: 1, Username: "user1", Password: "password1"}
+	expectedUser := &models.User{Id: 1, Username: "user1"}
 
 	mockRepo.EXPECT().CreateUser(ctx, req.Username, gomock.Any()).Return(1, nil)
 
@@ -102,7 +335,8 @@ func TestShopService_CreateUser(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, expectedUser.Id, user.Id)
 	assert.Equal(t, expectedUser.Username, user.Username)
-	assert.Equal(t, expectedUser.Password, user.Password)
+	assert.NotEqual(t, req.Password, user.Password)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password+"test-salt")))
 }
 
 func TestShopService_AuthUser_NewUser(t *testing.T) {
@@ -116,12 +350,22 @@ func TestShopService_AuthUser_NewUser(t *testing.T) {
 
 	ctx := context.Background()
 	req := &dto.AuthRequest{Username: "user1", Password: "password1"}
-	expectedUser := &models.User{Id: 1, Username: "user1", Password: "password1"}
 	expectedToken := "test-token"
 
+	var storedHash string
+	mockAuth.EXPECT().CheckLogin(ctx, req.Username, "").Return(nil)
 	mockRepo.EXPECT().GetUser(ctx, req.Username).Return(nil, repository.ErrUserNotFound)
-	mockRepo.EXPECT().CreateUser(ctx, req.Username, gomock.Any()).Return(1, nil)
-	mockAuth.EXPECT().GenerateToken(expectedUser).Return(expectedToken, nil)
+	mockRepo.EXPECT().CreateUser(ctx, req.Username, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ string, hash string) (int, error) {
+			storedHash = hash
+			return 1, nil
+		})
+	mockAuth.EXPECT().LoginSucceeded(ctx, req.Username, "").Return(nil)
+	mockAuth.EXPECT().CreateSession(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, user *models.User) (*auth.Tokens, error) {
+			assert.Equal(t, &models.User{Id: 1, Username: "user1", Password: storedHash, Role: models.RoleUser}, user)
+			return &auth.Tokens{AccessToken: expectedToken}, nil
+		})
 
 	authResponse, err := service.AuthUser(ctx, req)
 	assert.NoError(t, err)
@@ -143,12 +387,417 @@ func TestShopService_AuthUser_ExistingUser(t *testing.T) {
 	existingUser := &models.User{Id: 1, Username: "user1", Password: string(hashedPassword)}
 	expectedToken := "test-token"
 
+	mockAuth.EXPECT().CheckLogin(ctx, req.Username, "").Return(nil)
 	mockRepo.EXPECT().GetUser(ctx, req.Username).Return(existingUser, nil)
-	mockAuth.EXPECT().GenerateToken(existingUser).Return(expectedToken, nil)
+	mockAuth.EXPECT().LoginSucceeded(ctx, req.Username, "").Return(nil)
+	mockAuth.EXPECT().CreateSession(ctx, existingUser).
+		Return(&auth.Tokens{AccessToken: expectedToken, RefreshToken: "sid.secret", ExpiresIn: 15 * time.Minute}, nil)
 
 	authResponse, err := service.AuthUser(ctx, req)
 	assert.NoError(t, err)
-	assert.Equal(t, expectedToken, authResponse.Token)
+	assert.Equal(t, &dto.AuthResponse{Token: expectedToken, RefreshToken: "sid.secret", ExpiresIn: 900}, authResponse)
+}
+
+func TestShopService_AuthUser_RegistrationOff(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt", RegistrationMode: RegistrationOff})
+
+	ctx := context.Background()
+	req := &dto.AuthRequest{Username: "typo-user", Password: "password1", ClientIp: "192.0.2.1"}
+
+	mockAuth.EXPECT().CheckLogin(ctx, req.Username, req.ClientIp).Return(nil)
+	mockRepo.EXPECT().GetUser(ctx, req.Username).Return(nil, repository.ErrUserNotFound)
+	mockAuth.EXPECT().LoginFailed(ctx, req.Username, req.ClientIp).Return(nil)
+
+	_, err := service.AuthUser(ctx, req)
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
+
+func TestShopService_Register(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt", RegistrationMode: RegistrationOff})
+
+	ctx := context.Background()
+	req := &dto.RegisterRequest{Username: "user1", Password: "password1"}
+
+	mockRepo.EXPECT().CreateUser(ctx, req.Username, gomock.Any()).Return(1, nil)
+	mockAuth.EXPECT().CreateSession(ctx, &models.User{Id: 1, Username: "user1", Role: models.RoleUser}).
+		Return(&auth.Tokens{AccessToken: "test-token"}, nil)
+
+	response, err := service.Register(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "test-token", response.Token)
+
+	mockRepo.EXPECT().CreateUser(ctx, req.Username, gomock.Any()).Return(0, repository.ErrUserAlreadyExists)
+
+	_, err = service.Register(ctx, req)
+	assert.Equal(t, repository.ErrUserAlreadyExists, err)
+
+	_, err = service.Register(ctx, &dto.RegisterRequest{Username: strings.Repeat("u", DefaultMaxUsernameLength+1), Password: "password1"})
+	assert.ErrorIs(t, err, ErrLongUsername)
+}
+
+func TestShopService_Register_InviteOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt", RegistrationMode: RegistrationInvite})
+
+	ctx := context.Background()
+
+	_, err := service.Register(ctx, &dto.RegisterRequest{Username: "user1", Password: "password1"})
+	assert.ErrorIs(t, err, ErrInviteRequired)
+
+	req := &dto.RegisterRequest{Username: "user1", Password: "password1", InviteCode: "invite"}
+
+	mockRepo.EXPECT().CreateInvitedUser(ctx, req.Username, gomock.Any(), "invite").Return(0, repository.ErrInvalidInvite)
+
+	_, err = service.Register(ctx, req)
+	assert.Equal(t, repository.ErrInvalidInvite, err)
+}
+
+func TestPasswordHasher(t *testing.T) {
+	fastArgon2 := Argon2Config{Memory: 1024, Iterations: 1, Parallelism: 1}
+
+	bcryptHasher := newPasswordHasher(ServiceConfig{Salt: "pepper", Cost: bcrypt.MinCost})
+	argon2Hasher := newPasswordHasher(ServiceConfig{Salt: "pepper", PasswordHasher: HasherArgon2id, Argon2: fastArgon2})
+
+	bcryptHash, err := bcryptHasher.Hash("password1")
+	require.NoError(t, err)
+
+	argon2Hash, err := argon2Hasher.Hash("password1")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(argon2Hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	tests := []struct {
+		name            string
+		hasher          PasswordHasher
+		password        string
+		hash            string
+		wantOk          bool
+		wantNeedsRehash bool
+	}{
+		{name: "BcryptCurrent", hasher: bcryptHasher, password: "password1", hash: bcryptHash, wantOk: true},
+		{name: "BcryptWrongPassword", hasher: bcryptHasher, password: "password2", hash: bcryptHash},
+		{
+			name:            "BcryptCostChanged",
+			hasher:          newPasswordHasher(ServiceConfig{Salt: "pepper", Cost: bcrypt.MinCost + 1}),
+			password:        "password1",
+			hash:            bcryptHash,
+			wantOk:          true,
+			wantNeedsRehash: true,
+		},
+		{name: "BcryptToArgon2", hasher: argon2Hasher, password: "password1", hash: bcryptHash, wantOk: true, wantNeedsRehash: true},
+		{name: "Argon2Current", hasher: argon2Hasher, password: "password1", hash: argon2Hash, wantOk: true},
+		{name: "Argon2WrongPassword", hasher: argon2Hasher, password: "password2", hash: argon2Hash},
+		{
+			name:            "Argon2ParamsChanged",
+			hasher:          newPasswordHasher(ServiceConfig{Salt: "pepper", PasswordHasher: HasherArgon2id, Argon2: Argon2Config{Memory: 2048, Iterations: 1, Parallelism: 1}}),
+			password:        "password1",
+			hash:            argon2Hash,
+			wantOk:          true,
+			wantNeedsRehash: true,
+		},
+		{name: "Argon2ToBcrypt", hasher: bcryptHasher, password: "password1", hash: argon2Hash, wantOk: true, wantNeedsRehash: true},
+		{name: "WrongPepper", hasher: newPasswordHasher(ServiceConfig{Salt: "other", PasswordHasher: HasherArgon2id, Argon2: fastArgon2}), password: "password1", hash: argon2Hash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := tt.hasher.Verify(tt.password, tt.hash)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.wantNeedsRehash, needsRehash)
+		})
+	}
+
+	_, _, err = bcryptHasher.Verify("password1", "plaintext")
+	assert.Equal(t, ErrUnknownPasswordHash, err)
+}
+
+func TestShopService_AuthUser_Rehash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	cfg := ServiceConfig{Salt: "test-salt", PasswordHasher: HasherArgon2id, Argon2: Argon2Config{Memory: 1024, Iterations: 1, Parallelism: 1}}
+	service := NewShopService(mockRepo, mockAuth, cfg)
+
+	ctx := context.Background()
+	req := &dto.AuthRequest{Username: "user1", Password: "password1"}
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password1test-salt"), bcrypt.MinCost)
+	existingUser := &models.User{Id: 1, Username: "user1", Password: string(hashedPassword)}
+
+	var newHash string
+	mockAuth.EXPECT().CheckLogin(ctx, req.Username, "").Return(nil)
+	mockRepo.EXPECT().GetUser(ctx, req.Username).Return(existingUser, nil)
+	mockAuth.EXPECT().LoginSucceeded(ctx, req.Username, "").Return(nil)
+	mockRepo.EXPECT().RehashPassword(ctx, 1, string(hashedPassword), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ int, _, hash string) error {
+			newHash = hash
+			return nil
+		})
+	mockAuth.EXPECT().CreateSession(ctx, existingUser).Return(&auth.Tokens{AccessToken: "test-token"}, nil)
+
+	_, err := service.AuthUser(ctx, req)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(newHash, "$argon2id$"))
+	assert.Equal(t, newHash, existingUser.Password)
+
+	ok, needsRehash, err := service.hasher.Verify(req.Password, newHash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+}
+
+func TestShopService_ChangePassword(t *testing.T) {
+	ctx := context.Background()
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password1test-salt"), bcrypt.MinCost)
+	user := &models.User{Id: 1, Username: "user1", Password: string(hashedPassword)}
+
+	tests := []struct {
+		name       string
+		request    *dto.ChangePasswordRequest
+		mockExpect func(mockRepo *mocks.MockRepository, mockAuth *mocks.MockAuthService)
+		wantErr    error
+	}{
+		{
+			name:    "success",
+			request: &dto.ChangePasswordRequest{Id: 1, SessionId: "sid", CurrentPassword: "password1", NewPassword: "password2"},
+			mockExpect: func(mockRepo *mocks.MockRepository, mockAuth *mocks.MockAuthService) {
+				mockRepo.EXPECT().GetUserById(ctx, 1).Return(user, nil)
+				mockAuth.EXPECT().CheckLogin(ctx, "user1", "").Return(nil)
+				mockAuth.EXPECT().LoginSucceeded(ctx, "user1", "").Return(nil)
+				mockRepo.EXPECT().UpdatePassword(ctx, 1, gomock.Any()).DoAndReturn(
+					func(_ context.Context, _ int, hash string) error {
+						return bcrypt.CompareHashAndPassword([]byte(hash), []byte("password2test-salt"))
+					})
+				mockAuth.EXPECT().RevokeUserSessions(ctx, 1, "sid").Return(nil)
+			},
+		},
+		{
+			name:    "wrong current password",
+			request: &dto.ChangePasswordRequest{Id: 1, SessionId: "sid", CurrentPassword: "password0", NewPassword: "password2"},
+			mockExpect: func(mockRepo *mocks.MockRepository, mockAuth *mocks.MockAuthService) {
+				mockRepo.EXPECT().GetUserById(ctx, 1).Return(user, nil)
+				mockAuth.EXPECT().CheckLogin(ctx, "user1", "").Return(nil)
+				mockAuth.EXPECT().LoginFailed(ctx, "user1", "").Return(nil)
+			},
+			wantErr: ErrInvalidPasswd,
+		},
+		{
+			name:       "same password",
+			request:    &dto.ChangePasswordRequest{Id: 1, CurrentPassword: "password1", NewPassword: "password1"},
+			mockExpect: func(*mocks.MockRepository, *mocks.MockAuthService) {},
+			wantErr:    ErrSamePassword,
+		},
+		{
+			name:       "short new password",
+			request:    &dto.ChangePasswordRequest{Id: 1, CurrentPassword: "password1", NewPassword: "short"},
+			mockExpect: func(*mocks.MockRepository, *mocks.MockAuthService) {},
+			wantErr:    ErrShortPassword,
+		},
+		{
+			name:       "missing current password",
+			request:    &dto.ChangePasswordRequest{Id: 1, NewPassword: "password2"},
+			mockExpect: func(*mocks.MockRepository, *mocks.MockAuthService) {},
+			wantErr:    ErrCurrentPasswordRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockRepo := mocks.NewMockRepository(ctrl)
+			mockAuth := mocks.NewMockAuthService(ctrl)
+			service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt", Cost: bcrypt.MinCost})
+
+			tt.mockExpect(mockRepo, mockAuth)
+
+			err := service.ChangePassword(ctx, tt.request)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestShopService_PasswordReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt", Cost: bcrypt.MinCost})
+
+	ctx := context.Background()
+
+	var storedHash string
+	mockRepo.EXPECT().CreatePasswordReset(ctx, "user1", gomock.Any(), 7, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, tokenHash string, _ int, _ time.Time) error {
+			storedHash = tokenHash
+			return nil
+		})
+
+	reset, err := service.CreatePasswordReset(ctx, &dto.PasswordResetRequest{Username: "user1", CreatedBy: 7})
+	require.NoError(t, err)
+	assert.NotEmpty(t, reset.ResetToken)
+	assert.NotEqual(t, reset.ResetToken, storedHash)
+	assert.Equal(t, hashResetToken(reset.ResetToken), storedHash)
+	assert.WithinDuration(t, time.Now().Add(passwordResetTTL), reset.ExpiresAt, time.Minute)
+
+	mockRepo.EXPECT().ResetPassword(ctx, storedHash, gomock.Any()).Return(1, nil)
+	mockAuth.EXPECT().RevokeUserSessions(ctx, 1, "").Return(nil)
+
+	err = service.ResetPassword(ctx, &dto.ResetPasswordRequest{ResetToken: reset.ResetToken, NewPassword: "password2"})
+	assert.NoError(t, err)
+
+	mockRepo.EXPECT().ResetPassword(ctx, storedHash, gomock.Any()).Return(0, repository.ErrInvalidResetToken)
+
+	err = service.ResetPassword(ctx, &dto.ResetPasswordRequest{ResetToken: reset.ResetToken, NewPassword: "password2"})
+	assert.Equal(t, repository.ErrInvalidResetToken, err)
+
+	err = service.ResetPassword(ctx, &dto.ResetPasswordRequest{NewPassword: "password2"})
+	assert.ErrorIs(t, err, ErrResetTokenRequired)
+}
+
+func TestServiceConfig_Validate(t *testing.T) {
+	assert.NoError(t, ServiceConfig{}.Validate())
+	assert.NoError(t, ServiceConfig{RegistrationMode: RegistrationInvite}.Validate())
+	assert.Equal(t, ErrInvalidRegistrationMode, ServiceConfig{RegistrationMode: "closed"}.Validate())
+	assert.NoError(t, ServiceConfig{PasswordHasher: HasherArgon2id}.Validate())
+	assert.Equal(t, ErrInvalidPasswordHasher, ServiceConfig{PasswordHasher: "md5"}.Validate())
+	assert.Equal(t, ErrInvalidPolicy, ServiceConfig{Policy: PolicyConfig{UsernameCharacters: []string{"emoji"}}}.Validate())
+	assert.Equal(t, ErrInvalidPolicy, ServiceConfig{Policy: PolicyConfig{MinPasswordLength: 20, MaxPasswordLength: 10}}.Validate())
+	assert.Equal(t, ErrInvalidTransferLimits, ServiceConfig{Transfers: TransferConfig{DailyLimit: -1}}.Validate())
+}
+
+func TestPolicy(t *testing.T) {
+	policy := NewPolicy(PolicyConfig{
+		UsernameCharacters: []string{CharsLetter, CharsDigit, CharsUnderscore},
+		ReservedUsernames:  []string{"Admin"},
+		PasswordDenylist:   []string{"Password1"},
+	}, "")
+
+	err := ValidateNewCredentials(&dto.AuthRequest{Username: "ab", Password: "short"}, policy)
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []dto.Violation{
+		{Field: "username", Rule: "min_length", Message: ErrShortUsername.Error()},
+		{Field: "password", Rule: "min_length", Message: ErrShortPassword.Error()},
+	}, validationErr.Violations)
+	assert.ErrorIs(t, err, ErrShortUsername)
+	assert.ErrorIs(t, err, ErrShortPassword)
+
+	err = ValidateNewCredentials(&dto.AuthRequest{Username: "ADMIN", Password: "password1"}, policy)
+	assert.ErrorIs(t, err, ErrReservedUsername)
+	assert.ErrorIs(t, err, ErrCommonPassword)
+
+	err = ValidateNewCredentials(&dto.AuthRequest{Username: "user.name", Password: "password2"}, policy)
+	assert.ErrorIs(t, err, ErrUsernameCharacters)
+
+	// Lengths count runes, not bytes.
+	assert.NoError(t, ValidateNewCredentials(&dto.AuthRequest{Username: "юзер_1", Password: "пароль12"}, policy))
+
+	// Logins are held to the length rules only.
+	assert.NoError(t, ValidateAuth(&dto.AuthRequest{Username: "admin", Password: "password1"}, policy))
+
+	err = ValidateChangePassword(&dto.ChangePasswordRequest{CurrentPassword: "password1", NewPassword: "password1"}, policy)
+	assert.ErrorIs(t, err, ErrCommonPassword)
+	assert.ErrorIs(t, err, ErrSamePassword)
+}
+
+func TestShopService_Register_PasswordWithPepper(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// The 16 byte pepper of the sample configs leaves 56 bytes for a password.
+	cfg := ServiceConfig{Salt: "avwaepdqwdioqkpf", Cost: bcrypt.MinCost}
+	service := NewShopService(mocks.NewMockRepository(ctrl), mocks.NewMockAuthService(ctrl), cfg)
+
+	_, err := service.Register(context.Background(), &dto.RegisterRequest{Username: "user1", Password: strings.Repeat("p", 60)})
+	var validationErr *ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	assert.Equal(t, []dto.Violation{
+		{Field: "password", Rule: "max_length", Message: ErrLongPassword.Error()},
+	}, validationErr.Violations)
+
+	policy := NewPolicy(cfg.Policy, cfg.Salt)
+	assert.NoError(t, ValidateNewCredentials(&dto.AuthRequest{Username: "user1", Password: strings.Repeat("p", 56)}, policy))
+
+	// Should the policy and the hasher ever disagree, bcrypt refusing the
+	// input is still a client error.
+	_, err = newBcryptHasher(cfg.Salt, cfg.Cost).Hash(strings.Repeat("p", 60))
+	assert.Equal(t, ErrLongPassword, err)
+
+	assert.Equal(t, ErrInvalidPolicy, ServiceConfig{Salt: strings.Repeat("s", 70)}.Validate())
+
+	// The configured minimum counts, not the default.
+	short := PolicyConfig{MinPasswordLength: 4, MaxPasswordLength: 4}
+	assert.NoError(t, ServiceConfig{Salt: strings.Repeat("s", 66), Policy: short}.Validate())
+	assert.Equal(t, ErrInvalidPolicy, ServiceConfig{Salt: strings.Repeat("s", 69), Policy: short}.Validate())
+	assert.Equal(t, ErrInvalidPolicy, ServiceConfig{Policy: PolicyConfig{MaxPasswordLength: 6}}.Validate())
+}
+
+func TestPolicyConfig_LoadPasswordDenylist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# common passwords\nqwerty123\n\n  letmein1  \n"), 0o600))
+
+	cfg := PolicyConfig{PasswordDenylist: []string{"password1"}, PasswordDenylistFile: path}
+	require.NoError(t, cfg.LoadPasswordDenylist())
+	assert.Equal(t, []string{"password1", "qwerty123", "letmein1"}, cfg.PasswordDenylist)
+
+	err := ValidateNewCredentials(&dto.AuthRequest{Username: "user1", Password: "LetMeIn1"}, NewPolicy(cfg, ""))
+	assert.ErrorIs(t, err, ErrCommonPassword)
+
+	cfg = PolicyConfig{PasswordDenylistFile: filepath.Join(t.TempDir(), "missing.txt")}
+	assert.Error(t, cfg.LoadPasswordDenylist())
+}
+
+func TestShopService_RefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	session := &auth.Session{Id: "sid", UserId: 1, Username: "user1"}
+	user := &models.User{Id: 1, Username: "user1", Role: models.RoleAdmin}
+
+	mockAuth.EXPECT().ParseRefreshToken(ctx, "sid.secret").Return(session, nil)
+	mockRepo.EXPECT().GetUser(ctx, "user1").Return(user, nil)
+	mockAuth.EXPECT().RotateSession(ctx, session, user).
+		Return(&auth.Tokens{AccessToken: "new-token", RefreshToken: "sid.new-secret", ExpiresIn: 15 * time.Minute}, nil)
+
+	authResponse, err := service.RefreshToken(ctx, &dto.RefreshRequest{RefreshToken: "sid.secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, "sid.new-secret", authResponse.RefreshToken)
+
+	_, err = service.RefreshToken(ctx, &dto.RefreshRequest{})
+	assert.Equal(t, auth.ErrInvalidRefreshToken, err)
+
+	mockAuth.EXPECT().ParseRefreshToken(ctx, "sid.stale").Return(nil, auth.ErrInvalidRefreshToken)
+
+	_, err = service.RefreshToken(ctx, &dto.RefreshRequest{RefreshToken: "sid.stale"})
+	assert.Equal(t, auth.ErrInvalidRefreshToken, err)
 }
 
 func TestShopService_AuthUser_InvalidPassword(t *testing.T) {
@@ -161,13 +810,248 @@ func TestShopService_AuthUser_InvalidPassword(t *testing.T) {
 	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
 
 	ctx := context.Background()
-	req := &dto.AuthRequest{Username: "user1", Password: "wrong-password"}
+	req := &dto.AuthRequest{Username: "user1", Password: "wrong-password", ClientIp: "192.0.2.1"}
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password1test-salt"), bcrypt.DefaultCost)
 	existingUser := &models.User{Id: 1, Username: "user1", Password: string(hashedPassword)}
 
+	mockAuth.EXPECT().CheckLogin(ctx, req.Username, req.ClientIp).Return(nil)
 	mockRepo.EXPECT().GetUser(ctx, req.Username).Return(existingUser, nil)
+	mockAuth.EXPECT().LoginFailed(ctx, req.Username, req.ClientIp).Return(nil)
 
 	_, err := service.AuthUser(ctx, req)
 	assert.Error(t, err)
-	assert.Equal(t, ErrInvalidPasswd, err)
+	assert.Equal(t, ErrInvalidCredentials, err)
+}
+
+func TestShopService_AuthUser_Throttled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	req := &dto.AuthRequest{Username: "user1", Password: "password1", ClientIp: "192.0.2.1"}
+	throttled := &auth.ThrottleError{RetryAfter: time.Minute}
+
+	mockAuth.EXPECT().CheckLogin(ctx, req.Username, req.ClientIp).Return(throttled)
+
+	_, err := service.AuthUser(ctx, req)
+	assert.ErrorIs(t, err, auth.ErrTooManyLoginAttempts)
+}
+
+func TestShopService_GetItems(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	req := &dto.ItemsRequest{SortBy: dto.SortByPrice}
+	expectedItems := []dto.Item{{Id: 4, Name: "pen", Price: 10, Available: true}}
+
+	mockRepo.EXPECT().
+		GetItems(ctx, &dto.ItemsRequest{SortBy: dto.SortByPrice, Order: dto.OrderAsc}).
+		Return(expectedItems, nil)
+
+	response, err := service.GetItems(ctx, req)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedItems, response.Items)
+}
+
+func TestShopService_GetItems_InvalidRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+
+	_, err := service.GetItems(ctx, &dto.ItemsRequest{SortBy: "weight"})
+	assert.Equal(t, ErrInvalidSortField, err)
+
+	_, err = service.GetItems(ctx, &dto.ItemsRequest{Order: "up"})
+	assert.Equal(t, ErrInvalidSortOrder, err)
+
+	_, err = service.GetItems(ctx, &dto.ItemsRequest{MinPrice: 100, MaxPrice: 10})
+	assert.Equal(t, ErrInvalidPriceRange, err)
+}
+
+func TestShopService_CreateItem(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	expectedItem := &models.Item{Id: 11, Name: "sticker", Price: 5}
+
+	mockRepo.EXPECT().CreateItem(ctx, &models.Item{Name: "sticker", Price: 5}).Return(expectedItem, nil)
+
+	item, err := service.CreateItem(ctx, &dto.CreateItemRequest{Name: "sticker", Price: 5})
+	assert.NoError(t, err)
+	assert.Equal(t, expectedItem, item)
+
+	_, err = service.CreateItem(ctx, &dto.CreateItemRequest{Name: "sticker"})
+	assert.Equal(t, ErrInvalidPrice, err)
+
+	_, err = service.CreateItem(ctx, &dto.CreateItemRequest{Price: 5})
+	assert.Equal(t, ErrEmptyItemName, err)
+
+	stock := -1
+	_, err = service.CreateItem(ctx, &dto.CreateItemRequest{Name: "sticker", Price: 5, Stock: &stock})
+	assert.Equal(t, ErrInvalidStock, err)
+}
+
+func TestShopService_SetItemLimits(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	stock, maxPerUser := 100, 1
+	expectedItem := &models.Item{Id: 10, Name: "pink-hoody", Price: 500, Stock: &stock, MaxPerUser: &maxPerUser}
+
+	mockRepo.EXPECT().SetItemLimits(ctx, 10, &stock, &maxPerUser).Return(expectedItem, nil)
+
+	item, err := service.SetItemLimits(ctx, &dto.SetItemLimitsRequest{Id: 10, Stock: &stock, MaxPerUser: &maxPerUser})
+	assert.NoError(t, err)
+	assert.Equal(t, expectedItem, item)
+
+	zero := 0
+	_, err = service.SetItemLimits(ctx, &dto.SetItemLimitsRequest{Id: 10, MaxPerUser: &zero})
+	assert.Equal(t, ErrInvalidPurchaseLimit, err)
+}
+
+func TestShopService_UpdateItem(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+	expectedItem := &models.Item{Id: 4, Name: "pen", Price: 15}
+
+	mockRepo.EXPECT().UpdateItemPrice(ctx, 4, 15).Return(expectedItem, nil)
+
+	item, err := service.UpdateItem(ctx, &dto.UpdateItemRequest{Id: 4, Price: 15})
+	assert.NoError(t, err)
+	assert.Equal(t, expectedItem, item)
+
+	_, err = service.UpdateItem(ctx, &dto.UpdateItemRequest{Id: 4, Price: -1})
+	assert.Equal(t, ErrInvalidPrice, err)
+}
+
+func TestShopService_RetireItem(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().RetireItem(ctx, 4).Return(repository.ErrItemNotFound)
+
+	err := service.RetireItem(ctx, &dto.RetireItemRequest{Id: 4})
+	assert.Equal(t, repository.ErrItemNotFound, err)
+
+	err = service.RetireItem(ctx, &dto.RetireItemRequest{})
+	assert.Equal(t, ErrInvalidItemId, err)
+}
+
+func TestShopService_BootstrapAdmin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{
+		Salt:          "test-salt",
+		AdminUsername: "admin",
+		AdminPassword: "adminpassword",
+	})
+
+	ctx := context.Background()
+
+	gomock.InOrder(
+		mockRepo.EXPECT().GetUser(ctx, "admin").Return(nil, repository.ErrUserNotFound),
+		mockRepo.EXPECT().CreateUser(ctx, "admin", gomock.Any()).Return(1, nil),
+		mockRepo.EXPECT().SetUserRole(ctx, "admin", models.RoleAdmin).Return(nil),
+	)
+
+	err := service.BootstrapAdmin(ctx)
+	assert.NoError(t, err)
+}
+
+func TestShopService_BootstrapAdmin_ExistingUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt", AdminUsername: "admin"})
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().GetUser(ctx, "admin").Return(&models.User{Id: 1, Username: "admin"}, nil)
+	mockRepo.EXPECT().SetUserRole(ctx, "admin", models.RoleAdmin).Return(nil)
+
+	err := service.BootstrapAdmin(ctx)
+	assert.NoError(t, err)
+}
+
+func TestShopService_BootstrapAdmin_NotConfigured(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	err := service.BootstrapAdmin(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestShopService_SetUserRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockRepo := mocks.NewMockRepository(ctrl)
+	mockAuth := mocks.NewMockAuthService(ctrl)
+
+	service := NewShopService(mockRepo, mockAuth, ServiceConfig{Salt: "test-salt"})
+
+	ctx := context.Background()
+
+	mockRepo.EXPECT().SetUserRole(ctx, "user2", models.RoleAdmin).Return(nil)
+
+	err := service.SetUserRole(ctx, &dto.SetRoleRequest{Username: "user2", Role: models.RoleAdmin})
+	assert.NoError(t, err)
+
+	err = service.SetUserRole(ctx, &dto.SetRoleRequest{Username: "user2", Role: "root"})
+	assert.ErrorIs(t, err, ErrInvalidRole)
 }
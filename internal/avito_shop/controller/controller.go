@@ -2,55 +2,233 @@ package controller
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"sync"
+	"time"
 
 	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
 	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	inviteCodeSize = 18
+	inviteTTL      = 7 * 24 * time.Hour
+
+	resetTokenSize   = 32
+	passwordResetTTL = time.Hour
+
+	dummyPassword = "dummy-password"
 )
 
 type Repository interface {
-	BuyItem(ctx context.Context, id int, item string) error
-	GetInfo(ctx context.Context, userId int) (*dto.InfoResponse, error)
-	SendCoin(ctx context.Context, toUser string, fromUserId, amount int) error
+	BuyItem(ctx context.Context, id int, item string, quantity int, key *dto.IdempotencyKey) (*dto.OrderResponse, error)
+	CreateOrder(ctx context.Context, userId int, items []dto.OrderItem, key *dto.IdempotencyKey) (*dto.OrderResponse, error)
+	GetInfo(ctx context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error)
+	GetHistory(ctx context.Context, filter *dto.HistoryFilter) ([]dto.HistoryEntry, error)
+	SendCoin(ctx context.Context, toUser string, fromUserId, amount, dailyLimit int, key *dto.IdempotencyKey) (*dto.SendCoinResponse, error)
+	GetIdempotentResponse(ctx context.Context, userId int, key *dto.IdempotencyKey, response any) (bool, error)
 	CreateUser(ctx context.Context, username, password string) (int, error)
+	CreateInvitedUser(ctx context.Context, username, password, invite string) (int, error)
+	CreateInvite(ctx context.Context, code string, createdBy int, expiresAt time.Time) error
 	GetUser(ctx context.Context, username string) (*models.User, error)
+	GetItems(ctx context.Context, request *dto.ItemsRequest) ([]dto.Item, error)
+	CreateItem(ctx context.Context, item *models.Item) (*models.Item, error)
+	UpdateItemPrice(ctx context.Context, id, price int) (*models.Item, error)
+	SetItemLimits(ctx context.Context, id int, stock, maxPerUser *int) (*models.Item, error)
+	RetireItem(ctx context.Context, id int) error
+	SetUserRole(ctx context.Context, username, role string) error
+	SetUserStatus(ctx context.Context, username, status string) error
+	RehashPassword(ctx context.Context, userId int, oldHash, newHash string) error
+	GetUserById(ctx context.Context, id int) (*models.User, error)
+	UpdatePassword(ctx context.Context, userId int, password string) error
+	CreatePasswordReset(ctx context.Context, username, tokenHash string, createdBy int, expiresAt time.Time) error
+	ResetPassword(ctx context.Context, tokenHash, password string) (int, error)
+	VerifyLedger(ctx context.Context) (*dto.LedgerReport, error)
 }
 
 type ShopService struct {
-	repo Repository
-	auth auth.AuthService
-	cfg  ServiceConfig
+	repo   Repository
+	auth   auth.AuthService
+	hasher PasswordHasher
+	policy *Policy
+	cfg    ServiceConfig
+	// dummyHash is checked for logins of unknown users, so that they take as
+	// long as a wrong password.
+	dummyHash func() (string, error)
 }
 
 func NewShopService(repo Repository, auth auth.AuthService, cfg ServiceConfig) *ShopService {
+	hasher := newPasswordHasher(cfg)
+
 	return &ShopService{
-		repo: repo,
-		auth: auth,
-		cfg:  cfg,
+		repo:   repo,
+		auth:   auth,
+		hasher: hasher,
+		policy: NewPolicy(cfg.Policy, cfg.Salt),
+		cfg:    cfg,
+		dummyHash: sync.OnceValues(func() (string, error) {
+			return hasher.Hash(dummyPassword)
+		}),
 	}
 }
 
-func (s *ShopService) BuyItem(ctx context.Context, request *dto.BuyItemRequest) error {
+func (s *ShopService) BuyItem(ctx context.Context, request *dto.BuyItemRequest) (*dto.OrderResponse, error) {
 	if err := ValidateBuyItem(request); err != nil {
-		return err
+		return nil, err
+	}
+
+	key, err := newIdempotencyKey(request.IdempotencyKey, operationBuyItem, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.BuyItem(ctx, request.Id, request.Item, request.Quantity, key)
+}
+
+func (s *ShopService) CreateOrder(ctx context.Context, request *dto.OrderRequest) (*dto.OrderResponse, error) {
+	if err := ValidateOrder(request); err != nil {
+		return nil, err
 	}
 
-	return s.repo.BuyItem(ctx, request.Id, request.Item)
+	key, err := newIdempotencyKey(request.IdempotencyKey, operationCreateOrder, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.CreateOrder(ctx, request.Id, request.Items, key)
 }
 
-func (s *ShopService) GetInfo(ctx context.Context, userId int) (*dto.InfoResponse, error) {
-	return s.repo.GetInfo(ctx, userId)
+func (s *ShopService) GetInfo(ctx context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error) {
+	if err := ValidateInfo(request); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetInfo(ctx, request)
 }
 
-func (s *ShopService) SendCoin(ctx context.Context, fromUserId int, request *dto.SendCoinRequest) error {
-	if err := ValidateSendCoin(request); err != nil {
-		return err
+func (s *ShopService) GetHistory(ctx context.Context, request *dto.HistoryRequest) (*dto.HistoryResponse, error) {
+	filter, err := ValidateHistory(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// One extra entry tells whether there is a next page.
+	filter.Limit++
+
+	entries, err := s.repo.GetHistory(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &dto.HistoryResponse{Entries: entries}
+	if len(entries) == filter.Limit {
+		response.Entries = entries[:len(entries)-1]
+		response.NextCursor = encodeHistoryCursor(response.Entries[len(response.Entries)-1])
+	}
+
+	return response, nil
+}
+
+func (s *ShopService) GetItems(ctx context.Context, request *dto.ItemsRequest) (*dto.ItemsResponse, error) {
+	if err := ValidateGetItems(request); err != nil {
+		return nil, err
+	}
+
+	items, err := s.repo.GetItems(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dto.ItemsResponse{Items: items}, nil
+}
+
+func (s *ShopService) CreateItem(ctx context.Context, request *dto.CreateItemRequest) (*models.Item, error) {
+	if err := ValidateCreateItem(request); err != nil {
+		return nil, err
+	}
+
+	return s.repo.CreateItem(ctx, &models.Item{
+		Name:       request.Name,
+		Price:      request.Price,
+		Stock:      request.Stock,
+		MaxPerUser: request.MaxPerUser,
+	})
+}
+
+func (s *ShopService) UpdateItem(ctx context.Context, request *dto.UpdateItemRequest) (*models.Item, error) {
+	if err := ValidateUpdateItem(request); err != nil {
+		return nil, err
+	}
+
+	return s.repo.UpdateItemPrice(ctx, request.Id, request.Price)
+}
+
+func (s *ShopService) SetItemLimits(ctx context.Context, request *dto.SetItemLimitsRequest) (*models.Item, error) {
+	if err := ValidateSetItemLimits(request); err != nil {
+		return nil, err
+	}
+
+	return s.repo.SetItemLimits(ctx, request.Id, request.Stock, request.MaxPerUser)
+}
+
+func (s *ShopService) RetireItem(ctx context.Context, request *dto.RetireItemRequest) error {
+	if request.Id <= 0 {
+		return ErrInvalidItemId
+	}
+
+	return s.repo.RetireItem(ctx, request.Id)
+}
+
+func (s *ShopService) SendCoin(ctx context.Context, fromUserId int, request *dto.SendCoinRequest) (*dto.SendCoinResponse, error) {
+	if err := ValidateSendCoin(request, s.policy); err != nil {
+		return nil, err
+	}
+
+	if limit := s.cfg.Transfers.MaxAmount; limit > 0 && request.Amount > limit {
+		return nil, ErrTransferLimit
+	}
+
+	key, err := newIdempotencyKey(request.IdempotencyKey, operationSendCoin, request)
+	if err != nil {
+		return nil, err
+	}
+
+	// A retry of a committed transfer is answered with the stored response
+	// even if the recipient was deleted in between.
+	if key != nil {
+		var response dto.SendCoinResponse
+		replayed, err := s.repo.GetIdempotentResponse(ctx, fromUserId, key, &response)
+		if err != nil {
+			return nil, err
+		}
+
+		if replayed {
+			response.Replayed = true
+			return &response, nil
+		}
 	}
 
-	return s.repo.SendCoin(ctx, request.ToUser, fromUserId, request.Amount)
+	recipient, err := s.repo.GetUser(ctx, request.ToUser)
+	if err != nil && errors.Is(err, repository.ErrUserNotFound) {
+		return nil, repository.ErrUserToNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if recipient.Id == fromUserId {
+		return nil, ErrSelfTransfer
+	}
+
+	// The recipient's status is checked by the repository, under the lock of
+	// the transfer.
+	return s.repo.SendCoin(ctx, request.ToUser, fromUserId, request.Amount, s.cfg.Transfers.DailyLimit, key)
 }
 
 func (s *ShopService) CreateUser(ctx context.Context, request *dto.AuthRequest) (*models.User, error) {
@@ -67,51 +245,346 @@ func (s *ShopService) CreateUser(ctx context.Context, request *dto.AuthRequest)
 	user := models.User{
 		Id:       id,
 		Username: request.Username,
-		Password: request.Password,
+		Password: password_hash,
+		Role:     models.RoleUser,
 	}
 
 	return &user, nil
 }
 
+func (s *ShopService) SetUserRole(ctx context.Context, request *dto.SetRoleRequest) error {
+	if err := ValidateSetRole(request, s.policy); err != nil {
+		return err
+	}
+
+	return s.repo.SetUserRole(ctx, request.Username, request.Role)
+}
+
+func (s *ShopService) SetUserStatus(ctx context.Context, request *dto.SetStatusRequest) error {
+	if err := ValidateSetStatus(request, s.policy); err != nil {
+		return err
+	}
+
+	return s.repo.SetUserStatus(ctx, request.Username, request.Status)
+}
+
+func (s *ShopService) VerifyLedger(ctx context.Context) (*dto.LedgerReport, error) {
+	return s.repo.VerifyLedger(ctx)
+}
+
+// BootstrapAdmin grants the admin role to the user configured in ServiceConfig,
+// creating the account first if it does not exist yet.
+func (s *ShopService) BootstrapAdmin(ctx context.Context) error {
+	if s.cfg.AdminUsername == "" {
+		return nil
+	}
+
+	request := &dto.AuthRequest{Username: s.cfg.AdminUsername, Password: s.cfg.AdminPassword}
+
+	_, err := s.repo.GetUser(ctx, request.Username)
+	if err != nil && errors.Is(err, repository.ErrUserNotFound) {
+		if err := ValidateNewCredentials(request, s.policy); err != nil {
+			return err
+		}
+
+		if _, err := s.CreateUser(ctx, request); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return s.repo.SetUserRole(ctx, request.Username, models.RoleAdmin)
+}
+
 func (s *ShopService) generatePasswordHash(password string) (string, error) {
-	var passwordBytes = []byte(password + s.cfg.Salt)
+	return s.hasher.Hash(password)
+}
 
-	hashedPasswordBytes, err := bcrypt.GenerateFromPassword(passwordBytes, s.cfg.Cost)
+// rehashPassword upgrades a hash made with outdated settings. It runs only
+// after a successful login, the one moment the plaintext is known; a failure
+// is logged and the login goes on with the old hash.
+func (s *ShopService) rehashPassword(ctx context.Context, user *models.User, password string) {
+	const op = "internal.avito_shop.controller.ShopService.rehashPassword"
 
-	return string(hashedPasswordBytes), err
+	hash, err := s.hasher.Hash(password)
+	if err == nil {
+		err = s.repo.RehashPassword(ctx, user.Id, user.Password, hash)
+	}
+
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"event": op, "id": user.Id}).Warn(err)
+		return
+	}
+
+	user.Password = hash
 }
 
+// AuthUser logs a user in, creating the account first in auto registration
+// mode. CheckLogin reserves the attempt in the throttle of both the username
+// and the client address before anything is checked; every outcome but a
+// successful login or registration is settled as a failure.
 func (s *ShopService) AuthUser(ctx context.Context, request *dto.AuthRequest) (*dto.AuthResponse, error) {
-	if err := ValidateAuth(request); err != nil {
+	if err := ValidateAuth(request, s.policy); err != nil {
 		return nil, err
 	}
 
+	if err := s.auth.CheckLogin(ctx, request.Username, request.ClientIp); err != nil {
+		return nil, err
+	}
+
+	user, err := s.login(ctx, request)
+	if err != nil {
+		s.loginFailed(ctx, request.Username, request.ClientIp)
+		return nil, err
+	}
+
+	if err := s.auth.LoginSucceeded(ctx, request.Username, request.ClientIp); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.CreateSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuthResponse(tokens), nil
+}
+
+// login checks the credentials of AuthUser and returns the user they belong
+// to, registering it in auto mode. Otherwise an unknown username fails like a
+// wrong password, with the same error and after a password check of the same
+// cost, so usernames cannot be enumerated.
+func (s *ShopService) login(ctx context.Context, request *dto.AuthRequest) (*models.User, error) {
 	user, err := s.repo.GetUser(ctx, request.Username)
 	if err != nil && errors.Is(err, repository.ErrUserNotFound) {
-		user, err = s.CreateUser(ctx, request)
-		if err != nil {
-			return nil, err
+		if s.cfg.registrationMode() != RegistrationAuto {
+			s.verifyDummyPassword(request.Password)
+			return nil, ErrInvalidCredentials
 		}
 
-		token, err := s.auth.GenerateToken(user)
-		if err != nil {
+		if err := ValidateNewCredentials(request, s.policy); err != nil {
 			return nil, err
 		}
-		return &dto.AuthResponse{Token: token}, nil
+
+		return s.CreateUser(ctx, request)
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
+	ok, needsRehash, err := s.hasher.Verify(request.Password, user.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password+s.cfg.Salt)); err != nil {
-		return nil, ErrInvalidPasswd
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	if needsRehash {
+		s.rehashPassword(ctx, user, request.Password)
+	}
+
+	return user, nil
+}
+
+func (s *ShopService) verifyDummyPassword(password string) {
+	const op = "internal.avito_shop.controller.ShopService.verifyDummyPassword"
+
+	hash, err := s.dummyHash()
+	if err == nil {
+		_, _, err = s.hasher.Verify(password, hash)
+	}
+
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"event": op}).Warn(err)
+	}
+}
+
+// loginFailed settles a login attempt as a failure. An error only leaves the
+// reservation of CheckLogin in place, so it is logged rather than returned.
+func (s *ShopService) loginFailed(ctx context.Context, username, ip string) {
+	const op = "internal.avito_shop.controller.ShopService.loginFailed"
+
+	if err := s.auth.LoginFailed(ctx, username, ip); err != nil {
+		logrus.WithFields(logrus.Fields{"event": op, "username": username}).Warn(err)
+	}
+}
+
+// Register creates an account explicitly and logs the new user in. In invite
+// mode the invite code is redeemed in the same transaction as the signup.
+func (s *ShopService) Register(ctx context.Context, request *dto.RegisterRequest) (*dto.AuthResponse, error) {
+	mode := s.cfg.registrationMode()
+	if err := ValidateRegister(request, mode, s.policy); err != nil {
+		return nil, err
 	}
 
-	token, err := s.auth.GenerateToken(user)
+	passwordHash, err := s.generatePasswordHash(request.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	return &dto.AuthResponse{Token: token}, nil
+	var id int
+	if mode == RegistrationInvite {
+		id, err = s.repo.CreateInvitedUser(ctx, request.Username, passwordHash, request.InviteCode)
+	} else {
+		id, err = s.repo.CreateUser(ctx, request.Username, passwordHash)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.CreateSession(ctx, &models.User{Id: id, Username: request.Username, Role: models.RoleUser})
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuthResponse(tokens), nil
+}
+
+func (s *ShopService) CreateInvite(ctx context.Context, createdBy int) (*dto.InviteResponse, error) {
+	buf := make([]byte, inviteCodeSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	invite := dto.InviteResponse{
+		Code:      base64.RawURLEncoding.EncodeToString(buf),
+		ExpiresAt: time.Now().Add(inviteTTL).UTC(),
+	}
+
+	if err := s.repo.CreateInvite(ctx, invite.Code, createdBy, invite.ExpiresAt); err != nil {
+		return nil, err
+	}
+
+	return &invite, nil
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. The user is
+// reloaded so that role changes take effect on the next refresh.
+func (s *ShopService) RefreshToken(ctx context.Context, request *dto.RefreshRequest) (*dto.AuthResponse, error) {
+	if request.RefreshToken == "" {
+		return nil, auth.ErrInvalidRefreshToken
+	}
+
+	session, err := s.auth.ParseRefreshToken(ctx, request.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUser(ctx, session.Username)
+	if err != nil && errors.Is(err, repository.ErrUserNotFound) {
+		return nil, auth.ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.RotateSession(ctx, session, user)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuthResponse(tokens), nil
+}
+
+func (s *ShopService) Logout(ctx context.Context, sessionId string) error {
+	return s.auth.RevokeSession(ctx, sessionId)
+}
+
+// ChangePassword checks the current password like a login would, including
+// the throttle, and logs the user out of every other session.
+func (s *ShopService) ChangePassword(ctx context.Context, request *dto.ChangePasswordRequest) error {
+	if err := ValidateChangePassword(request, s.policy); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserById(ctx, request.Id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.auth.CheckLogin(ctx, user.Username, request.ClientIp); err != nil {
+		return err
+	}
+
+	ok, _, err := s.hasher.Verify(request.CurrentPassword, user.Password)
+	if err == nil && !ok {
+		err = ErrInvalidPasswd
+	}
+
+	if err != nil {
+		s.loginFailed(ctx, user.Username, request.ClientIp)
+		return err
+	}
+
+	if err := s.auth.LoginSucceeded(ctx, user.Username, request.ClientIp); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.generatePasswordHash(request.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.repo.UpdatePassword(ctx, user.Id, passwordHash); err != nil {
+		return err
+	}
+
+	return s.auth.RevokeUserSessions(ctx, user.Id, request.SessionId)
+}
+
+// CreatePasswordReset issues a one-time token an admin hands to a user who
+// lost their password. Only its hash is stored.
+func (s *ShopService) CreatePasswordReset(ctx context.Context, request *dto.PasswordResetRequest) (*dto.PasswordResetResponse, error) {
+	buf := make([]byte, resetTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	reset := dto.PasswordResetResponse{
+		ResetToken: base64.RawURLEncoding.EncodeToString(buf),
+		ExpiresAt:  time.Now().Add(passwordResetTTL).UTC(),
+	}
+
+	err := s.repo.CreatePasswordReset(ctx, request.Username, hashResetToken(reset.ResetToken), request.CreatedBy, reset.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reset, nil
+}
+
+// ResetPassword redeems a reset token and revokes every session of the user,
+// since whoever held them may be the reason for the reset.
+func (s *ShopService) ResetPassword(ctx context.Context, request *dto.ResetPasswordRequest) error {
+	if err := ValidateResetPassword(request, s.policy); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.generatePasswordHash(request.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	userId, err := s.repo.ResetPassword(ctx, hashResetToken(request.ResetToken), passwordHash)
+	if err != nil {
+		return err
+	}
+
+	return s.auth.RevokeUserSessions(ctx, userId, "")
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newAuthResponse(tokens *auth.Tokens) *dto.AuthResponse {
+	return &dto.AuthResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int(tokens.ExpiresIn.Seconds()),
+	}
 }
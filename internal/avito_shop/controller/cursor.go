@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+)
+
+const cursorSeparator = "|"
+
+func encodeHistoryCursor(entry dto.HistoryEntry) string {
+	raw := strings.Join([]string{
+		entry.CreatedAt.Format(time.RFC3339Nano),
+		entry.Type,
+		strconv.Itoa(entry.Id),
+	}, cursorSeparator)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeHistoryCursor(cursor string) (*dto.HistoryCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), cursorSeparator)
+	if len(parts) != 3 {
+		return nil, ErrInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &dto.HistoryCursor{CreatedAt: createdAt, Type: parts[1], Id: id}, nil
+}
@@ -11,3 +11,71 @@ var ErrInvalidAmount = errors.New("amount must be positive number")
 var ErrShortUsername = errors.New("username is too short")
 
 var ErrEmptyItemName = errors.New("empty item name")
+
+var ErrInvalidQuantity = errors.New("quantity must be positive number not greater than 1000")
+
+var ErrEmptyOrder = errors.New("order has no items")
+
+var ErrTooManyOrderItems = errors.New("order has too many items")
+
+var ErrInvalidSortField = errors.New("sort must be one of: id, price, name")
+
+var ErrInvalidSortOrder = errors.New("order must be one of: asc, desc")
+
+var ErrInvalidPriceRange = errors.New("invalid price range")
+
+var ErrInvalidPrice = errors.New("price must be positive number")
+
+var ErrInvalidItemId = errors.New("invalid item id")
+
+var ErrInvalidStock = errors.New("stock must not be negative")
+
+var ErrInvalidPurchaseLimit = errors.New("purchase limit must be positive number")
+
+var ErrInvalidLimit = errors.New("limit must be between 1 and 100")
+
+var ErrInvalidDirection = errors.New("direction must be one of: sent, received, purchases")
+
+var ErrInvalidDateRange = errors.New("invalid date range")
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+var ErrInvalidIdempotencyKey = errors.New("idempotency key is too long")
+
+var ErrInvalidRole = errors.New("role must be one of: user, admin")
+
+var ErrLongUsername = errors.New("username is too long")
+
+var ErrInviteRequired = errors.New("invite code is required")
+
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+var ErrInvalidRegistrationMode = errors.New("registration mode must be one of: auto, off, invite")
+
+var ErrInvalidPasswordHasher = errors.New("password hasher must be one of: bcrypt, argon2id")
+
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+var ErrCurrentPasswordRequired = errors.New("current password is required")
+
+var ErrSamePassword = errors.New("new password must differ from the current one")
+
+var ErrResetTokenRequired = errors.New("reset token is required")
+
+var ErrLongPassword = errors.New("password is too long")
+
+var ErrUsernameCharacters = errors.New("username contains characters that are not allowed")
+
+var ErrReservedUsername = errors.New("username is reserved")
+
+var ErrCommonPassword = errors.New("password is too common")
+
+var ErrInvalidPolicy = errors.New("invalid username or password policy")
+
+var ErrSelfTransfer = errors.New("cannot send coins to yourself")
+
+var ErrTransferLimit = errors.New("amount exceeds the per-transfer limit")
+
+var ErrInvalidTransferLimits = errors.New("transfer limits must not be negative")
+
+var ErrInvalidStatus = errors.New("status must be one of: active, blocked, disabled")
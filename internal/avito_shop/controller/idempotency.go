@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+)
+
+const (
+	operationBuyItem     = "buyItem"
+	operationCreateOrder = "createOrder"
+	operationSendCoin    = "sendCoin"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// newIdempotencyKey returns nil when the client sent no key, so the request is
+// executed without replay protection.
+func newIdempotencyKey(key, operation string, request any) (*dto.IdempotencyKey, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, ErrInvalidIdempotencyKey
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(payload)
+
+	return &dto.IdempotencyKey{
+		Key:         key,
+		Operation:   operation,
+		RequestHash: hex.EncodeToString(hash[:]),
+	}, nil
+}
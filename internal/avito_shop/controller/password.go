@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms selectable with ServiceConfig.PasswordHasher.
+const (
+	HasherBcrypt   = "bcrypt"
+	HasherArgon2id = "argon2id"
+)
+
+const (
+	DefaultArgon2Memory      = 64 * 1024
+	DefaultArgon2Iterations  = 3
+	DefaultArgon2Parallelism = 2
+	DefaultArgon2SaltLength  = 16
+	DefaultArgon2KeyLength   = 32
+)
+
+// Argon2Config holds the argon2id parameters. Memory is in KiB.
+type Argon2Config struct {
+	Memory      uint32 `mapstructure:"memory"`
+	Iterations  uint32 `mapstructure:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism"`
+	SaltLength  uint32 `mapstructure:"salt_length"`
+	KeyLength   uint32 `mapstructure:"key_length"`
+}
+
+// PasswordHasher produces self-describing hashes: the algorithm and its
+// parameters are encoded in the hash, so Verify can check any stored hash and
+// report when it was made with something other than the current settings.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password, hash string) (ok, needsRehash bool, err error)
+}
+
+// passwordHashers hashes with the configured algorithm and verifies hashes
+// of every known algorithm, flagging the others for a rehash.
+type passwordHashers struct {
+	current string
+	bcrypt  *bcryptHasher
+	argon2  *argon2idHasher
+}
+
+func newPasswordHasher(cfg ServiceConfig) *passwordHashers {
+	current := cfg.PasswordHasher
+	if current == "" {
+		current = HasherBcrypt
+	}
+
+	return &passwordHashers{
+		current: current,
+		bcrypt:  newBcryptHasher(cfg.Salt, cfg.Cost),
+		argon2:  newArgon2idHasher(cfg.Salt, cfg.Argon2),
+	}
+}
+
+func (h *passwordHashers) Hash(password string) (string, error) {
+	if h.current == HasherArgon2id {
+		return h.argon2.Hash(password)
+	}
+
+	return h.bcrypt.Hash(password)
+}
+
+func (h *passwordHashers) Verify(password, hash string) (bool, bool, error) {
+	var (
+		algorithm string
+		hasher    PasswordHasher
+	)
+
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		algorithm, hasher = HasherArgon2id, h.argon2
+	case strings.HasPrefix(hash, "$2"):
+		algorithm, hasher = HasherBcrypt, h.bcrypt
+	default:
+		return false, false, ErrUnknownPasswordHash
+	}
+
+	ok, needsRehash, err := hasher.Verify(password, hash)
+	return ok, ok && (needsRehash || algorithm != h.current), err
+}
+
+// bcryptHasher keeps the original scheme: bcrypt over the password with the
+// global pepper appended.
+type bcryptHasher struct {
+	pepper string
+	cost   int
+}
+
+func newBcryptHasher(pepper string, cost int) *bcryptHasher {
+	if cost < bcrypt.MinCost {
+		cost = bcrypt.DefaultCost
+	}
+
+	return &bcryptHasher{pepper: pepper, cost: cost}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password+h.pepper), h.cost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", ErrLongPassword
+	}
+
+	return string(hash), err
+}
+
+func (h *bcryptHasher) Verify(password, hash string) (bool, bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password+h.pepper))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, cost != h.cost, nil
+}
+
+// argon2idHasher stores hashes in the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>,
+// with a random salt per password on top of the global pepper.
+type argon2idHasher struct {
+	pepper string
+	params Argon2Config
+}
+
+func newArgon2idHasher(pepper string, params Argon2Config) *argon2idHasher {
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2Memory
+	}
+
+	if params.Iterations == 0 {
+		params.Iterations = DefaultArgon2Iterations
+	}
+
+	if params.Parallelism == 0 {
+		params.Parallelism = DefaultArgon2Parallelism
+	}
+
+	if params.SaltLength == 0 {
+		params.SaltLength = DefaultArgon2SaltLength
+	}
+
+	if params.KeyLength == 0 {
+		params.KeyLength = DefaultArgon2KeyLength
+	}
+
+	return &argon2idHasher{pepper: pepper, params: params}
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password+h.pepper), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *argon2idHasher) Verify(password, hash string) (bool, bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password+h.pepper), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false, nil
+	}
+
+	return true, params != h.params, nil
+}
+
+func decodeArgon2id(hash string) (Argon2Config, []byte, []byte, error) {
+	var params Argon2Config
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HasherArgon2id {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
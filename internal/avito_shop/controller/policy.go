@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+)
+
+const (
+	DefaultMinUsernameLength = 4
+	DefaultMaxUsernameLength = 64
+	DefaultMinPasswordLength = 8
+	DefaultMaxPasswordLength = 64
+)
+
+// bcryptMaxBytes is the longest input bcrypt hashes, the pepper included.
+const bcryptMaxBytes = 72
+
+// Character classes allowed in PolicyConfig.UsernameCharacters.
+const (
+	CharsLetter     = "letter"
+	CharsDigit      = "digit"
+	CharsUnderscore = "underscore"
+	CharsHyphen     = "hyphen"
+	CharsDot        = "dot"
+)
+
+var usernameCharClasses = map[string]func(rune) bool{
+	CharsLetter:     unicode.IsLetter,
+	CharsDigit:      unicode.IsDigit,
+	CharsUnderscore: func(r rune) bool { return r == '_' },
+	CharsHyphen:     func(r rune) bool { return r == '-' },
+	CharsDot:        func(r rune) bool { return r == '.' },
+}
+
+// Rule names reported in dto.Violation.
+const (
+	ruleRequired          = "required"
+	ruleMinLength         = "min_length"
+	ruleMaxLength         = "max_length"
+	ruleCharacters        = "characters"
+	ruleReserved          = "reserved"
+	ruleDenylisted        = "denylisted"
+	ruleDifferentPassword = "different"
+	rulePositive          = "positive"
+	ruleOneOf             = "oneof"
+)
+
+// PolicyConfig sets the rules for usernames and passwords. Lengths count
+// runes, zero values fall back to the defaults, and an empty
+// UsernameCharacters list allows any character. Reserved names and the
+// denylist are matched case-insensitively. On top of MaxPasswordLength a new
+// password must fit into bcrypt together with the pepper.
+type PolicyConfig struct {
+	MinUsernameLength    int      `mapstructure:"min_username_length"`
+	MaxUsernameLength    int      `mapstructure:"max_username_length"`
+	UsernameCharacters   []string `mapstructure:"username_characters"`
+	ReservedUsernames    []string `mapstructure:"reserved_usernames"`
+	MinPasswordLength    int      `mapstructure:"min_password_length"`
+	MaxPasswordLength    int      `mapstructure:"max_password_length"`
+	PasswordDenylist     []string `mapstructure:"password_denylist"`
+	PasswordDenylistFile string   `mapstructure:"password_denylist_file"`
+}
+
+// LoadPasswordDenylist appends the passwords listed in PasswordDenylistFile,
+// one per line, to PasswordDenylist. Blank lines and lines starting with #
+// are skipped.
+func (c *PolicyConfig) LoadPasswordDenylist() error {
+	if c.PasswordDenylistFile == "" {
+		return nil
+	}
+
+	file, err := os.Open(c.PasswordDenylistFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		c.PasswordDenylist = append(c.PasswordDenylist, line)
+	}
+
+	return scanner.Err()
+}
+
+func (c PolicyConfig) validate() error {
+	for _, class := range c.UsernameCharacters {
+		if _, ok := usernameCharClasses[class]; !ok {
+			return ErrInvalidPolicy
+		}
+	}
+
+	if c.MaxUsernameLength > 0 && c.MinUsernameLength > c.MaxUsernameLength {
+		return ErrInvalidPolicy
+	}
+
+	if c.MaxPasswordLength > 0 && c.minPasswordLength() > c.MaxPasswordLength {
+		return ErrInvalidPolicy
+	}
+
+	return nil
+}
+
+// minPasswordLength is the minimum the policy enforces.
+func (c PolicyConfig) minPasswordLength() int {
+	if c.MinPasswordLength <= 0 {
+		return DefaultMinPasswordLength
+	}
+
+	return c.MinPasswordLength
+}
+
+// Policy is the compiled form of PolicyConfig.
+type Policy struct {
+	minUsername, maxUsername int
+	minPassword, maxPassword int
+	maxPasswordBytes         int
+	charClasses              []func(rune) bool
+	reserved                 map[string]struct{}
+	denylist                 map[string]struct{}
+}
+
+// NewPolicy compiles cfg. pepper is the secret appended to every password
+// before hashing, its length is taken off the bytes left for the password.
+func NewPolicy(cfg PolicyConfig, pepper string) *Policy {
+	p := &Policy{
+		minUsername:      cfg.MinUsernameLength,
+		maxUsername:      cfg.MaxUsernameLength,
+		minPassword:      cfg.minPasswordLength(),
+		maxPassword:      cfg.MaxPasswordLength,
+		maxPasswordBytes: bcryptMaxBytes - len(pepper),
+		reserved:         lowerSet(cfg.ReservedUsernames),
+		denylist:         lowerSet(cfg.PasswordDenylist),
+	}
+
+	if p.minUsername <= 0 {
+		p.minUsername = DefaultMinUsernameLength
+	}
+
+	if p.maxUsername <= 0 {
+		p.maxUsername = DefaultMaxUsernameLength
+	}
+
+	if p.maxPassword <= 0 {
+		p.maxPassword = DefaultMaxPasswordLength
+	}
+
+	for _, class := range cfg.UsernameCharacters {
+		if isClass, ok := usernameCharClasses[class]; ok {
+			p.charClasses = append(p.charClasses, isClass)
+		}
+	}
+
+	return p
+}
+
+func lowerSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		set[strings.ToLower(v)] = struct{}{}
+	}
+
+	return set
+}
+
+// checkUsernameLength is all a login or a transfer recipient is held to:
+// tightening the character rules must not lock existing accounts out.
+func (p *Policy) checkUsernameLength(v *ValidationError, field, username string) {
+	switch n := utf8.RuneCountInString(username); {
+	case n < p.minUsername:
+		v.add(field, ruleMinLength, ErrShortUsername)
+	case n > p.maxUsername:
+		v.add(field, ruleMaxLength, ErrLongUsername)
+	}
+}
+
+func (p *Policy) checkPasswordLength(v *ValidationError, field, password string) {
+	switch n := utf8.RuneCountInString(password); {
+	case n < p.minPassword:
+		v.add(field, ruleMinLength, ErrShortPassword)
+	case n > p.maxPassword:
+		v.add(field, ruleMaxLength, ErrLongPassword)
+	}
+}
+
+// checkNewUsername applies every username rule; it runs when an account is
+// created.
+func (p *Policy) checkNewUsername(v *ValidationError, field, username string) {
+	p.checkUsernameLength(v, field, username)
+
+	if len(p.charClasses) > 0 && strings.IndexFunc(username, p.disallowedRune) >= 0 {
+		v.add(field, ruleCharacters, ErrUsernameCharacters)
+	}
+
+	if _, ok := p.reserved[strings.ToLower(username)]; ok {
+		v.add(field, ruleReserved, ErrReservedUsername)
+	}
+}
+
+// checkNewPassword applies every password rule; it runs whenever a password
+// is set. The byte limit is left out of logins so that passwords hashed with
+// argon2id before it existed can still be checked.
+func (p *Policy) checkNewPassword(v *ValidationError, field, password string) {
+	p.checkPasswordLength(v, field, password)
+
+	if utf8.RuneCountInString(password) <= p.maxPassword && len(password) > p.maxPasswordBytes {
+		v.add(field, ruleMaxLength, ErrLongPassword)
+	}
+
+	if _, ok := p.denylist[strings.ToLower(password)]; ok {
+		v.add(field, ruleDenylisted, ErrCommonPassword)
+	}
+}
+
+func (p *Policy) disallowedRune(r rune) bool {
+	for _, isClass := range p.charClasses {
+		if isClass(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidationError lists every rule a request broke. errors.Is matches the
+// sentinel of each violation, so callers can still test for ErrShortPassword
+// and friends.
+type ValidationError struct {
+	Violations []dto.Violation
+	errs       []error
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, violation := range e.Violations {
+		messages = append(messages, violation.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.errs
+}
+
+func (e *ValidationError) add(field, rule string, err error) {
+	e.Violations = append(e.Violations, dto.Violation{Field: field, Rule: rule, Message: err.Error()})
+	e.errs = append(e.errs, err)
+}
+
+// err returns nil when nothing was violated, so that a nil *ValidationError
+// never ends up in an error interface.
+func (e *ValidationError) err() error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+
+	return e
+}
@@ -2,30 +2,94 @@ package controller
 
 import (
 	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
 )
 
-func ValidateAuth(request *dto.AuthRequest) error {
-	if len(request.Username) < 4 {
-		return ErrShortUsername
+// ValidateAuth checks a login attempt against the length rules only, so that
+// a stricter policy does not lock out accounts created under an older one.
+func ValidateAuth(request *dto.AuthRequest, policy *Policy) error {
+	var v ValidationError
+	policy.checkUsernameLength(&v, "username", request.Username)
+	policy.checkPasswordLength(&v, "password", request.Password)
+
+	return v.err()
+}
+
+// ValidateNewCredentials applies the full policy to an account that is about
+// to be created.
+func ValidateNewCredentials(request *dto.AuthRequest, policy *Policy) error {
+	var v ValidationError
+	policy.checkNewUsername(&v, "username", request.Username)
+	policy.checkNewPassword(&v, "password", request.Password)
+
+	return v.err()
+}
+
+// ValidateChangePassword holds the new password to the policy and refuses to
+// "change" it to the current one.
+func ValidateChangePassword(request *dto.ChangePasswordRequest, policy *Policy) error {
+	var v ValidationError
+	if request.CurrentPassword == "" {
+		v.add("currentPassword", ruleRequired, ErrCurrentPasswordRequired)
+	}
+
+	policy.checkNewPassword(&v, "newPassword", request.NewPassword)
+
+	if request.NewPassword != "" && request.NewPassword == request.CurrentPassword {
+		v.add("newPassword", ruleDifferentPassword, ErrSamePassword)
 	}
 
-	if len(request.Password) < 8 {
-		return ErrShortPassword
+	return v.err()
+}
+
+func ValidateResetPassword(request *dto.ResetPasswordRequest, policy *Policy) error {
+	var v ValidationError
+	if request.ResetToken == "" {
+		v.add("resetToken", ruleRequired, ErrResetTokenRequired)
 	}
 
-	return nil
+	policy.checkNewPassword(&v, "newPassword", request.NewPassword)
+
+	return v.err()
 }
 
-func ValidateSendCoin(request *dto.SendCoinRequest) error {
-	if len(request.ToUser) < 4 {
-		return ErrShortUsername
+// ValidateRegister applies the full policy to the new account. The invite
+// code is checked here only for presence.
+func ValidateRegister(request *dto.RegisterRequest, mode string, policy *Policy) error {
+	var v ValidationError
+	policy.checkNewUsername(&v, "username", request.Username)
+	policy.checkNewPassword(&v, "password", request.Password)
+
+	if mode == RegistrationInvite && request.InviteCode == "" {
+		v.add("inviteCode", ruleRequired, ErrInviteRequired)
 	}
 
+	return v.err()
+}
+
+func ValidateSendCoin(request *dto.SendCoinRequest, policy *Policy) error {
+	var v ValidationError
+	policy.checkUsernameLength(&v, "toUser", request.ToUser)
+
 	if request.Amount <= 0 {
-		return ErrInvalidAmount
+		v.add("amount", rulePositive, ErrInvalidAmount)
 	}
 
-	return nil
+	return v.err()
+}
+
+const (
+	maxItemQuantity = 1000
+	maxOrderItems   = 50
+
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+var historyDirectionTypes = map[string]string{
+	dto.DirectionSent:      dto.HistoryTypeSent,
+	dto.DirectionReceived:  dto.HistoryTypeReceived,
+	dto.DirectionPurchases: dto.HistoryTypePurchase,
 }
 
 func ValidateBuyItem(request *dto.BuyItemRequest) error {
@@ -33,5 +97,185 @@ func ValidateBuyItem(request *dto.BuyItemRequest) error {
 		return ErrEmptyItemName
 	}
 
+	if request.Quantity == 0 {
+		request.Quantity = 1
+	}
+
+	if request.Quantity < 0 || request.Quantity > maxItemQuantity {
+		return ErrInvalidQuantity
+	}
+
+	return nil
+}
+
+func ValidateOrder(request *dto.OrderRequest) error {
+	if len(request.Items) == 0 {
+		return ErrEmptyOrder
+	}
+
+	if len(request.Items) > maxOrderItems {
+		return ErrTooManyOrderItems
+	}
+
+	for _, item := range request.Items {
+		if item.Item == "" {
+			return ErrEmptyItemName
+		}
+
+		if item.Quantity <= 0 || item.Quantity > maxItemQuantity {
+			return ErrInvalidQuantity
+		}
+	}
+
+	return nil
+}
+
+func ValidateGetItems(request *dto.ItemsRequest) error {
+	switch request.SortBy {
+	case "":
+		request.SortBy = dto.SortById
+	case dto.SortById, dto.SortByPrice, dto.SortByName:
+	default:
+		return ErrInvalidSortField
+	}
+
+	switch request.Order {
+	case "":
+		request.Order = dto.OrderAsc
+	case dto.OrderAsc, dto.OrderDesc:
+	default:
+		return ErrInvalidSortOrder
+	}
+
+	if request.MinPrice < 0 || request.MaxPrice < 0 {
+		return ErrInvalidPriceRange
+	}
+
+	if request.MaxPrice > 0 && request.MinPrice > request.MaxPrice {
+		return ErrInvalidPriceRange
+	}
+
+	return nil
+}
+
+func ValidateCreateItem(request *dto.CreateItemRequest) error {
+	if request.Name == "" {
+		return ErrEmptyItemName
+	}
+
+	if request.Price <= 0 {
+		return ErrInvalidPrice
+	}
+
+	return validateItemLimits(request.Stock, request.MaxPerUser)
+}
+
+func ValidateUpdateItem(request *dto.UpdateItemRequest) error {
+	if request.Id <= 0 {
+		return ErrInvalidItemId
+	}
+
+	if request.Price <= 0 {
+		return ErrInvalidPrice
+	}
+
 	return nil
 }
+
+func ValidateSetItemLimits(request *dto.SetItemLimitsRequest) error {
+	if request.Id <= 0 {
+		return ErrInvalidItemId
+	}
+
+	return validateItemLimits(request.Stock, request.MaxPerUser)
+}
+
+func validateItemLimits(stock, maxPerUser *int) error {
+	if stock != nil && *stock < 0 {
+		return ErrInvalidStock
+	}
+
+	if maxPerUser != nil && *maxPerUser <= 0 {
+		return ErrInvalidPurchaseLimit
+	}
+
+	return nil
+}
+
+func ValidateSetRole(request *dto.SetRoleRequest, policy *Policy) error {
+	var v ValidationError
+	policy.checkUsernameLength(&v, "username", request.Username)
+
+	if request.Role != models.RoleUser && request.Role != models.RoleAdmin {
+		v.add("role", ruleOneOf, ErrInvalidRole)
+	}
+
+	return v.err()
+}
+
+func ValidateSetStatus(request *dto.SetStatusRequest, policy *Policy) error {
+	var v ValidationError
+	policy.checkUsernameLength(&v, "username", request.Username)
+
+	switch request.Status {
+	case models.UserStatusActive, models.UserStatusBlocked, models.UserStatusDisabled:
+	default:
+		v.add("status", ruleOneOf, ErrInvalidStatus)
+	}
+
+	return v.err()
+}
+
+func ValidateInfo(request *dto.InfoRequest) error {
+	if request.Limit < 0 || request.Limit > maxHistoryLimit {
+		return ErrInvalidLimit
+	}
+
+	return nil
+}
+
+func ValidateHistory(request *dto.HistoryRequest) (*dto.HistoryFilter, error) {
+	filter := &dto.HistoryFilter{
+		UserId:       request.Id,
+		Counterparty: request.Counterparty,
+		Limit:        request.Limit,
+	}
+
+	if request.Direction != "" {
+		historyType, ok := historyDirectionTypes[request.Direction]
+		if !ok {
+			return nil, ErrInvalidDirection
+		}
+		filter.Type = historyType
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = defaultHistoryLimit
+	}
+
+	if filter.Limit < 0 || filter.Limit > maxHistoryLimit {
+		return nil, ErrInvalidLimit
+	}
+
+	if !request.From.IsZero() {
+		filter.From = &request.From
+	}
+
+	if !request.To.IsZero() {
+		filter.To = &request.To
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return nil, ErrInvalidDateRange
+	}
+
+	if request.Cursor != "" {
+		cursor, err := decodeHistoryCursor(request.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = cursor
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,24 @@
+package dto
+
+type CreateItemRequest struct {
+	Name       string `json:"name"`
+	Price      int    `json:"price"`
+	Stock      *int   `json:"stock"`
+	MaxPerUser *int   `json:"maxPerUser"`
+}
+
+type UpdateItemRequest struct {
+	Id    int `param:"id"`
+	Price int `json:"price"`
+}
+
+// SetItemLimitsRequest replaces both limits; a null value removes the limit.
+type SetItemLimitsRequest struct {
+	Id         int  `param:"id"`
+	Stock      *int `json:"stock"`
+	MaxPerUser *int `json:"maxPerUser"`
+}
+
+type RetireItemRequest struct {
+	Id int `param:"id"`
+}
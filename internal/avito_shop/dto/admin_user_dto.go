@@ -0,0 +1,11 @@
+package dto
+
+type SetRoleRequest struct {
+	Username string `param:"username"`
+	Role     string `json:"role"`
+}
+
+type SetStatusRequest struct {
+	Username string `param:"username"`
+	Status   string `json:"status"`
+}
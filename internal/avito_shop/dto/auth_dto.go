@@ -3,8 +3,16 @@ package dto
 type AuthRequest struct {
 	Username string `json:"username" db:"username"`
 	Password string `json:"password" db:"password_salt"`
+	// ClientIp is filled in by the handler for login throttling.
+	ClientIp string `json:"-" db:"-"`
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
 }
@@ -1,6 +1,9 @@
 package dto
 
 type BuyItemRequest struct {
-	Id   int    `json:"id"`
-	Item string `query:"item"`
+	Id       int    `json:"id"`
+	Item     string `query:"item"`
+	Quantity int    `query:"quantity"`
+
+	IdempotencyKey string `json:"-"`
 }
@@ -1,13 +1,30 @@
 package dto
 
-type BadRequestResponse struct {
-	Errors string `json:"errors"`
+// ErrorResponse is the body of every failed request. Code comes from the
+// error catalog and is what clients should match on; Errors is a human
+// readable message in the language negotiated with Accept-Language.
+type ErrorResponse struct {
+	Errors     string      `json:"errors"`
+	Code       string      `json:"code"`
+	Violations []Violation `json:"violations,omitempty"`
 }
 
-type UnauthorizedResponse struct {
-	Errors string `json:"errors"`
+// ProblemDetails is the RFC 7807 form of ErrorResponse, sent to clients that
+// accept application/problem+json.
+type ProblemDetails struct {
+	Type       string      `json:"type"`
+	Title      string      `json:"title"`
+	Status     int         `json:"status"`
+	Detail     string      `json:"detail"`
+	Instance   string      `json:"instance,omitempty"`
+	Code       string      `json:"code"`
+	Violations []Violation `json:"violations,omitempty"`
 }
 
-type InternalServerErrorResponse struct {
-	Errors string `json:"errors"`
+// Violation is one broken validation rule of a request field.
+type Violation struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
 }
@@ -0,0 +1,71 @@
+package dto
+
+// Error codes returned in ErrorResponse.Code. They are part of the API:
+// once published a code keeps its meaning, messages may change.
+const (
+	CodeInternalError    = "INTERNAL_ERROR"
+	CodeInvalidRequest   = "INVALID_REQUEST_BODY"
+	CodeValidationFailed = "VALIDATION_FAILED"
+
+	CodeTokenMissing        = "TOKEN_MISSING"
+	CodeInvalidAuthHeader   = "INVALID_AUTH_HEADER"
+	CodeTokenExpired        = "TOKEN_EXPIRED"
+	CodeTokenNotValidYet    = "TOKEN_NOT_VALID_YET"
+	CodeMalformedToken      = "MALFORMED_TOKEN"
+	CodeInvalidSignature    = "INVALID_SIGNATURE"
+	CodeInvalidToken        = "INVALID_TOKEN"
+	CodeSessionRevoked      = "SESSION_REVOKED"
+	CodeInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	CodeForbidden           = "FORBIDDEN"
+
+	CodeInvalidCredentials     = "INVALID_CREDENTIALS"
+	CodeTooManyLoginAttempts   = "TOO_MANY_LOGIN_ATTEMPTS"
+	CodeUserAlreadyExists      = "USER_ALREADY_EXISTS"
+	CodeUserNotFound           = "USER_NOT_FOUND"
+	CodeInviteRequired         = "INVITE_REQUIRED"
+	CodeInvalidInvite          = "INVALID_INVITE"
+	CodeUsernameTooShort       = "USERNAME_TOO_SHORT"
+	CodeUsernameTooLong        = "USERNAME_TOO_LONG"
+	CodeUsernameCharacters     = "USERNAME_INVALID_CHARACTERS"
+	CodeUsernameReserved       = "USERNAME_RESERVED"
+	CodePasswordTooShort       = "PASSWORD_TOO_SHORT"
+	CodePasswordTooLong        = "PASSWORD_TOO_LONG"
+	CodePasswordTooCommon      = "PASSWORD_TOO_COMMON"
+	CodePasswordUnchanged      = "PASSWORD_UNCHANGED"
+	CodeCurrentPasswordMissing = "CURRENT_PASSWORD_REQUIRED"
+	CodeResetTokenRequired     = "RESET_TOKEN_REQUIRED"
+	CodeInvalidResetToken      = "INVALID_RESET_TOKEN"
+	CodeInvalidRole            = "INVALID_ROLE"
+	CodeInvalidStatus          = "INVALID_STATUS"
+
+	CodeInsufficientFunds     = "INSUFFICIENT_FUNDS"
+	CodeInvalidAmount         = "INVALID_AMOUNT"
+	CodeRecipientNotFound     = "RECIPIENT_NOT_FOUND"
+	CodeSelfTransfer          = "SELF_TRANSFER"
+	CodeRecipientBlocked      = "RECIPIENT_BLOCKED"
+	CodeRecipientDisabled     = "RECIPIENT_DISABLED"
+	CodeTransferLimitExceeded = "TRANSFER_LIMIT_EXCEEDED"
+	CodeDailyLimitExceeded    = "DAILY_TRANSFER_LIMIT_EXCEEDED"
+	CodeItemNotFound          = "ITEM_NOT_FOUND"
+	CodeItemAlreadyExists     = "ITEM_ALREADY_EXISTS"
+	CodeOutOfStock            = "OUT_OF_STOCK"
+	CodePurchaseLimitReached  = "PURCHASE_LIMIT_REACHED"
+	CodeItemNameRequired      = "ITEM_NAME_REQUIRED"
+	CodeInvalidQuantity       = "INVALID_QUANTITY"
+	CodeOrderEmpty            = "ORDER_EMPTY"
+	CodeOrderTooLarge         = "ORDER_TOO_LARGE"
+	CodeInvalidPrice          = "INVALID_PRICE"
+	CodeInvalidItemId         = "INVALID_ITEM_ID"
+	CodeInvalidStock          = "INVALID_STOCK"
+	CodeInvalidPurchaseLimit  = "INVALID_PURCHASE_LIMIT"
+	CodeInvalidIdempotencyKey = "INVALID_IDEMPOTENCY_KEY"
+	CodeIdempotencyKeyReused  = "IDEMPOTENCY_KEY_REUSED"
+
+	CodeInvalidSortField  = "INVALID_SORT_FIELD"
+	CodeInvalidSortOrder  = "INVALID_SORT_ORDER"
+	CodeInvalidPriceRange = "INVALID_PRICE_RANGE"
+	CodeInvalidLimit      = "INVALID_LIMIT"
+	CodeInvalidDirection  = "INVALID_DIRECTION"
+	CodeInvalidDateRange  = "INVALID_DATE_RANGE"
+	CodeInvalidCursor     = "INVALID_CURSOR"
+)
@@ -0,0 +1,58 @@
+package dto
+
+import "time"
+
+const (
+	DirectionSent      = "sent"
+	DirectionReceived  = "received"
+	DirectionPurchases = "purchases"
+
+	HistoryTypeSent     = "sent"
+	HistoryTypeReceived = "received"
+	HistoryTypePurchase = "purchase"
+)
+
+type HistoryRequest struct {
+	Id           int       `json:"-"`
+	Direction    string    `query:"direction"`
+	Counterparty string    `query:"counterparty"`
+	From         time.Time `query:"from"`
+	To           time.Time `query:"to"`
+	Limit        int       `query:"limit"`
+	Cursor       string    `query:"cursor"`
+}
+
+type HistoryResponse struct {
+	Entries    []HistoryEntry `json:"entries"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+type HistoryEntry struct {
+	Id           int       `json:"id" db:"id"`
+	Type         string    `json:"type" db:"type"`
+	Counterparty string    `json:"counterparty,omitempty" db:"counterparty"`
+	Item         string    `json:"item,omitempty" db:"item"`
+	Quantity     int       `json:"quantity,omitempty" db:"quantity"`
+	Amount       int       `json:"amount" db:"amount"`
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+}
+
+// HistoryFilter is the validated form of HistoryRequest passed to the repository.
+// Nil From, To and After leave the corresponding bound open.
+type HistoryFilter struct {
+	UserId       int
+	Type         string
+	Counterparty string
+	From         *time.Time
+	To           *time.Time
+	After        *HistoryCursor
+	Limit        int
+}
+
+// HistoryCursor points at the last entry of a page; entries are ordered by
+// (CreatedAt, Type, Id) descending.
+type HistoryCursor struct {
+	CreatedAt time.Time
+	Type      string
+	Id        int
+}
@@ -0,0 +1,9 @@
+package dto
+
+// IdempotencyKey identifies a client retry of a money-moving request.
+// RequestHash guards against reusing the same key for a different request.
+type IdempotencyKey struct {
+	Key         string
+	Operation   string
+	RequestHash string
+}
@@ -1,9 +1,18 @@
 package dto
 
+import "time"
+
+type InfoRequest struct {
+	Id        int  `json:"-"`
+	Limit     int  `query:"limit"`
+	Aggregate bool `query:"aggregate"`
+}
+
 type InfoResponse struct {
 	Coins       int         `json:"coins"`
 	Inventory   []Inventory `json:"inventory"`
 	CoinHistory CoinHistory `json:"coinHistory"`
+	CoinTotals  *CoinTotals `json:"coinTotals,omitempty"`
 }
 
 type Inventory struct {
@@ -12,16 +21,40 @@ type Inventory struct {
 }
 
 type CoinHistory struct {
-	Received []Received `json:"received"`
-	Sent     []Sent     `json:"sent"`
+	Received  []Received `json:"received"`
+	Sent      []Sent     `json:"sent"`
+	Purchases []Purchase `json:"purchases"`
 }
 
 type Received struct {
-	FromUser string `json:"fromUser" db:"from_user"`
-	Amount   int    `json:"amount" db:"amount"`
+	Id        int       `json:"id" db:"id"`
+	FromUser  string    `json:"fromUser" db:"from_user"`
+	Amount    int       `json:"amount" db:"amount"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 }
 
 type Sent struct {
-	ToUser string `json:"toUser" db:"to_user"`
+	Id        int       `json:"id" db:"id"`
+	ToUser    string    `json:"toUser" db:"to_user"`
+	Amount    int       `json:"amount" db:"amount"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type Purchase struct {
+	Id        int       `json:"id" db:"id"`
+	Item      string    `json:"item" db:"item"`
+	Quantity  int       `json:"quantity" db:"quantity"`
+	Amount    int       `json:"amount" db:"amount"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+type CoinTotals struct {
+	Received []CounterpartyTotal `json:"received"`
+	Sent     []CounterpartyTotal `json:"sent"`
+}
+
+type CounterpartyTotal struct {
+	User   string `json:"user" db:"username"`
 	Amount int    `json:"amount" db:"amount"`
+	Count  int    `json:"count" db:"count"`
 }
@@ -0,0 +1,30 @@
+package dto
+
+const (
+	SortById    = "id"
+	SortByPrice = "price"
+	SortByName  = "name"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+type ItemsRequest struct {
+	SortBy   string `query:"sort"`
+	Order    string `query:"order"`
+	MinPrice int    `query:"min_price"`
+	MaxPrice int    `query:"max_price"`
+}
+
+type ItemsResponse struct {
+	Items []Item `json:"items"`
+}
+
+type Item struct {
+	Id         int    `json:"id" db:"id"`
+	Name       string `json:"name" db:"name"`
+	Price      int    `json:"price" db:"price"`
+	Stock      *int   `json:"stock" db:"stock"`
+	MaxPerUser *int   `json:"maxPerUser" db:"max_per_user"`
+	Available  bool   `json:"available" db:"available"`
+}
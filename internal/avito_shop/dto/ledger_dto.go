@@ -0,0 +1,14 @@
+package dto
+
+type LedgerReport struct {
+	Balanced            bool                 `json:"balanced"`
+	UnbalancedTransfers []int                `json:"unbalancedTransfers"`
+	Discrepancies       []BalanceDiscrepancy `json:"discrepancies"`
+}
+
+type BalanceDiscrepancy struct {
+	UserId   int    `json:"userId" db:"user_id"`
+	Username string `json:"username" db:"username"`
+	Cached   int    `json:"cached" db:"cached"`
+	Ledger   int    `json:"ledger" db:"ledger"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+type OrderRequest struct {
+	Id             int         `json:"-"`
+	Items          []OrderItem `json:"items"`
+	IdempotencyKey string      `json:"-"`
+}
+
+type OrderResponse struct {
+	Purchases []Purchase `json:"purchases"`
+	Total     int        `json:"total"`
+	Replayed  bool       `json:"-"`
+}
+
+type OrderItem struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
@@ -0,0 +1,26 @@
+package dto
+
+import "time"
+
+type ChangePasswordRequest struct {
+	Id              int    `json:"-"`
+	SessionId       string `json:"-"`
+	ClientIp        string `json:"-"`
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type PasswordResetRequest struct {
+	Username  string `param:"username"`
+	CreatedBy int    `json:"-"`
+}
+
+type PasswordResetResponse struct {
+	ResetToken string    `json:"resetToken"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+type ResetPasswordRequest struct {
+	ResetToken  string `json:"resetToken"`
+	NewPassword string `json:"newPassword"`
+}
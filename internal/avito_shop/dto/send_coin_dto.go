@@ -1,6 +1,17 @@
 package dto
 
+import "time"
+
 type SendCoinRequest struct {
-	ToUser string `json:"toUser"`
-	Amount int    `json:"amount"`
+	ToUser         string `json:"toUser"`
+	Amount         int    `json:"amount"`
+	IdempotencyKey string `json:"-"`
+}
+
+type SendCoinResponse struct {
+	Id        int       `json:"id" db:"id"`
+	ToUser    string    `json:"toUser" db:"to_user"`
+	Amount    int       `json:"amount" db:"amount"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	Replayed  bool      `json:"-"`
 }
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HandlerConfig configures the HTTP server. TrustedProxies lists the address
+// ranges (CIDR) of the reverse proxies in front of the service: only their
+// X-Forwarded-For header is believed. Without any, the client address is the
+// peer of the connection, so a client cannot pick its own address and dodge
+// the per-IP login throttle.
+type HandlerConfig struct {
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// Validate checks that every trusted proxy is a CIDR range.
+func (c HandlerConfig) Validate() error {
+	for _, cidr := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("%w %q", ErrInvalidTrustedProxy, cidr)
+		}
+	}
+
+	return nil
+}
+
+func (c HandlerConfig) ipExtractor() echo.IPExtractor {
+	if len(c.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range c.TrustedProxies {
+		// Ranges Validate rejects are skipped.
+		if _, ipRange, err := net.ParseCIDR(cidr); err == nil {
+			options = append(options, echo.TrustIPRange(ipRange))
+		}
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/controller"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	acceptLanguageHeader  = "Accept-Language"
+	contentLanguageHeader = "Content-Language"
+	mimeProblemJSON       = "application/problem+json"
+	problemTypePrefix     = "urn:avito_shop:error:"
+)
+
+type errorSpec struct {
+	err    error
+	status int
+	code   string
+}
+
+// errorCatalog is the single place where errors turn into HTTP statuses and
+// API codes. Anything missing here is answered with a 500 and logged.
+var errorCatalog = []errorSpec{
+	{ErrInternalServer, http.StatusInternalServerError, dto.CodeInternalError},
+	{ErrInvalidDataType, http.StatusBadRequest, dto.CodeInvalidRequest},
+
+	{ErrEmptyToken, http.StatusUnauthorized, dto.CodeTokenMissing},
+	{ErrInvalidAuthHeader, http.StatusUnauthorized, dto.CodeInvalidAuthHeader},
+	{ErrInvalidToken, http.StatusUnauthorized, dto.CodeInvalidToken},
+	{auth.ErrTokenExpired, http.StatusUnauthorized, dto.CodeTokenExpired},
+	{auth.ErrTokenNotValidYet, http.StatusUnauthorized, dto.CodeTokenNotValidYet},
+	{auth.ErrMalformedToken, http.StatusUnauthorized, dto.CodeMalformedToken},
+	{auth.ErrInvalidSignature, http.StatusUnauthorized, dto.CodeInvalidSignature},
+	{auth.ErrInvalidSignMethod, http.StatusUnauthorized, dto.CodeInvalidSignature},
+	{auth.ErrUnknownKeyId, http.StatusUnauthorized, dto.CodeInvalidSignature},
+	{auth.ErrKeyRetired, http.StatusUnauthorized, dto.CodeInvalidSignature},
+	{auth.ErrSessionRevoked, http.StatusUnauthorized, dto.CodeSessionRevoked},
+	{auth.ErrInvalidRefreshToken, http.StatusUnauthorized, dto.CodeInvalidRefreshToken},
+	{ErrForbidden, http.StatusForbidden, dto.CodeForbidden},
+
+	{controller.ErrInvalidPasswd, http.StatusBadRequest, dto.CodeInvalidCredentials},
+	{controller.ErrInvalidCredentials, http.StatusBadRequest, dto.CodeInvalidCredentials},
+	{auth.ErrTooManyLoginAttempts, http.StatusTooManyRequests, dto.CodeTooManyLoginAttempts},
+	{repository.ErrUserAlreadyExists, http.StatusConflict, dto.CodeUserAlreadyExists},
+	{repository.ErrUserNotFound, http.StatusNotFound, dto.CodeUserNotFound},
+	{controller.ErrInviteRequired, http.StatusBadRequest, dto.CodeInviteRequired},
+	{repository.ErrInvalidInvite, http.StatusBadRequest, dto.CodeInvalidInvite},
+	{controller.ErrShortUsername, http.StatusBadRequest, dto.CodeUsernameTooShort},
+	{controller.ErrLongUsername, http.StatusBadRequest, dto.CodeUsernameTooLong},
+	{controller.ErrUsernameCharacters, http.StatusBadRequest, dto.CodeUsernameCharacters},
+	{controller.ErrReservedUsername, http.StatusBadRequest, dto.CodeUsernameReserved},
+	{controller.ErrShortPassword, http.StatusBadRequest, dto.CodePasswordTooShort},
+	{controller.ErrLongPassword, http.StatusBadRequest, dto.CodePasswordTooLong},
+	{controller.ErrCommonPassword, http.StatusBadRequest, dto.CodePasswordTooCommon},
+	{controller.ErrSamePassword, http.StatusBadRequest, dto.CodePasswordUnchanged},
+	{controller.ErrCurrentPasswordRequired, http.StatusBadRequest, dto.CodeCurrentPasswordMissing},
+	{controller.ErrResetTokenRequired, http.StatusBadRequest, dto.CodeResetTokenRequired},
+	{repository.ErrInvalidResetToken, http.StatusBadRequest, dto.CodeInvalidResetToken},
+	{controller.ErrInvalidRole, http.StatusBadRequest, dto.CodeInvalidRole},
+	{controller.ErrInvalidStatus, http.StatusBadRequest, dto.CodeInvalidStatus},
+
+	{repository.ErrNotEnoughCoins, http.StatusBadRequest, dto.CodeInsufficientFunds},
+	{controller.ErrInvalidAmount, http.StatusBadRequest, dto.CodeInvalidAmount},
+	{repository.ErrUserToNotFound, http.StatusBadRequest, dto.CodeRecipientNotFound},
+	{controller.ErrSelfTransfer, http.StatusBadRequest, dto.CodeSelfTransfer},
+	{repository.ErrRecipientBlocked, http.StatusUnprocessableEntity, dto.CodeRecipientBlocked},
+	{repository.ErrRecipientDisabled, http.StatusUnprocessableEntity, dto.CodeRecipientDisabled},
+	{controller.ErrTransferLimit, http.StatusUnprocessableEntity, dto.CodeTransferLimitExceeded},
+	{repository.ErrDailyTransferLimit, http.StatusUnprocessableEntity, dto.CodeDailyLimitExceeded},
+	{repository.ErrItemNotFound, http.StatusNotFound, dto.CodeItemNotFound},
+	{repository.ErrItemAlreadyExists, http.StatusConflict, dto.CodeItemAlreadyExists},
+	{repository.ErrOutOfStock, http.StatusBadRequest, dto.CodeOutOfStock},
+	{repository.ErrPurchaseLimitReached, http.StatusBadRequest, dto.CodePurchaseLimitReached},
+	{controller.ErrEmptyItemName, http.StatusBadRequest, dto.CodeItemNameRequired},
+	{controller.ErrInvalidQuantity, http.StatusBadRequest, dto.CodeInvalidQuantity},
+	{controller.ErrEmptyOrder, http.StatusBadRequest, dto.CodeOrderEmpty},
+	{controller.ErrTooManyOrderItems, http.StatusBadRequest, dto.CodeOrderTooLarge},
+	{controller.ErrInvalidPrice, http.StatusBadRequest, dto.CodeInvalidPrice},
+	{controller.ErrInvalidItemId, http.StatusBadRequest, dto.CodeInvalidItemId},
+	{controller.ErrInvalidStock, http.StatusBadRequest, dto.CodeInvalidStock},
+	{controller.ErrInvalidPurchaseLimit, http.StatusBadRequest, dto.CodeInvalidPurchaseLimit},
+	{controller.ErrInvalidIdempotencyKey, http.StatusBadRequest, dto.CodeInvalidIdempotencyKey},
+	{repository.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, dto.CodeIdempotencyKeyReused},
+
+	{controller.ErrInvalidSortField, http.StatusBadRequest, dto.CodeInvalidSortField},
+	{controller.ErrInvalidSortOrder, http.StatusBadRequest, dto.CodeInvalidSortOrder},
+	{controller.ErrInvalidPriceRange, http.StatusBadRequest, dto.CodeInvalidPriceRange},
+	{controller.ErrInvalidLimit, http.StatusBadRequest, dto.CodeInvalidLimit},
+	{controller.ErrInvalidDirection, http.StatusBadRequest, dto.CodeInvalidDirection},
+	{controller.ErrInvalidDateRange, http.StatusBadRequest, dto.CodeInvalidDateRange},
+	{controller.ErrInvalidCursor, http.StatusBadRequest, dto.CodeInvalidCursor},
+}
+
+func lookupError(err error) (errorSpec, bool) {
+	for _, spec := range errorCatalog {
+		if errors.Is(err, spec.err) {
+			return spec, true
+		}
+	}
+
+	return errorSpec{}, false
+}
+
+// respondError writes err as an ErrorResponse, or as ProblemDetails when the
+// client asks for application/problem+json. Errors missing from the catalog
+// are logged with fields and hidden behind a generic 500.
+func respondError(ctx echo.Context, err error, fields logrus.Fields) error {
+	lang := negotiateLanguage(ctx.Request().Header.Get(acceptLanguageHeader))
+
+	var (
+		status     int
+		code       string
+		message    string
+		violations []dto.Violation
+	)
+
+	var validationErr *controller.ValidationError
+	if errors.As(err, &validationErr) {
+		status, code = http.StatusBadRequest, dto.CodeValidationFailed
+		violations = localizeViolations(validationErr, lang)
+
+		messages := make([]string, 0, len(violations))
+		for _, violation := range violations {
+			messages = append(messages, violation.Message)
+		}
+		message = strings.Join(messages, "; ")
+	} else {
+		spec, ok := lookupError(err)
+		if !ok {
+			logrus.WithFields(fields).Error(err)
+
+			spec, _ = lookupError(ErrInternalServer)
+		}
+
+		status, code, message = spec.status, spec.code, localize(lang, spec.code, spec.err.Error())
+	}
+
+	var throttleErr *auth.ThrottleError
+	if errors.As(err, &throttleErr) {
+		ctx.Response().Header().Set(retryAfterHeader, strconv.Itoa(int(math.Ceil(throttleErr.RetryAfter.Seconds()))))
+	}
+
+	ctx.Response().Header().Set(contentLanguageHeader, lang)
+
+	if !acceptsProblemJSON(ctx.Request().Header.Get(echo.HeaderAccept)) {
+		return ctx.JSON(status, dto.ErrorResponse{Errors: message, Code: code, Violations: violations})
+	}
+
+	ctx.Response().Header().Set(echo.HeaderContentType, mimeProblemJSON)
+
+	return ctx.JSON(status, dto.ProblemDetails{
+		Type:       problemTypePrefix + code,
+		Title:      http.StatusText(status),
+		Status:     status,
+		Detail:     message,
+		Instance:   ctx.Request().URL.Path,
+		Code:       code,
+		Violations: violations,
+	})
+}
+
+// localizeViolations fills in the code of every violation and translates its
+// message. ValidationError unwraps to one sentinel per violation, in order.
+func localizeViolations(err *controller.ValidationError, lang string) []dto.Violation {
+	causes := err.Unwrap()
+
+	violations := make([]dto.Violation, len(err.Violations))
+	for i, violation := range err.Violations {
+		if i < len(causes) {
+			if spec, ok := lookupError(causes[i]); ok {
+				violation.Code = spec.code
+			}
+		}
+
+		violation.Message = localize(lang, violation.Code, violation.Message)
+		violations[i] = violation
+	}
+
+	return violations
+}
+
+func acceptsProblemJSON(accept string) bool {
+	for _, mediaType := range strings.Split(accept, ",") {
+		mediaType, _, _ = strings.Cut(mediaType, ";")
+		if strings.EqualFold(strings.TrimSpace(mediaType), mimeProblemJSON) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -13,3 +13,7 @@ var ErrEmptyToken = errors.New("empty token")
 var ErrInvalidAuthHeader = errors.New("invalid auth header")
 
 var ErrInvalidToken = errors.New("invalid token")
+
+var ErrForbidden = errors.New("forbidden")
+
+var ErrInvalidTrustedProxy = errors.New("invalid trusted proxy range")
@@ -6,18 +6,34 @@ import (
 	"net/http"
 
 	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
-	"github.com/dgt4l/avito_shop/internal/avito_shop/controller"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
-	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 )
 
 type ShopService interface {
-	GetInfo(ctx context.Context, userId int) (*dto.InfoResponse, error)
-	BuyItem(ctx context.Context, request *dto.BuyItemRequest) error
+	GetInfo(ctx context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error)
+	GetHistory(ctx context.Context, request *dto.HistoryRequest) (*dto.HistoryResponse, error)
+	BuyItem(ctx context.Context, request *dto.BuyItemRequest) (*dto.OrderResponse, error)
+	CreateOrder(ctx context.Context, request *dto.OrderRequest) (*dto.OrderResponse, error)
 	AuthUser(ctx context.Context, request *dto.AuthRequest) (*dto.AuthResponse, error)
-	SendCoin(ctx context.Context, fromUserId int, request *dto.SendCoinRequest) error
+	Register(ctx context.Context, request *dto.RegisterRequest) (*dto.AuthResponse, error)
+	CreateInvite(ctx context.Context, createdBy int) (*dto.InviteResponse, error)
+	RefreshToken(ctx context.Context, request *dto.RefreshRequest) (*dto.AuthResponse, error)
+	Logout(ctx context.Context, sessionId string) error
+	ChangePassword(ctx context.Context, request *dto.ChangePasswordRequest) error
+	CreatePasswordReset(ctx context.Context, request *dto.PasswordResetRequest) (*dto.PasswordResetResponse, error)
+	ResetPassword(ctx context.Context, request *dto.ResetPasswordRequest) error
+	SendCoin(ctx context.Context, fromUserId int, request *dto.SendCoinRequest) (*dto.SendCoinResponse, error)
+	GetItems(ctx context.Context, request *dto.ItemsRequest) (*dto.ItemsResponse, error)
+	CreateItem(ctx context.Context, request *dto.CreateItemRequest) (*models.Item, error)
+	UpdateItem(ctx context.Context, request *dto.UpdateItemRequest) (*models.Item, error)
+	SetItemLimits(ctx context.Context, request *dto.SetItemLimitsRequest) (*models.Item, error)
+	RetireItem(ctx context.Context, request *dto.RetireItemRequest) error
+	SetUserRole(ctx context.Context, request *dto.SetRoleRequest) error
+	SetUserStatus(ctx context.Context, request *dto.SetStatusRequest) error
+	VerifyLedger(ctx context.Context) (*dto.LedgerReport, error)
 }
 
 type ShopHandler struct {
@@ -27,8 +43,9 @@ type ShopHandler struct {
 	port        string
 }
 
-func NewShopHandler(srv ShopService, auth auth.AuthService, port string) *ShopHandler {
+func NewShopHandler(srv ShopService, auth auth.AuthService, port string, cfg HandlerConfig) *ShopHandler {
 	e := echo.New()
+	e.IPExtractor = cfg.ipExtractor()
 	return &ShopHandler{
 		e:           e,
 		shopService: srv,
@@ -59,29 +76,55 @@ func (h *ShopHandler) BuyItem(ctx echo.Context) error {
 
 	var request dto.BuyItemRequest
 	if err := ctx.Bind(&request); err != nil {
-		return ctx.JSON(http.StatusBadRequest, dto.BadRequestResponse{Errors: ErrInvalidDataType.Error()})
+		return respondError(ctx, ErrInvalidDataType, nil)
 	}
 
 	var ok bool
 	request.Id, ok = ctx.Get("id").(int)
 	if !ok {
-		return ctx.JSON(http.StatusInternalServerError, dto.InternalServerErrorResponse{Errors: ErrInternalServer.Error()})
+		return respondError(ctx, ErrInternalServer, nil)
 	}
+	request.IdempotencyKey = ctx.Request().Header.Get(idempotencyKeyHeader)
 
-	err := h.shopService.BuyItem(ctx.Request().Context(), &request)
-	if err != nil && (errors.Is(err, repository.ErrNotEnoughCoins) ||
-		errors.Is(err, repository.ErrItemNotFound) ||
-		errors.Is(err, controller.ErrEmptyItemName)) {
-		return ctx.JSON(http.StatusBadRequest, dto.BadRequestResponse{Errors: err.Error()})
+	response, err := h.shopService.BuyItem(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
+
+	if response.Replayed {
+		ctx.Response().Header().Set(idempotentReplayedHeader, "true")
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (h *ShopHandler) CreateOrder(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.CreateOrder"
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(ctx.Get("id"))
+
+	var request dto.OrderRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
 	}
 
+	var ok bool
+	request.Id, ok = ctx.Get("id").(int)
+	if !ok {
+		return respondError(ctx, ErrInternalServer, nil)
+	}
+	request.IdempotencyKey = ctx.Request().Header.Get(idempotencyKeyHeader)
+
+	response, err := h.shopService.CreateOrder(ctx.Request().Context(), &request)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"event": op, "request": request}).Error(err)
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
 
-		return ctx.JSON(http.StatusInternalServerError, dto.InternalServerErrorResponse{Errors: ErrInternalServer.Error()})
+	if response.Replayed {
+		ctx.Response().Header().Set(idempotentReplayedHeader, "true")
 	}
 
-	return ctx.JSON(http.StatusOK, nil)
+	return ctx.JSON(http.StatusOK, response)
 }
 
 func (h *ShopHandler) SendCoin(ctx echo.Context) error {
@@ -92,29 +135,25 @@ func (h *ShopHandler) SendCoin(ctx echo.Context) error {
 	var request dto.SendCoinRequest
 
 	if err := ctx.Bind(&request); err != nil {
-		return ctx.JSON(http.StatusBadRequest, dto.BadRequestResponse{Errors: ErrInvalidDataType.Error()})
+		return respondError(ctx, ErrInvalidDataType, nil)
 	}
 
 	fromUserId, ok := ctx.Get("id").(int)
 	if !ok {
-		return ctx.JSON(http.StatusInternalServerError, dto.InternalServerErrorResponse{Errors: ErrInternalServer.Error()})
-	}
-
-	err := h.shopService.SendCoin(ctx.Request().Context(), fromUserId, &request)
-	if err != nil && (errors.Is(err, controller.ErrShortUsername) ||
-		errors.Is(err, controller.ErrInvalidAmount) ||
-		errors.Is(err, repository.ErrNotEnoughCoins) ||
-		errors.Is(err, repository.ErrUserToNotFound)) {
-		return ctx.JSON(http.StatusBadRequest, dto.BadRequestResponse{Errors: err.Error()})
+		return respondError(ctx, ErrInternalServer, nil)
 	}
+	request.IdempotencyKey = ctx.Request().Header.Get(idempotencyKeyHeader)
 
+	response, err := h.shopService.SendCoin(ctx.Request().Context(), fromUserId, &request)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"event": op, "fromUser": fromUserId, "request": request}).Error(err)
+		return respondError(ctx, err, logrus.Fields{"event": op, "fromUser": fromUserId, "request": request})
+	}
 
-		return ctx.JSON(http.StatusInternalServerError, dto.InternalServerErrorResponse{Errors: ErrInternalServer.Error()})
+	if response.Replayed {
+		ctx.Response().Header().Set(idempotentReplayedHeader, "true")
 	}
 
-	return ctx.JSON(http.StatusOK, nil)
+	return ctx.JSON(http.StatusOK, response)
 }
 
 func (h *ShopHandler) AuthUser(ctx echo.Context) error {
@@ -123,27 +162,155 @@ func (h *ShopHandler) AuthUser(ctx echo.Context) error {
 	var request dto.AuthRequest
 
 	if err := ctx.Bind(&request); err != nil {
-		return ctx.JSON(http.StatusBadRequest, dto.BadRequestResponse{Errors: ErrInvalidDataType.Error()})
+		return respondError(ctx, ErrInvalidDataType, nil)
 	}
 
-	logrus.WithFields(logrus.Fields{"event": op}).Info(request)
+	request.ClientIp = ctx.RealIP()
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(request.Username)
 
 	response, err := h.shopService.AuthUser(ctx.Request().Context(), &request)
-	if err != nil && (errors.Is(err, controller.ErrShortPassword) ||
-		errors.Is(err, controller.ErrShortUsername) ||
-		errors.Is(err, controller.ErrInvalidPasswd)) {
-		return ctx.JSON(http.StatusBadRequest, dto.BadRequestResponse{Errors: err.Error()})
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "username": request.Username})
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (h *ShopHandler) Register(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.Register"
+
+	var request dto.RegisterRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(request.Username)
+
+	response, err := h.shopService.Register(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "username": request.Username})
+	}
+
+	return ctx.JSON(http.StatusCreated, response)
+}
+
+func (h *ShopHandler) CreateInvite(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.CreateInvite"
+
+	adminId, ok := ctx.Get("id").(int)
+	if !ok {
+		return respondError(ctx, ErrInternalServer, nil)
 	}
 
+	response, err := h.shopService.CreateInvite(ctx.Request().Context(), adminId)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"event": op, "request": request}).Error(err)
+		return respondError(ctx, err, logrus.Fields{"event": op, "admin": adminId})
+	}
 
-		return ctx.JSON(http.StatusInternalServerError, dto.InternalServerErrorResponse{Errors: ErrInternalServer.Error()})
+	return ctx.JSON(http.StatusCreated, response)
+}
+
+func (h *ShopHandler) RefreshToken(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.RefreshToken"
+
+	var request dto.RefreshRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	response, err := h.shopService.RefreshToken(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op})
 	}
 
 	return ctx.JSON(http.StatusOK, response)
 }
 
+func (h *ShopHandler) Logout(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.Logout"
+
+	sessionId, ok := ctx.Get("sid").(string)
+	if !ok {
+		return respondError(ctx, ErrInternalServer, nil)
+	}
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(ctx.Get("id"))
+
+	if err := h.shopService.Logout(ctx.Request().Context(), sessionId); err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op})
+	}
+
+	return ctx.JSON(http.StatusOK, nil)
+}
+
+func (h *ShopHandler) ChangePassword(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.ChangePassword"
+
+	userId, okId := ctx.Get("id").(int)
+	sessionId, okSid := ctx.Get("sid").(string)
+	if !okId || !okSid {
+		return respondError(ctx, ErrInternalServer, nil)
+	}
+
+	var request dto.ChangePasswordRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	request.Id, request.SessionId, request.ClientIp = userId, sessionId, ctx.RealIP()
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(userId)
+
+	err := h.shopService.ChangePassword(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "id": userId})
+	}
+
+	return ctx.JSON(http.StatusOK, nil)
+}
+
+func (h *ShopHandler) CreatePasswordReset(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.CreatePasswordReset"
+
+	adminId, ok := ctx.Get("id").(int)
+	if !ok {
+		return respondError(ctx, ErrInternalServer, nil)
+	}
+
+	var request dto.PasswordResetRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	request.CreatedBy = adminId
+
+	logrus.WithFields(logrus.Fields{"event": op, "admin": adminId}).Info(request.Username)
+
+	response, err := h.shopService.CreatePasswordReset(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "admin": adminId})
+	}
+
+	return ctx.JSON(http.StatusCreated, response)
+}
+
+func (h *ShopHandler) ResetPassword(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.ResetPassword"
+
+	var request dto.ResetPasswordRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	err := h.shopService.ResetPassword(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op})
+	}
+
+	return ctx.JSON(http.StatusOK, nil)
+}
+
 func (h *ShopHandler) GetInfo(ctx echo.Context) error {
 	const op = "internal.avito.shop.handler.ShopHandler.GetInfo"
 
@@ -152,19 +319,195 @@ func (h *ShopHandler) GetInfo(ctx echo.Context) error {
 	logrus.WithFields(logrus.Fields{"event": op}).Info(userId)
 
 	if !ok {
-		return ctx.JSON(http.StatusInternalServerError, dto.InternalServerErrorResponse{Errors: ErrInternalServer.Error()})
+		return respondError(ctx, ErrInternalServer, nil)
+	}
+
+	var request dto.InfoRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+	request.Id = userId
+
+	response, err := h.shopService.GetInfo(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "userId": userId})
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (h *ShopHandler) GetHistory(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.GetHistory"
+
+	userId, ok := ctx.Get("id").(int)
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(userId)
+
+	if !ok {
+		return respondError(ctx, ErrInternalServer, nil)
+	}
+
+	var request dto.HistoryRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
 	}
+	request.Id = userId
 
-	response, err := h.shopService.GetInfo(ctx.Request().Context(), userId)
+	response, err := h.shopService.GetHistory(ctx.Request().Context(), &request)
 	if err != nil {
-		logrus.WithFields(logrus.Fields{"event": op, "userId": userId}).Error(err)
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
 
-		return ctx.JSON(http.StatusInternalServerError, dto.InternalServerErrorResponse{Errors: ErrInternalServer.Error()})
+	return ctx.JSON(http.StatusOK, response)
+}
+
+func (h *ShopHandler) GetItems(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.GetItems"
+
+	var request dto.ItemsRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	response, err := h.shopService.GetItems(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
 	}
 
 	return ctx.JSON(http.StatusOK, response)
 }
 
+func (h *ShopHandler) CreateItem(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.CreateItem"
+
+	var request dto.CreateItemRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(request)
+
+	item, err := h.shopService.CreateItem(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
+
+	return ctx.JSON(http.StatusCreated, item)
+}
+
+func (h *ShopHandler) UpdateItem(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.UpdateItem"
+
+	var request dto.UpdateItemRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(request)
+
+	item, err := h.shopService.UpdateItem(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
+
+	return ctx.JSON(http.StatusOK, item)
+}
+
+func (h *ShopHandler) SetItemLimits(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.SetItemLimits"
+
+	var request dto.SetItemLimitsRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(request)
+
+	item, err := h.shopService.SetItemLimits(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
+
+	return ctx.JSON(http.StatusOK, item)
+}
+
+func (h *ShopHandler) RetireItem(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.RetireItem"
+
+	var request dto.RetireItemRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	logrus.WithFields(logrus.Fields{"event": op}).Info(request)
+
+	err := h.shopService.RetireItem(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
+
+	return ctx.JSON(http.StatusOK, nil)
+}
+
+func (h *ShopHandler) SetUserRole(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.SetUserRole"
+
+	var request dto.SetRoleRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	logrus.WithFields(logrus.Fields{"event": op, "admin": ctx.Get("id")}).Info(request)
+
+	err := h.shopService.SetUserRole(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
+
+	return ctx.JSON(http.StatusOK, nil)
+}
+
+func (h *ShopHandler) SetUserStatus(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.SetUserStatus"
+
+	var request dto.SetStatusRequest
+	if err := ctx.Bind(&request); err != nil {
+		return respondError(ctx, ErrInvalidDataType, nil)
+	}
+
+	logrus.WithFields(logrus.Fields{"event": op, "admin": ctx.Get("id")}).Info(request)
+
+	err := h.shopService.SetUserStatus(ctx.Request().Context(), &request)
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op, "request": request})
+	}
+
+	return ctx.JSON(http.StatusOK, nil)
+}
+
+func (h *ShopHandler) VerifyLedger(ctx echo.Context) error {
+	const op = "internal.avito.shop.handler.ShopHandler.VerifyLedger"
+
+	report, err := h.shopService.VerifyLedger(ctx.Request().Context())
+	if err != nil {
+		return respondError(ctx, err, logrus.Fields{"event": op})
+	}
+
+	if !report.Balanced {
+		logrus.WithFields(logrus.Fields{"event": op, "report": report}).Warn("ledger verification failed")
+	}
+
+	return ctx.JSON(http.StatusOK, report)
+}
+
+// JWKS serves the public signing keys so other services can verify tokens
+// without calling us; clients may cache the set for a few minutes.
+func (h *ShopHandler) JWKS(ctx echo.Context) error {
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=300")
+
+	return ctx.JSON(http.StatusOK, h.auth.JWKS())
+}
+
 func (h *ShopHandler) Ping(ctx echo.Context) error {
 	return ctx.String(http.StatusOK, "pong")
 }
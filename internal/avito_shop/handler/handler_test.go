@@ -2,15 +2,23 @@ package handler
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/controller"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
 	"github.com/dgt4l/avito_shop/test/mocks"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
@@ -22,7 +30,7 @@ func TestShopHandlerBuyItem(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	req := httptest.NewRequest(http.MethodGet, "/buy?item=test-item", nil)
 	rec := httptest.NewRecorder()
@@ -31,13 +39,68 @@ func TestShopHandlerBuyItem(t *testing.T) {
 
 	mockShopService.EXPECT().
 		BuyItem(c.Request().Context(), &dto.BuyItemRequest{Id: 1, Item: "test-item"}).
-		Return(nil)
+		Return(&dto.OrderResponse{}, nil)
 
 	err := handler.BuyItem(c)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
 }
 
+func TestShopHandlerBuyItem_OutOfStock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/buy?item=pink-hoody", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("id", 1)
+
+	mockShopService.EXPECT().
+		BuyItem(c.Request().Context(), &dto.BuyItemRequest{Id: 1, Item: "pink-hoody"}).
+		Return(nil, repository.ErrOutOfStock)
+
+	err := handler.BuyItem(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), repository.ErrOutOfStock.Error())
+}
+
+func TestShopHandlerCreateOrder(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	requestBody := `{"items":[{"item":"pen","quantity":5},{"item":"cup","quantity":1}]}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewBufferString(requestBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("id", 1)
+
+	mockShopService.EXPECT().
+		CreateOrder(c.Request().Context(), &dto.OrderRequest{
+			Id:    1,
+			Items: []dto.OrderItem{{Item: "pen", Quantity: 5}, {Item: "cup", Quantity: 1}},
+		}).
+		Return(nil, repository.ErrNotEnoughCoins)
+
+	err := handler.CreateOrder(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), repository.ErrNotEnoughCoins.Error())
+}
+
 func TestShopHandlerSendCoin(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -46,7 +109,7 @@ func TestShopHandlerSendCoin(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	req := httptest.NewRequest(http.MethodPost, "/sendCoin", bytes.NewBufferString(`{"toUser":"user2","amount":50}`))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
@@ -56,11 +119,112 @@ func TestShopHandlerSendCoin(t *testing.T) {
 
 	mockShopService.EXPECT().
 		SendCoin(c.Request().Context(), 1, &dto.SendCoinRequest{ToUser: "user2", Amount: 50}).
-		Return(nil)
+		Return(&dto.SendCoinResponse{Id: 1, ToUser: "user2", Amount: 50}, nil)
 
 	err := handler.SendCoin(c)
 	assert.NoError(t, err)
 	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(idempotentReplayedHeader))
+}
+
+func TestShopHandlerSendCoin_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		serviceErr error
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "SelfTransfer", serviceErr: controller.ErrSelfTransfer, wantStatus: http.StatusBadRequest, wantCode: dto.CodeSelfTransfer},
+		{name: "RecipientBlocked", serviceErr: repository.ErrRecipientBlocked, wantStatus: http.StatusUnprocessableEntity, wantCode: dto.CodeRecipientBlocked},
+		{name: "RecipientDisabled", serviceErr: repository.ErrRecipientDisabled, wantStatus: http.StatusUnprocessableEntity, wantCode: dto.CodeRecipientDisabled},
+		{name: "TransferLimit", serviceErr: controller.ErrTransferLimit, wantStatus: http.StatusUnprocessableEntity, wantCode: dto.CodeTransferLimitExceeded},
+		{name: "DailyLimit", serviceErr: repository.ErrDailyTransferLimit, wantStatus: http.StatusUnprocessableEntity, wantCode: dto.CodeDailyLimitExceeded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockShopService := mocks.NewMockShopService(ctrl)
+			mockAuthService := mocks.NewMockAuthService(ctrl)
+
+			e := echo.New()
+			handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+			req := httptest.NewRequest(http.MethodPost, "/sendCoin", bytes.NewBufferString(`{"toUser":"user2","amount":50}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("id", 1)
+
+			mockShopService.EXPECT().
+				SendCoin(c.Request().Context(), 1, &dto.SendCoinRequest{ToUser: "user2", Amount: 50}).
+				Return(nil, tt.serviceErr)
+
+			err := handler.SendCoin(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+
+			var response dto.ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantCode, response.Code)
+		})
+	}
+}
+
+func TestShopHandlerSendCoin_IdempotentReplay(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/sendCoin", bytes.NewBufferString(`{"toUser":"user2","amount":50}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(idempotencyKeyHeader, "key-1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("id", 1)
+
+	mockShopService.EXPECT().
+		SendCoin(c.Request().Context(), 1, &dto.SendCoinRequest{ToUser: "user2", Amount: 50, IdempotencyKey: "key-1"}).
+		Return(&dto.SendCoinResponse{Id: 1, ToUser: "user2", Amount: 50, Replayed: true}, nil)
+
+	err := handler.SendCoin(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(idempotentReplayedHeader))
+	assert.Contains(t, rec.Body.String(), `"toUser":"user2"`)
+}
+
+func TestShopHandlerSendCoin_IdempotencyKeyReused(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/sendCoin", bytes.NewBufferString(`{"toUser":"user2","amount":60}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(idempotencyKeyHeader, "key-1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("id", 1)
+
+	mockShopService.EXPECT().
+		SendCoin(c.Request().Context(), 1, &dto.SendCoinRequest{ToUser: "user2", Amount: 60, IdempotencyKey: "key-1"}).
+		Return(nil, repository.ErrIdempotencyKeyReused)
+
+	err := handler.SendCoin(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
 }
 
 func TestShopHandlerAuthUser(t *testing.T) {
@@ -71,7 +235,7 @@ func TestShopHandlerAuthUser(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	requestBody := `{"username":"testuser","password":"testpassword"}`
 	req := httptest.NewRequest(http.MethodPost, "/auth", bytes.NewBufferString(requestBody))
@@ -80,7 +244,7 @@ func TestShopHandlerAuthUser(t *testing.T) {
 	c := e.NewContext(req, rec)
 
 	mockShopService.EXPECT().
-		AuthUser(c.Request().Context(), &dto.AuthRequest{Username: "testuser", Password: "testpassword"}).
+		AuthUser(c.Request().Context(), &dto.AuthRequest{Username: "testuser", Password: "testpassword", ClientIp: "192.0.2.1"}).
 		Return(&dto.AuthResponse{Token: "test-token"}, nil)
 
 	err := handler.AuthUser(c)
@@ -89,6 +253,33 @@ func TestShopHandlerAuthUser(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), `"token":"test-token"`)
 }
 
+func TestShopHandlerAuthUserThrottled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	requestBody := `{"username":"testuser","password":"testpassword"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth", bytes.NewBufferString(requestBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockShopService.EXPECT().
+		AuthUser(c.Request().Context(), gomock.Any()).
+		Return(nil, &auth.ThrottleError{RetryAfter: 1500 * time.Millisecond})
+
+	err := handler.AuthUser(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(retryAfterHeader))
+	assert.Contains(t, rec.Body.String(), auth.ErrTooManyLoginAttempts.Error())
+}
+
 func TestShopHandlerGetInfo(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -97,7 +288,7 @@ func TestShopHandlerGetInfo(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	req := httptest.NewRequest(http.MethodGet, "/info", nil)
 	rec := httptest.NewRecorder()
@@ -119,7 +310,7 @@ func TestShopHandlerGetInfo(t *testing.T) {
 		},
 	}
 	mockShopService.EXPECT().
-		GetInfo(c.Request().Context(), 1).
+		GetInfo(c.Request().Context(), &dto.InfoRequest{Id: 1}).
 		Return(expectedResponse, nil)
 
 	err := handler.GetInfo(c)
@@ -128,6 +319,63 @@ func TestShopHandlerGetInfo(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), `"coins":100`)
 }
 
+func TestShopHandlerGetItems(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/items?sort=price&order=desc&min_price=10&max_price=100", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockShopService.EXPECT().
+		GetItems(c.Request().Context(), &dto.ItemsRequest{SortBy: "price", Order: "desc", MinPrice: 10, MaxPrice: 100}).
+		Return(&dto.ItemsResponse{Items: []dto.Item{{Id: 3, Name: "book", Price: 50, Available: true}}}, nil)
+
+	err := handler.GetItems(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"name":"book"`)
+}
+
+func TestShopHandlerGetHistory(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/history?direction=sent&from=2025-02-01T00:00:00Z&limit=10", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("id", 1)
+
+	mockShopService.EXPECT().
+		GetHistory(c.Request().Context(), &dto.HistoryRequest{
+			Id:        1,
+			Direction: dto.DirectionSent,
+			From:      time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+			Limit:     10,
+		}).
+		Return(&dto.HistoryResponse{
+			Entries:    []dto.HistoryEntry{{Id: 8, Type: dto.HistoryTypeSent, Counterparty: "user3", Amount: 30}},
+			NextCursor: "next",
+		}, nil)
+
+	err := handler.GetHistory(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"nextCursor":"next"`)
+}
+
 func TestShopHandlerPing(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -136,7 +384,7 @@ func TestShopHandlerPing(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
 	rec := httptest.NewRecorder()
@@ -156,7 +404,7 @@ func TestShopHandlerAuthMiddleware_ValidToken(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	e.Use(handler.AuthMiddleware())
 
@@ -166,7 +414,10 @@ func TestShopHandlerAuthMiddleware_ValidToken(t *testing.T) {
 
 	mockAuthService.EXPECT().
 		ParseToken("valid-token").
-		Return(1, nil)
+		Return(&auth.UserClaims{Id: 1, Role: models.RoleUser, SessionId: "sid"}, nil)
+	mockAuthService.EXPECT().
+		CheckSession(gomock.Any(), "sid").
+		Return(nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
 	req.Header.Set(authorizationHeader, "Bearer valid-token")
@@ -178,6 +429,37 @@ func TestShopHandlerAuthMiddleware_ValidToken(t *testing.T) {
 	assert.Equal(t, "success", rec.Body.String())
 }
 
+func TestShopHandlerAuthMiddleware_LegacyToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	e.Use(handler.AuthMiddleware())
+
+	e.GET("/test", func(c echo.Context) error {
+		return c.String(http.StatusOK, "success")
+	})
+
+	// Legacy tokens without a session skip CheckSession.
+	mockAuthService.EXPECT().
+		ParseToken("legacy-token").
+		Return(&auth.UserClaims{Id: 1, Role: models.RoleUser}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set(authorizationHeader, "Bearer legacy-token")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "success", rec.Body.String())
+}
+
 func TestShopHandlerAuthMiddleware_EmptyToken(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -186,7 +468,7 @@ func TestShopHandlerAuthMiddleware_EmptyToken(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	e.Use(handler.AuthMiddleware())
 
@@ -201,6 +483,7 @@ func TestShopHandlerAuthMiddleware_EmptyToken(t *testing.T) {
 
 	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 	assert.Contains(t, rec.Body.String(), ErrEmptyToken.Error())
+	assert.Equal(t, `Bearer realm="avito_shop"`, rec.Header().Get(wwwAuthenticateHeader))
 }
 
 func TestShopHandlerAuthMiddleware_InvalidAuthHeader(t *testing.T) {
@@ -211,7 +494,7 @@ func TestShopHandlerAuthMiddleware_InvalidAuthHeader(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	e.Use(handler.AuthMiddleware())
 
@@ -230,6 +513,140 @@ func TestShopHandlerAuthMiddleware_InvalidAuthHeader(t *testing.T) {
 }
 
 func TestShopHandlerAuthMiddleware_InvalidToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		parseErr error
+		wantBody string
+		wantCode string
+	}{
+		{
+			name:     "Expired",
+			parseErr: auth.ErrTokenExpired,
+			wantBody: auth.ErrTokenExpired.Error(),
+			wantCode: dto.CodeTokenExpired,
+		},
+		{
+			name:     "BadSignature",
+			parseErr: auth.ErrInvalidSignature,
+			wantBody: auth.ErrInvalidSignature.Error(),
+			wantCode: dto.CodeInvalidSignature,
+		},
+		{
+			name:     "WrongMethod",
+			parseErr: auth.ErrInvalidSignMethod,
+			wantBody: auth.ErrInvalidSignMethod.Error(),
+			wantCode: dto.CodeInvalidSignature,
+		},
+		{
+			name:     "Malformed",
+			parseErr: auth.ErrMalformedToken,
+			wantBody: auth.ErrMalformedToken.Error(),
+			wantCode: dto.CodeMalformedToken,
+		},
+		{
+			name:     "Other",
+			parseErr: errors.New("claim parsing failed"),
+			wantBody: ErrInvalidToken.Error(),
+			wantCode: dto.CodeInvalidToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockShopService := mocks.NewMockShopService(ctrl)
+			mockAuthService := mocks.NewMockAuthService(ctrl)
+
+			e := echo.New()
+			handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+			e.Use(handler.AuthMiddleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.String(http.StatusOK, "success")
+			})
+
+			mockAuthService.EXPECT().
+				ParseToken("invalid-token").
+				Return(nil, tt.parseErr)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set(authorizationHeader, "Bearer invalid-token")
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			var resp dto.ErrorResponse
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.Equal(t, tt.wantBody, resp.Errors)
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Contains(t, rec.Header().Get(wwwAuthenticateHeader), `Bearer realm="avito_shop", error="invalid_token"`)
+		})
+	}
+}
+
+func TestShopHandlerAuthMiddleware_Scheme(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		valid  bool
+	}{
+		{name: "Bearer", header: "Bearer valid-token", valid: true},
+		{name: "LowercaseBearer", header: "bearer valid-token", valid: true},
+		{name: "Basic", header: "Basic valid-token"},
+		{name: "MissingToken", header: "Bearer "},
+		{name: "ExtraParts", header: "Bearer valid-token extra"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockShopService := mocks.NewMockShopService(ctrl)
+			mockAuthService := mocks.NewMockAuthService(ctrl)
+
+			e := echo.New()
+			handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+			e.Use(handler.AuthMiddleware())
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.String(http.StatusOK, "success")
+			})
+
+			if tt.valid {
+				mockAuthService.EXPECT().
+					ParseToken("valid-token").
+					Return(&auth.UserClaims{Id: 1, Role: models.RoleUser, SessionId: "sid"}, nil)
+				mockAuthService.EXPECT().
+					CheckSession(gomock.Any(), "sid").
+					Return(nil)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set(authorizationHeader, tt.header)
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			if tt.valid {
+				assert.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.Contains(t, rec.Body.String(), dto.CodeInvalidAuthHeader)
+			assert.Contains(t, rec.Header().Get(wwwAuthenticateHeader), `error="invalid_request"`)
+		})
+	}
+}
+
+func TestShopHandlerAuthMiddleware_RevokedSession(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -237,7 +654,7 @@ func TestShopHandlerAuthMiddleware_InvalidToken(t *testing.T) {
 	mockAuthService := mocks.NewMockAuthService(ctrl)
 
 	e := echo.New()
-	handler := NewShopHandler(mockShopService, mockAuthService, "8080")
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
 
 	e.Use(handler.AuthMiddleware())
 
@@ -246,15 +663,609 @@ func TestShopHandlerAuthMiddleware_InvalidToken(t *testing.T) {
 	})
 
 	mockAuthService.EXPECT().
-		ParseToken("invalid-token").
-		Return(0, errors.New("invalid token"))
+		ParseToken("revoked-token").
+		Return(&auth.UserClaims{Id: 1, Role: models.RoleUser, SessionId: "sid"}, nil)
+	mockAuthService.EXPECT().
+		CheckSession(gomock.Any(), "sid").
+		Return(auth.ErrSessionRevoked)
 
 	req := httptest.NewRequest(http.MethodGet, "/test", nil)
-	req.Header.Set(authorizationHeader, "Bearer invalid-token")
+	req.Header.Set(authorizationHeader, "Bearer revoked-token")
 	rec := httptest.NewRecorder()
 
 	e.ServeHTTP(rec, req)
 
-	assert.Equal(t, http.StatusInternalServerError, rec.Code)
-	assert.Contains(t, rec.Body.String(), ErrInternalServer.Error())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), auth.ErrSessionRevoked.Error())
+	assert.Contains(t, rec.Body.String(), dto.CodeSessionRevoked)
+}
+
+func TestShopHandlerRegister(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	requestBody := `{"username":"user1","password":"password1"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBufferString(requestBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockShopService.EXPECT().
+		Register(c.Request().Context(), &dto.RegisterRequest{Username: "user1", Password: "password1"}).
+		Return(&dto.AuthResponse{Token: "test-token"}, nil)
+
+	err := handler.Register(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPost, "/register", bytes.NewBufferString(requestBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+
+	mockShopService.EXPECT().
+		Register(c.Request().Context(), &dto.RegisterRequest{Username: "user1", Password: "password1"}).
+		Return(nil, repository.ErrUserAlreadyExists)
+
+	err = handler.Register(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestShopHandlerRegister_Violations(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	requestBody := `{"username":"admin","password":"short"}`
+
+	req := httptest.NewRequest(http.MethodPost, "/register", bytes.NewBufferString(requestBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	policy := controller.NewPolicy(controller.PolicyConfig{ReservedUsernames: []string{"admin"}}, "")
+	validationErr := controller.ValidateNewCredentials(&dto.AuthRequest{Username: "admin", Password: "short"}, policy)
+
+	mockShopService.EXPECT().
+		Register(c.Request().Context(), &dto.RegisterRequest{Username: "admin", Password: "short"}).
+		Return(nil, validationErr)
+
+	err := handler.Register(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	var response dto.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, dto.CodeValidationFailed, response.Code)
+	assert.Equal(t, []dto.Violation{
+		{Field: "username", Rule: "reserved", Code: dto.CodeUsernameReserved, Message: controller.ErrReservedUsername.Error()},
+		{Field: "password", Rule: "min_length", Code: dto.CodePasswordTooShort, Message: controller.ErrShortPassword.Error()},
+	}, response.Violations)
+}
+
+func TestRespondError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantBody   string
+	}{
+		{
+			name:       "Catalog",
+			err:        repository.ErrNotEnoughCoins,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   dto.CodeInsufficientFunds,
+			wantBody:   repository.ErrNotEnoughCoins.Error(),
+		},
+		{
+			name:       "Wrapped",
+			err:        fmt.Errorf("buy sticker: %w", repository.ErrItemNotFound),
+			wantStatus: http.StatusNotFound,
+			wantCode:   dto.CodeItemNotFound,
+			wantBody:   repository.ErrItemNotFound.Error(),
+		},
+		{
+			name:       "Unknown",
+			err:        errors.New("db down"),
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   dto.CodeInternalError,
+			wantBody:   ErrInternalServer.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/api/info", nil), rec)
+
+			assert.NoError(t, respondError(c, tt.err, nil))
+			assert.Equal(t, tt.wantStatus, rec.Code)
+
+			var response dto.ErrorResponse
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantCode, response.Code)
+			assert.Equal(t, tt.wantBody, response.Errors)
+		})
+	}
+}
+
+func TestRespondError_ProblemJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/sendCoin", nil)
+	req.Header.Set(echo.HeaderAccept, "application/problem+json, application/json;q=0.5")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	assert.NoError(t, respondError(c, repository.ErrUserToNotFound, nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, mimeProblemJSON, rec.Header().Get(echo.HeaderContentType))
+
+	var problem dto.ProblemDetails
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, dto.ProblemDetails{
+		Type:     "urn:avito_shop:error:RECIPIENT_NOT_FOUND",
+		Title:    "Bad Request",
+		Status:   http.StatusBadRequest,
+		Detail:   repository.ErrUserToNotFound.Error(),
+		Instance: "/api/sendCoin",
+		Code:     dto.CodeRecipientNotFound,
+	}, problem)
+}
+
+func TestRespondError_Localized(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/api/buy/sticker", nil)
+	req.Header.Set(acceptLanguageHeader, "ru-RU,ru;q=0.9,en;q=0.8")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	assert.NoError(t, respondError(c, repository.ErrNotEnoughCoins, nil))
+	assert.Equal(t, "ru", rec.Header().Get(contentLanguageHeader))
+
+	var response dto.ErrorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, dto.CodeInsufficientFunds, response.Code)
+	assert.Equal(t, "недостаточно монет", response.Errors)
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	assert.Equal(t, "en", negotiateLanguage(""))
+	assert.Equal(t, "ru", negotiateLanguage("ru"))
+	assert.Equal(t, "ru", negotiateLanguage("de-DE, ru-RU;q=0.7"))
+	assert.Equal(t, "en", negotiateLanguage("ru;q=0.3, en;q=0.8"))
+	assert.Equal(t, "en", negotiateLanguage("fr, de;q=0.5"))
+	assert.Equal(t, "en", negotiateLanguage("ru;q=abc"))
+}
+
+func TestErrorCatalog_Translated(t *testing.T) {
+	for _, spec := range errorCatalog {
+		assert.Contains(t, errorMessages["ru"], spec.code, "missing ru message")
+	}
+}
+
+func TestShopHandlerJWKS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockAuthService.EXPECT().
+		JWKS().
+		Return(&dto.JWKS{Keys: []dto.JWK{{Kty: "OKP", Kid: "ed-1", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: "x"}}})
+
+	err := handler.JWKS(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"kid":"ed-1"`)
+	assert.NotEmpty(t, rec.Header().Get(echo.HeaderCacheControl))
+}
+
+func TestShopHandlerRefreshToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewBufferString(`{"refreshToken":"sid.stale"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockShopService.EXPECT().
+		RefreshToken(c.Request().Context(), &dto.RefreshRequest{RefreshToken: "sid.stale"}).
+		Return(nil, auth.ErrInvalidRefreshToken)
+
+	err := handler.RefreshToken(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestShopHandlerLogout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.Set("id", 1)
+	c.Set("sid", "sid")
+
+	mockShopService.EXPECT().
+		Logout(c.Request().Context(), "sid").
+		Return(nil)
+
+	err := handler.Logout(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestShopHandlerChangePassword(t *testing.T) {
+	tests := []struct {
+		name       string
+		serviceErr error
+		wantStatus int
+	}{
+		{name: "Success", wantStatus: http.StatusOK},
+		{name: "WrongPassword", serviceErr: controller.ErrInvalidPasswd, wantStatus: http.StatusBadRequest},
+		{
+			name: "SamePassword",
+			serviceErr: &controller.ValidationError{Violations: []dto.Violation{
+				{Field: "newPassword", Rule: "different", Message: controller.ErrSamePassword.Error()},
+			}},
+			wantStatus: http.StatusBadRequest,
+		},
+		{name: "Throttled", serviceErr: &auth.ThrottleError{RetryAfter: time.Minute}, wantStatus: http.StatusTooManyRequests},
+		{name: "InternalError", serviceErr: errors.New("db down"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockShopService := mocks.NewMockShopService(ctrl)
+			mockAuthService := mocks.NewMockAuthService(ctrl)
+
+			e := echo.New()
+			handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+			requestBody := `{"currentPassword":"password1","newPassword":"password2"}`
+			req := httptest.NewRequest(http.MethodPost, "/me/password", bytes.NewBufferString(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+			c := e.NewContext(req, rec)
+			c.Set("id", 1)
+			c.Set("sid", "sid")
+
+			mockShopService.EXPECT().
+				ChangePassword(c.Request().Context(), &dto.ChangePasswordRequest{
+					Id:              1,
+					SessionId:       "sid",
+					ClientIp:        "192.0.2.1",
+					CurrentPassword: "password1",
+					NewPassword:     "password2",
+				}).
+				Return(tt.serviceErr)
+
+			err := handler.ChangePassword(c)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, rec.Code)
+		})
+	}
+}
+
+func TestShopHandlerCreatePasswordReset(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/user1/password-reset", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("username")
+	c.SetParamValues("user1")
+	c.Set("id", 7)
+
+	mockShopService.EXPECT().
+		CreatePasswordReset(c.Request().Context(), &dto.PasswordResetRequest{Username: "user1", CreatedBy: 7}).
+		Return(&dto.PasswordResetResponse{ResetToken: "token"}, nil)
+
+	err := handler.CreatePasswordReset(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"resetToken":"token"`)
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/users/ghost/password-reset", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("username")
+	c.SetParamValues("ghost")
+	c.Set("id", 7)
+
+	mockShopService.EXPECT().
+		CreatePasswordReset(c.Request().Context(), &dto.PasswordResetRequest{Username: "ghost", CreatedBy: 7}).
+		Return(nil, repository.ErrUserNotFound)
+
+	err = handler.CreatePasswordReset(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestShopHandlerResetPassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	requestBody := `{"resetToken":"used","newPassword":"password2"}`
+	req := httptest.NewRequest(http.MethodPost, "/password/reset", bytes.NewBufferString(requestBody))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockShopService.EXPECT().
+		ResetPassword(c.Request().Context(), &dto.ResetPasswordRequest{ResetToken: "used", NewPassword: "password2"}).
+		Return(repository.ErrInvalidResetToken)
+
+	err := handler.ResetPassword(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), repository.ErrInvalidResetToken.Error())
+}
+
+func TestShopHandlerCreateItem(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/items", bytes.NewBufferString(`{"name":"sticker","price":5}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockShopService.EXPECT().
+		CreateItem(c.Request().Context(), &dto.CreateItemRequest{Name: "sticker", Price: 5}).
+		Return(&models.Item{Id: 11, Name: "sticker", Price: 5}, nil)
+
+	err := handler.CreateItem(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"id":11`)
+}
+
+func TestShopHandlerUpdateItem_NotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPatch, "/admin/items/42", bytes.NewBufferString(`{"price":15}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues("42")
+
+	mockShopService.EXPECT().
+		UpdateItem(c.Request().Context(), &dto.UpdateItemRequest{Id: 42, Price: 15}).
+		Return(nil, repository.ErrItemNotFound)
+
+	err := handler.UpdateItem(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestShopHandlerRequireRole(t *testing.T) {
+	tests := []struct {
+		name         string
+		role         string
+		expectedCode int
+	}{
+		{name: "admin allowed", role: models.RoleAdmin, expectedCode: http.StatusOK},
+		{name: "user forbidden", role: models.RoleUser, expectedCode: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockShopService := mocks.NewMockShopService(ctrl)
+			mockAuthService := mocks.NewMockAuthService(ctrl)
+
+			e := echo.New()
+			handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+			e.Use(handler.AuthMiddleware(), handler.RequireRole(models.RoleAdmin))
+
+			e.GET("/test", func(c echo.Context) error {
+				return c.String(http.StatusOK, "success")
+			})
+
+			mockAuthService.EXPECT().
+				ParseToken("valid-token").
+				Return(&auth.UserClaims{Id: 1, Role: tt.role, SessionId: "sid"}, nil)
+			mockAuthService.EXPECT().
+				CheckSession(gomock.Any(), "sid").
+				Return(nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set(authorizationHeader, "Bearer valid-token")
+			rec := httptest.NewRecorder()
+
+			e.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestShopHandlerSetUserRole(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/users/user2/role", bytes.NewBufferString(`{"role":"admin"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("username")
+	c.SetParamValues("user2")
+
+	mockShopService.EXPECT().
+		SetUserRole(c.Request().Context(), &dto.SetRoleRequest{Username: "user2", Role: models.RoleAdmin}).
+		Return(nil)
+
+	err := handler.SetUserRole(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestShopHandlerSetUserStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodPut, "/admin/users/user2/status", bytes.NewBufferString(`{"status":"blocked"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("username")
+	c.SetParamValues("user2")
+
+	mockShopService.EXPECT().
+		SetUserStatus(c.Request().Context(), &dto.SetStatusRequest{Username: "user2", Status: models.UserStatusBlocked}).
+		Return(nil)
+
+	err := handler.SetUserStatus(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestShopHandlerVerifyLedger(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockShopService := mocks.NewMockShopService(ctrl)
+	mockAuthService := mocks.NewMockAuthService(ctrl)
+
+	e := echo.New()
+	handler := NewShopHandler(mockShopService, mockAuthService, "8080", HandlerConfig{})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/ledger/verify", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	mockShopService.EXPECT().
+		VerifyLedger(c.Request().Context()).
+		Return(&dto.LedgerReport{
+			UnbalancedTransfers: []int{},
+			Discrepancies:       []dto.BalanceDiscrepancy{{UserId: 3, Username: "user3", Cached: 900, Ledger: 850}},
+		}, nil)
+
+	err := handler.VerifyLedger(c)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"balanced":false`)
+}
+
+func TestShopHandlerClientIp(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HandlerConfig
+		peer   string
+		want   string
+	}{
+		{
+			name: "no trusted proxies",
+			peer: "172.18.0.1:40000",
+			want: "172.18.0.1",
+		},
+		{
+			name:   "trusted proxy",
+			config: HandlerConfig{TrustedProxies: []string{"172.16.0.0/12"}},
+			peer:   "172.18.0.1:40000",
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "untrusted peer",
+			config: HandlerConfig{TrustedProxies: []string{"10.0.0.0/8"}},
+			peer:   "172.18.0.1:40000",
+			want:   "172.18.0.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.config.Validate())
+			handler := NewShopHandler(nil, nil, "8080", tt.config)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/auth", nil)
+			req.RemoteAddr = tt.peer
+			req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+
+			c := handler.GetEcho().NewContext(req, httptest.NewRecorder())
+			assert.Equal(t, tt.want, c.RealIP())
+		})
+	}
+
+	assert.ErrorIs(t, HandlerConfig{TrustedProxies: []string{"172.18.0.1"}}.Validate(), ErrInvalidTrustedProxy)
 }
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+)
+
+// defaultLanguage needs no catalog: English messages are the error texts.
+const defaultLanguage = "en"
+
+// errorMessages translates the messages of catalog codes. A language is
+// served once it is listed here; codes it lacks fall back to English.
+var errorMessages = map[string]map[string]string{
+	"ru": {
+		dto.CodeInternalError:    "внутренняя ошибка",
+		dto.CodeInvalidRequest:   "некорректный формат данных",
+		dto.CodeValidationFailed: "запрос не прошёл проверку",
+
+		dto.CodeTokenMissing:        "токен не передан",
+		dto.CodeInvalidAuthHeader:   "некорректный заголовок авторизации",
+		dto.CodeTokenExpired:        "срок действия токена истёк",
+		dto.CodeTokenNotValidYet:    "токен ещё не действителен",
+		dto.CodeMalformedToken:      "токен повреждён",
+		dto.CodeInvalidSignature:    "неверная подпись токена",
+		dto.CodeInvalidToken:        "недействительный токен",
+		dto.CodeSessionRevoked:      "сессия отозвана или истекла",
+		dto.CodeInvalidRefreshToken: "недействительный токен обновления",
+		dto.CodeForbidden:           "доступ запрещён",
+
+		dto.CodeInvalidCredentials:     "неверные учётные данные",
+		dto.CodeTooManyLoginAttempts:   "слишком много попыток входа",
+		dto.CodeUserAlreadyExists:      "пользователь уже существует",
+		dto.CodeUserNotFound:           "пользователь не найден",
+		dto.CodeInviteRequired:         "требуется код приглашения",
+		dto.CodeInvalidInvite:          "код приглашения недействителен или истёк",
+		dto.CodeUsernameTooShort:       "имя пользователя слишком короткое",
+		dto.CodeUsernameTooLong:        "имя пользователя слишком длинное",
+		dto.CodeUsernameCharacters:     "имя пользователя содержит недопустимые символы",
+		dto.CodeUsernameReserved:       "имя пользователя зарезервировано",
+		dto.CodePasswordTooShort:       "пароль слишком короткий",
+		dto.CodePasswordTooLong:        "пароль слишком длинный",
+		dto.CodePasswordTooCommon:      "пароль слишком распространённый",
+		dto.CodePasswordUnchanged:      "новый пароль должен отличаться от текущего",
+		dto.CodeCurrentPasswordMissing: "требуется текущий пароль",
+		dto.CodeResetTokenRequired:     "требуется токен сброса пароля",
+		dto.CodeInvalidResetToken:      "токен сброса пароля недействителен или истёк",
+		dto.CodeInvalidRole:            "роль должна быть одной из: user, admin",
+		dto.CodeInvalidStatus:          "статус должен быть одним из: active, blocked, disabled",
+
+		dto.CodeInsufficientFunds:     "недостаточно монет",
+		dto.CodeInvalidAmount:         "сумма должна быть положительным числом",
+		dto.CodeRecipientNotFound:     "получатель не найден",
+		dto.CodeSelfTransfer:          "нельзя отправить монеты самому себе",
+		dto.CodeRecipientBlocked:      "получатель заблокирован",
+		dto.CodeRecipientDisabled:     "аккаунт получателя отключён",
+		dto.CodeTransferLimitExceeded: "сумма превышает лимит одного перевода",
+		dto.CodeDailyLimitExceeded:    "превышен дневной лимит переводов",
+		dto.CodeItemNotFound:          "товар не найден",
+		dto.CodeItemAlreadyExists:     "товар уже существует",
+		dto.CodeOutOfStock:            "товар закончился",
+		dto.CodePurchaseLimitReached:  "достигнут лимит покупок товара",
+		dto.CodeItemNameRequired:      "не указано название товара",
+		dto.CodeInvalidQuantity:       "количество должно быть положительным числом не больше 1000",
+		dto.CodeOrderEmpty:            "в заказе нет товаров",
+		dto.CodeOrderTooLarge:         "в заказе слишком много товаров",
+		dto.CodeInvalidPrice:          "цена должна быть положительным числом",
+		dto.CodeInvalidItemId:         "некорректный идентификатор товара",
+		dto.CodeInvalidStock:          "остаток не может быть отрицательным",
+		dto.CodeInvalidPurchaseLimit:  "лимит покупок должен быть положительным числом",
+		dto.CodeInvalidIdempotencyKey: "ключ идемпотентности слишком длинный",
+		dto.CodeIdempotencyKeyReused:  "ключ идемпотентности уже использован для другого запроса",
+
+		dto.CodeInvalidSortField:  "sort должен быть одним из: id, price, name",
+		dto.CodeInvalidSortOrder:  "order должен быть одним из: asc, desc",
+		dto.CodeInvalidPriceRange: "некорректный диапазон цен",
+		dto.CodeInvalidLimit:      "limit должен быть от 1 до 100",
+		dto.CodeInvalidDirection:  "direction должен быть одним из: sent, received, purchases",
+		dto.CodeInvalidDateRange:  "некорректный диапазон дат",
+		dto.CodeInvalidCursor:     "некорректный курсор",
+	},
+}
+
+// localize returns the message of code in lang, or fallback when there is no
+// translation.
+func localize(lang, code, fallback string) string {
+	if message, ok := errorMessages[lang][code]; ok {
+		return message
+	}
+
+	return fallback
+}
+
+// negotiateLanguage picks the served language with the highest quality in
+// an Accept-Language header. Only the primary subtag is compared, so "ru-RU"
+// is served "ru".
+func negotiateLanguage(header string) string {
+	lang, best := defaultLanguage, 0.0
+
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = q
+		}
+
+		if quality <= best {
+			continue
+		}
+
+		if _, ok := errorMessages[primary]; ok || primary == defaultLanguage {
+			lang, best = primary, quality
+		}
+	}
+
+	return lang
+}
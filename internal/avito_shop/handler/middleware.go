@@ -1,16 +1,31 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
-	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	authorizationHeader = "Authorization"
+	authorizationHeader      = "Authorization"
+	wwwAuthenticateHeader    = "WWW-Authenticate"
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	retryAfterHeader         = "Retry-After"
+)
+
+const (
+	bearerScheme = "Bearer"
+	authRealm    = "avito_shop"
+
+	bearerErrorInvalidRequest = "invalid_request"
+	bearerErrorInvalidToken   = "invalid_token"
 )
 
 func (h *ShopHandler) AuthMiddleware() echo.MiddlewareFunc {
@@ -20,23 +35,74 @@ func (h *ShopHandler) AuthMiddleware() echo.MiddlewareFunc {
 
 			header := ctx.Request().Header.Get(authorizationHeader)
 			if header == "" {
-				return ctx.JSON(http.StatusUnauthorized, dto.UnauthorizedResponse{Errors: ErrEmptyToken.Error()})
+				return unauthorized(ctx, "", ErrEmptyToken)
 			}
 
-			headerSplit := strings.Split(header, " ")
-			if len(headerSplit) != 2 {
-				return ctx.JSON(http.StatusUnauthorized, dto.UnauthorizedResponse{Errors: ErrInvalidAuthHeader.Error()})
+			scheme, token, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, bearerScheme) || token == "" || strings.Contains(token, " ") {
+				return unauthorized(ctx, bearerErrorInvalidRequest, ErrInvalidAuthHeader)
 			}
 
-			id, err := h.auth.ParseToken(headerSplit[1])
+			claims, err := h.auth.ParseToken(token)
 			if err != nil {
-				logrus.WithFields(logrus.Fields{"event": op}).Error(err)
+				// Only failures clients can act on are told apart, the rest
+				// are reported as a plain invalid token.
+				if spec, ok := lookupError(err); !ok || spec.status != http.StatusUnauthorized {
+					logrus.WithFields(logrus.Fields{"event": op}).Warn(err)
+					err = ErrInvalidToken
+				}
 
-				return ctx.JSON(http.StatusInternalServerError, dto.InternalServerErrorResponse{Errors: ErrInternalServer.Error()})
+				return unauthorized(ctx, bearerErrorInvalidToken, err)
 			}
 
-			ctx.Set("id", id)
+			// Legacy tokens without a session have nothing to look up.
+			if claims.SessionId != "" {
+				err = h.auth.CheckSession(ctx.Request().Context(), claims.SessionId)
+				if err != nil && errors.Is(err, auth.ErrSessionRevoked) {
+					return unauthorized(ctx, bearerErrorInvalidToken, err)
+				}
+
+				if err != nil {
+					return respondError(ctx, err, logrus.Fields{"event": op})
+				}
+			}
+
+			ctx.Set("id", claims.Id)
+			ctx.Set("role", claims.Role)
+			ctx.Set("sid", claims.SessionId)
 			return next(ctx)
 		}
 	}
 }
+
+// unauthorized writes a 401 with an RFC 6750 challenge. bearerError is left
+// empty when the request carried no credentials at all.
+func unauthorized(ctx echo.Context, bearerError string, err error) error {
+	challenge := fmt.Sprintf(`%s realm="%s"`, bearerScheme, authRealm)
+	if bearerError != "" {
+		challenge += fmt.Sprintf(`, error="%s", error_description="%s"`, bearerError, err.Error())
+	}
+
+	ctx.Response().Header().Set(wwwAuthenticateHeader, challenge)
+
+	return respondError(ctx, err, nil)
+}
+
+// RequireRole must be mounted after AuthMiddleware: it relies on the role
+// extracted from the token.
+func (h *ShopHandler) RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			const op = "internal.avito_shop.handler.RequireRole"
+
+			role, ok := ctx.Get("role").(string)
+			if ok && slices.Contains(roles, role) {
+				return next(ctx)
+			}
+
+			logrus.WithFields(logrus.Fields{"event": op, "id": ctx.Get("id"), "role": role}).Warn(ErrForbidden)
+
+			return respondError(ctx, ErrForbidden, nil)
+		}
+	}
+}
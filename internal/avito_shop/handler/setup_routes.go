@@ -1,12 +1,35 @@
 package handler
 
+import "github.com/dgt4l/avito_shop/internal/avito_shop/models"
+
 func RegisterRoutes(h *ShopHandler) {
+	h.e.GET("/.well-known/jwks.json", h.JWKS)
+
 	authRouter := h.e.Group("/api")
 	authRouter.POST("/auth", h.AuthUser)
+	authRouter.POST("/auth/refresh", h.RefreshToken)
+	authRouter.POST("/register", h.Register)
+	authRouter.POST("/password/reset", h.ResetPassword)
 	authRouter.GET("/ping", h.Ping)
+	authRouter.GET("/items", h.GetItems)
 
 	router := h.e.Group("/api", h.AuthMiddleware())
+	router.POST("/auth/logout", h.Logout)
+	router.POST("/me/password", h.ChangePassword)
 	router.GET("/info", h.GetInfo)
+	router.GET("/history", h.GetHistory)
 	router.GET("/buy", h.BuyItem)
+	router.POST("/orders", h.CreateOrder)
 	router.POST("/sendCoin", h.SendCoin)
+
+	adminRouter := h.e.Group("/api/admin", h.AuthMiddleware(), h.RequireRole(models.RoleAdmin))
+	adminRouter.POST("/items", h.CreateItem)
+	adminRouter.PATCH("/items/:id", h.UpdateItem)
+	adminRouter.PUT("/items/:id/limits", h.SetItemLimits)
+	adminRouter.DELETE("/items/:id", h.RetireItem)
+	adminRouter.PUT("/users/:username/role", h.SetUserRole)
+	adminRouter.PUT("/users/:username/status", h.SetUserStatus)
+	adminRouter.POST("/users/:username/password-reset", h.CreatePasswordReset)
+	adminRouter.GET("/ledger/verify", h.VerifyLedger)
+	adminRouter.POST("/invites", h.CreateInvite)
 }
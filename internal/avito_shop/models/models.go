@@ -1,13 +1,31 @@
 package models
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Account statuses. Blocked accounts are suspended by an admin, disabled ones
+// are closed; neither can receive coins.
+const (
+	UserStatusActive   = "active"
+	UserStatusBlocked  = "blocked"
+	UserStatusDisabled = "disabled"
+)
+
 type User struct {
 	Id       int    `json:"id" db:"id"`
 	Username string `json:"username" db:"username"`
 	Password string `json:"password" db:"password_salt"`
+	Role     string `json:"role" db:"role"`
+	Status   string `json:"status" db:"status"`
 }
 
+// Item.Stock and Item.MaxPerUser are nil when the item is not limited.
 type Item struct {
-	Id    int    `json:"id" db:"id"`
-	Name  string `json:"name" db:"name"`
-	Price int    `json:"price" db:"price"`
+	Id         int    `json:"id" db:"id"`
+	Name       string `json:"name" db:"name"`
+	Price      int    `json:"price" db:"price"`
+	Stock      *int   `json:"stock" db:"stock"`
+	MaxPerUser *int   `json:"maxPerUser" db:"max_per_user"`
 }
@@ -0,0 +1,817 @@
+// Package contract holds the behaviour every repository implementation has to
+// share. Each implementation runs Run from its own tests.
+package contract
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/controller"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// DefaultCoins is the balance the repositories under test must grant to new
+// users.
+const DefaultCoins = 1000
+
+// Repository is everything the service keeps in storage.
+type Repository interface {
+	controller.Repository
+	auth.SessionStore
+	auth.LoginAttemptStore
+}
+
+// Run checks repo against the contract. newRepository is called once per
+// case and must return an empty repository granting DefaultCoins.
+func Run(t *testing.T, newRepository func(t *testing.T) Repository) {
+	cases := []struct {
+		name string
+		run  func(*testing.T, Repository)
+	}{
+		{"Users", testUsers},
+		{"UserAdmin", testUserAdmin},
+		{"Passwords", testPasswords},
+		{"Invites", testInvites},
+		{"Items", testItems},
+		{"BuyItem", testBuyItem},
+		{"CreateOrder", testCreateOrder},
+		{"SendCoin", testSendCoin},
+		{"Idempotency", testIdempotency},
+		{"GetInfo", testGetInfo},
+		{"GetHistory", testGetHistory},
+		{"Sessions", testSessions},
+		{"LoginAttempts", testLoginAttempts},
+		{"ConcurrentTransfers", testConcurrentTransfers},
+		{"ConcurrentPurchases", testConcurrentPurchases},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.run(t, newRepository(t))
+		})
+	}
+}
+
+func testUsers(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	id := createUser(t, repo, "user1")
+
+	user, err := repo.GetUser(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, &models.User{
+		Id: id, Username: "user1", Password: "hash", Role: models.RoleUser, Status: models.UserStatusActive,
+	}, user)
+
+	user, err = repo.GetUserById(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, "user1", user.Username)
+
+	_, err = repo.CreateUser(ctx, "user1", "other")
+	assert.ErrorIs(t, err, repository.ErrUserAlreadyExists)
+
+	_, err = repo.GetUser(ctx, "nobody")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	_, err = repo.GetUserById(ctx, id+100)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	assert.Equal(t, DefaultCoins, coins(t, repo, id))
+	assertLedgerBalanced(t, repo)
+}
+
+func testUserAdmin(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	createUser(t, repo, "user1")
+
+	require.NoError(t, repo.SetUserRole(ctx, "user1", models.RoleAdmin))
+	require.NoError(t, repo.SetUserStatus(ctx, "user1", models.UserStatusBlocked))
+
+	user, err := repo.GetUser(ctx, "user1")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	assert.Equal(t, models.UserStatusBlocked, user.Status)
+
+	assert.ErrorIs(t, repo.SetUserRole(ctx, "nobody", models.RoleAdmin), repository.ErrUserNotFound)
+	assert.ErrorIs(t, repo.SetUserStatus(ctx, "nobody", models.UserStatusBlocked), repository.ErrUserNotFound)
+}
+
+func testPasswords(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	id := createUser(t, repo, "user1")
+	admin := createUser(t, repo, "admin")
+
+	require.NoError(t, repo.RehashPassword(ctx, id, "stale", "rehashed"))
+	assert.Equal(t, "hash", password(t, repo, "user1"))
+
+	require.NoError(t, repo.RehashPassword(ctx, id, "hash", "rehashed"))
+	assert.Equal(t, "rehashed", password(t, repo, "user1"))
+
+	require.NoError(t, repo.UpdatePassword(ctx, id, "changed"))
+	assert.Equal(t, "changed", password(t, repo, "user1"))
+	assert.ErrorIs(t, repo.UpdatePassword(ctx, id+100, "changed"), repository.ErrUserNotFound)
+
+	expiresAt := time.Now().Add(time.Hour)
+	require.NoError(t, repo.CreatePasswordReset(ctx, "user1", "token-1", admin, expiresAt))
+	require.NoError(t, repo.CreatePasswordReset(ctx, "user1", "token-2", admin, expiresAt))
+	assert.ErrorIs(t, repo.CreatePasswordReset(ctx, "nobody", "token-3", admin, expiresAt), repository.ErrUserNotFound)
+
+	_, err := repo.ResetPassword(ctx, "token-1", "reset")
+	assert.ErrorIs(t, err, repository.ErrInvalidResetToken, "a newer token invalidates older ones")
+
+	userId, err := repo.ResetPassword(ctx, "token-2", "reset")
+	require.NoError(t, err)
+	assert.Equal(t, id, userId)
+	assert.Equal(t, "reset", password(t, repo, "user1"))
+
+	_, err = repo.ResetPassword(ctx, "token-2", "again")
+	assert.ErrorIs(t, err, repository.ErrInvalidResetToken, "a token is redeemed once")
+
+	require.NoError(t, repo.CreatePasswordReset(ctx, "user1", "token-4", admin, time.Now().Add(-time.Minute)))
+	_, err = repo.ResetPassword(ctx, "token-4", "expired")
+	assert.ErrorIs(t, err, repository.ErrInvalidResetToken)
+}
+
+func testInvites(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	admin := createUser(t, repo, "admin")
+	require.NoError(t, repo.CreateInvite(ctx, "invite-1", admin, time.Now().Add(time.Hour)))
+	require.NoError(t, repo.CreateInvite(ctx, "expired", admin, time.Now().Add(-time.Minute)))
+
+	id, err := repo.CreateInvitedUser(ctx, "user1", "hash", "invite-1")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCoins, coins(t, repo, id))
+
+	_, err = repo.CreateInvitedUser(ctx, "user2", "hash", "invite-1")
+	assert.ErrorIs(t, err, repository.ErrInvalidInvite)
+
+	_, err = repo.CreateInvitedUser(ctx, "user2", "hash", "expired")
+	assert.ErrorIs(t, err, repository.ErrInvalidInvite)
+
+	_, err = repo.CreateInvitedUser(ctx, "user2", "hash", "unknown")
+	assert.ErrorIs(t, err, repository.ErrInvalidInvite)
+
+	_, err = repo.GetUser(ctx, "user2")
+	assert.ErrorIs(t, err, repository.ErrUserNotFound, "a rejected invite leaves no user behind")
+
+	_, err = repo.CreateInvitedUser(ctx, "user1", "hash", "invite-1")
+	assert.ErrorIs(t, err, repository.ErrUserAlreadyExists)
+
+	assertLedgerBalanced(t, repo)
+}
+
+func testItems(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	cup := createItem(t, repo, "cup", 20, nil, nil)
+	book := createItem(t, repo, "book", 50, intPtr(0), nil)
+	pen := createItem(t, repo, "pen", 10, intPtr(5), intPtr(2))
+
+	assert.Equal(t, &models.Item{Id: pen.Id, Name: "pen", Price: 10, Stock: intPtr(5), MaxPerUser: intPtr(2)}, pen)
+
+	_, err := repo.CreateItem(ctx, &models.Item{Name: "cup", Price: 30})
+	assert.ErrorIs(t, err, repository.ErrItemAlreadyExists)
+
+	items, err := repo.GetItems(ctx, &dto.ItemsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.Item{
+		{Id: cup.Id, Name: "cup", Price: 20, Available: true},
+		{Id: book.Id, Name: "book", Price: 50, Stock: intPtr(0), Available: false},
+		{Id: pen.Id, Name: "pen", Price: 10, Stock: intPtr(5), MaxPerUser: intPtr(2), Available: true},
+	}, items)
+
+	items, err = repo.GetItems(ctx, &dto.ItemsRequest{SortBy: dto.SortByPrice, Order: dto.OrderDesc})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"book", "cup", "pen"}, itemNames(items))
+
+	items, err = repo.GetItems(ctx, &dto.ItemsRequest{SortBy: dto.SortByName, MinPrice: 15, MaxPrice: 50})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"book", "cup"}, itemNames(items))
+
+	updated, err := repo.UpdateItemPrice(ctx, cup.Id, 25)
+	require.NoError(t, err)
+	assert.Equal(t, 25, updated.Price)
+
+	updated, err = repo.SetItemLimits(ctx, cup.Id, intPtr(3), nil)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Item{Id: cup.Id, Name: "cup", Price: 25, Stock: intPtr(3)}, updated)
+
+	require.NoError(t, repo.RetireItem(ctx, cup.Id))
+	assert.ErrorIs(t, repo.RetireItem(ctx, cup.Id), repository.ErrItemNotFound)
+
+	_, err = repo.UpdateItemPrice(ctx, cup.Id, 30)
+	assert.ErrorIs(t, err, repository.ErrItemNotFound)
+
+	_, err = repo.SetItemLimits(ctx, cup.Id+100, nil, nil)
+	assert.ErrorIs(t, err, repository.ErrItemNotFound)
+
+	items, err = repo.GetItems(ctx, &dto.ItemsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"book", "pen"}, itemNames(items))
+
+	_, err = repo.CreateItem(ctx, &models.Item{Name: "cup", Price: 30})
+	assert.ErrorIs(t, err, repository.ErrItemAlreadyExists, "retired names stay taken")
+}
+
+func testBuyItem(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	id := createUser(t, repo, "user1")
+	createItem(t, repo, "cup", 20, nil, nil)
+	createItem(t, repo, "pen", 10, intPtr(3), nil)
+	createItem(t, repo, "book", 50, nil, intPtr(1))
+	createItem(t, repo, "car", DefaultCoins+1, nil, nil)
+
+	response, err := repo.BuyItem(ctx, id, "cup", 2, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 40, response.Total)
+	require.Len(t, response.Purchases, 1)
+	assert.Equal(t, dto.Purchase{Id: response.Purchases[0].Id, Item: "cup", Quantity: 2, Amount: 40, CreatedAt: response.Purchases[0].CreatedAt}, response.Purchases[0])
+	assert.False(t, response.Replayed)
+
+	_, err = repo.BuyItem(ctx, id, "pen", 4, nil)
+	assert.ErrorIs(t, err, repository.ErrOutOfStock)
+
+	_, err = repo.BuyItem(ctx, id, "pen", 3, nil)
+	require.NoError(t, err)
+
+	_, err = repo.BuyItem(ctx, id, "pen", 1, nil)
+	assert.ErrorIs(t, err, repository.ErrOutOfStock)
+
+	_, err = repo.BuyItem(ctx, id, "book", 1, nil)
+	require.NoError(t, err)
+
+	_, err = repo.BuyItem(ctx, id, "book", 1, nil)
+	assert.ErrorIs(t, err, repository.ErrPurchaseLimitReached)
+
+	_, err = repo.BuyItem(ctx, id, "car", 1, nil)
+	assert.ErrorIs(t, err, repository.ErrNotEnoughCoins)
+
+	_, err = repo.BuyItem(ctx, id, "unknown", 1, nil)
+	assert.ErrorIs(t, err, repository.ErrItemNotFound)
+
+	_, err = repo.BuyItem(ctx, id+100, "cup", 1, nil)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	info, err := repo.GetInfo(ctx, &dto.InfoRequest{Id: id})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCoins-40-30-50, info.Coins)
+	assert.ElementsMatch(t, []dto.Inventory{
+		{Type: "cup", Quantity: 2},
+		{Type: "pen", Quantity: 3},
+		{Type: "book", Quantity: 1},
+	}, info.Inventory)
+
+	assertLedgerBalanced(t, repo)
+}
+
+func testCreateOrder(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	id := createUser(t, repo, "user1")
+	createItem(t, repo, "cup", 20, nil, nil)
+	createItem(t, repo, "pen", 10, intPtr(1), nil)
+
+	response, err := repo.CreateOrder(ctx, id, []dto.OrderItem{
+		{Item: "pen", Quantity: 1},
+		{Item: "cup", Quantity: 1},
+		{Item: "cup", Quantity: 2},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 70, response.Total)
+	require.Len(t, response.Purchases, 2)
+	assert.Equal(t, "cup", response.Purchases[0].Item)
+	assert.Equal(t, 3, response.Purchases[0].Quantity)
+	assert.Equal(t, "pen", response.Purchases[1].Item)
+
+	_, err = repo.CreateOrder(ctx, id, []dto.OrderItem{{Item: "cup", Quantity: 1}, {Item: "pen", Quantity: 1}}, nil)
+	assert.ErrorIs(t, err, repository.ErrOutOfStock)
+
+	_, err = repo.CreateOrder(ctx, id, []dto.OrderItem{{Item: "cup", Quantity: 1}, {Item: "unknown", Quantity: 1}}, nil)
+	assert.ErrorIs(t, err, repository.ErrItemNotFound)
+
+	_, err = repo.CreateOrder(ctx, id, []dto.OrderItem{{Item: "cup", Quantity: 100}}, nil)
+	assert.ErrorIs(t, err, repository.ErrNotEnoughCoins)
+
+	info, err := repo.GetInfo(ctx, &dto.InfoRequest{Id: id})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCoins-70, info.Coins, "failed orders change nothing")
+	assert.ElementsMatch(t, []dto.Inventory{{Type: "cup", Quantity: 3}, {Type: "pen", Quantity: 1}}, info.Inventory)
+
+	assertLedgerBalanced(t, repo)
+}
+
+func testSendCoin(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	sender := createUser(t, repo, "user1")
+	recipient := createUser(t, repo, "user2")
+
+	response, err := repo.SendCoin(ctx, "user2", sender, 100, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "user2", response.ToUser)
+	assert.Equal(t, 100, response.Amount)
+	assert.NotZero(t, response.Id)
+	assert.WithinDuration(t, time.Now(), response.CreatedAt, time.Minute)
+
+	_, err = repo.SendCoin(ctx, "nobody", sender, 100, 0, nil)
+	assert.ErrorIs(t, err, repository.ErrUserToNotFound)
+
+	_, err = repo.SendCoin(ctx, "user2", recipient+100, 100, 0, nil)
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+
+	_, err = repo.SendCoin(ctx, "user2", sender, DefaultCoins, 0, nil)
+	assert.ErrorIs(t, err, repository.ErrNotEnoughCoins)
+
+	_, err = repo.SendCoin(ctx, "user2", sender, 100, 250, nil)
+	require.NoError(t, err)
+
+	_, err = repo.SendCoin(ctx, "user2", sender, 100, 250, nil)
+	assert.ErrorIs(t, err, repository.ErrDailyTransferLimit)
+
+	_, err = repo.SendCoin(ctx, "user1", recipient, 50, 250, nil)
+	require.NoError(t, err, "the limit is per sender")
+
+	assert.Equal(t, DefaultCoins-200+50, coins(t, repo, sender))
+	assert.Equal(t, DefaultCoins+200-50, coins(t, repo, recipient))
+
+	require.NoError(t, repo.SetUserStatus(ctx, "user2", models.UserStatusBlocked))
+	_, err = repo.SendCoin(ctx, "user2", sender, 10, 0, nil)
+	assert.ErrorIs(t, err, repository.ErrRecipientBlocked)
+
+	require.NoError(t, repo.SetUserStatus(ctx, "user2", models.UserStatusDisabled))
+	_, err = repo.SendCoin(ctx, "user2", sender, 10, 0, nil)
+	assert.ErrorIs(t, err, repository.ErrRecipientDisabled)
+	assert.Equal(t, DefaultCoins-200+50, coins(t, repo, sender), "rejected transfers move no coins")
+
+	assertLedgerBalanced(t, repo)
+}
+
+func testIdempotency(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	sender := createUser(t, repo, "user1")
+	createUser(t, repo, "user2")
+	createItem(t, repo, "cup", 20, nil, nil)
+
+	sendKey := &dto.IdempotencyKey{Key: "key-1", Operation: "sendCoin", RequestHash: "hash-1"}
+
+	sent, err := repo.SendCoin(ctx, "user2", sender, 100, 0, sendKey)
+	require.NoError(t, err)
+
+	replayed, err := repo.SendCoin(ctx, "user2", sender, 100, 0, sendKey)
+	require.NoError(t, err)
+	assert.True(t, replayed.Replayed)
+	assert.Equal(t, sent.Id, replayed.Id)
+	assert.True(t, sent.CreatedAt.Equal(replayed.CreatedAt))
+	assert.Equal(t, DefaultCoins-100, coins(t, repo, sender), "a replay moves no coins")
+
+	var stored dto.SendCoinResponse
+	found, err := repo.GetIdempotentResponse(ctx, sender, sendKey, &stored)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, sent.Id, stored.Id)
+
+	found, err = repo.GetIdempotentResponse(ctx, sender, &dto.IdempotencyKey{Key: "key-0", Operation: "sendCoin"}, &stored)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, err = repo.GetIdempotentResponse(ctx, sender, &dto.IdempotencyKey{Key: "key-1", Operation: "buyItem", RequestHash: "hash-1"}, &stored)
+	assert.ErrorIs(t, err, repository.ErrIdempotencyKeyReused)
+
+	_, err = repo.SendCoin(ctx, "user2", sender, 200, 0, &dto.IdempotencyKey{Key: "key-1", Operation: "sendCoin", RequestHash: "hash-2"})
+	assert.ErrorIs(t, err, repository.ErrIdempotencyKeyReused)
+
+	_, err = repo.BuyItem(ctx, sender, "cup", 1, &dto.IdempotencyKey{Key: "key-1", Operation: "buyItem", RequestHash: "hash-1"})
+	assert.ErrorIs(t, err, repository.ErrIdempotencyKeyReused)
+
+	buyKey := &dto.IdempotencyKey{Key: "key-2", Operation: "buyItem", RequestHash: "hash-1"}
+
+	_, err = repo.BuyItem(ctx, sender, "unknown", 1, buyKey)
+	assert.ErrorIs(t, err, repository.ErrItemNotFound)
+
+	bought, err := repo.BuyItem(ctx, sender, "cup", 1, buyKey)
+	require.NoError(t, err, "a failed request does not consume its key")
+
+	rebought, err := repo.BuyItem(ctx, sender, "cup", 1, buyKey)
+	require.NoError(t, err)
+	assert.True(t, rebought.Replayed)
+	assert.Equal(t, bought.Total, rebought.Total)
+	assert.Equal(t, bought.Purchases[0].Id, rebought.Purchases[0].Id)
+	assert.Equal(t, DefaultCoins-100-20, coins(t, repo, sender))
+}
+
+func testGetInfo(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	user1 := createUser(t, repo, "user1")
+	user2 := createUser(t, repo, "user2")
+	user3 := createUser(t, repo, "user3")
+	createItem(t, repo, "cup", 20, nil, nil)
+
+	for _, transfer := range []struct {
+		from   int
+		to     string
+		amount int
+	}{
+		{user2, "user1", 10},
+		{user3, "user1", 30},
+		{user2, "user1", 15},
+		{user1, "user3", 5},
+	} {
+		_, err := repo.SendCoin(ctx, transfer.to, transfer.from, transfer.amount, 0, nil)
+		require.NoError(t, err)
+	}
+
+	_, err := repo.BuyItem(ctx, user1, "cup", 1, nil)
+	require.NoError(t, err)
+
+	info, err := repo.GetInfo(ctx, &dto.InfoRequest{Id: user1})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCoins+10+30+15-5-20, info.Coins)
+	assert.Equal(t, []dto.Inventory{{Type: "cup", Quantity: 1}}, info.Inventory)
+	assert.Nil(t, info.CoinTotals)
+	assert.Equal(t, []string{"user2", "user3", "user2"}, receivedFrom(info.CoinHistory.Received))
+	assert.Equal(t, []int{15, 30, 10}, receivedAmounts(info.CoinHistory.Received))
+	require.Len(t, info.CoinHistory.Sent, 1)
+	assert.Equal(t, "user3", info.CoinHistory.Sent[0].ToUser)
+	require.Len(t, info.CoinHistory.Purchases, 1)
+	assert.Equal(t, "cup", info.CoinHistory.Purchases[0].Item)
+
+	info, err = repo.GetInfo(ctx, &dto.InfoRequest{Id: user1, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []int{15, 30}, receivedAmounts(info.CoinHistory.Received))
+
+	info, err = repo.GetInfo(ctx, &dto.InfoRequest{Id: user1, Aggregate: true})
+	require.NoError(t, err)
+	require.NotNil(t, info.CoinTotals)
+	assert.Equal(t, []dto.CounterpartyTotal{
+		{User: "user3", Amount: 30, Count: 1},
+		{User: "user2", Amount: 25, Count: 2},
+	}, info.CoinTotals.Received)
+	assert.Equal(t, []dto.CounterpartyTotal{{User: "user3", Amount: 5, Count: 1}}, info.CoinTotals.Sent)
+	assert.Empty(t, info.CoinHistory.Received)
+
+	info, err = repo.GetInfo(ctx, &dto.InfoRequest{Id: user1, Aggregate: true, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []dto.CounterpartyTotal{{User: "user3", Amount: 30, Count: 1}}, info.CoinTotals.Received)
+
+	info, err = repo.GetInfo(ctx, &dto.InfoRequest{Id: user2})
+	require.NoError(t, err)
+	assert.Empty(t, info.Inventory)
+	assert.Empty(t, info.CoinHistory.Received)
+	assert.Empty(t, info.CoinHistory.Purchases)
+
+	_, err = repo.GetInfo(ctx, &dto.InfoRequest{Id: user3 + 100})
+	assert.ErrorIs(t, err, repository.ErrUserNotFound)
+}
+
+func testGetHistory(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	user1 := createUser(t, repo, "user1")
+	user2 := createUser(t, repo, "user2")
+	createUser(t, repo, "user3")
+	createItem(t, repo, "cup", 20, nil, nil)
+
+	_, err := repo.SendCoin(ctx, "user2", user1, 10, 0, nil)
+	require.NoError(t, err)
+	_, err = repo.SendCoin(ctx, "user1", user2, 20, 0, nil)
+	require.NoError(t, err)
+	_, err = repo.SendCoin(ctx, "user3", user1, 30, 0, nil)
+	require.NoError(t, err)
+	_, err = repo.BuyItem(ctx, user1, "cup", 2, nil)
+	require.NoError(t, err)
+
+	entries, err := repo.GetHistory(ctx, &dto.HistoryFilter{UserId: user1, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	for i := 1; i < len(entries); i++ {
+		assert.False(t, entries[i].CreatedAt.After(entries[i-1].CreatedAt), "entries are latest first")
+	}
+
+	amounts := make(map[string][]int)
+	for _, entry := range entries {
+		amounts[entry.Type] = append(amounts[entry.Type], entry.Amount)
+	}
+	assert.ElementsMatch(t, []int{10, 30}, amounts[dto.HistoryTypeSent])
+	assert.Equal(t, []int{20}, amounts[dto.HistoryTypeReceived])
+	assert.Equal(t, []int{40}, amounts[dto.HistoryTypePurchase])
+
+	entries, err = repo.GetHistory(ctx, &dto.HistoryFilter{UserId: user1, Type: dto.HistoryTypePurchase, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, dto.HistoryEntry{
+		Id: entries[0].Id, Type: dto.HistoryTypePurchase, Item: "cup", Quantity: 2, Amount: 40, CreatedAt: entries[0].CreatedAt,
+	}, entries[0])
+
+	entries, err = repo.GetHistory(ctx, &dto.HistoryFilter{UserId: user1, Counterparty: "user2", Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	future := time.Now().Add(time.Hour)
+	entries, err = repo.GetHistory(ctx, &dto.HistoryFilter{UserId: user1, From: &future, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.NotNil(t, entries)
+
+	var paged []dto.HistoryEntry
+	filter := &dto.HistoryFilter{UserId: user1, Limit: 3}
+	for {
+		page, err := repo.GetHistory(ctx, filter)
+		require.NoError(t, err)
+		if len(page) == 0 {
+			break
+		}
+
+		paged = append(paged, page...)
+		last := page[len(page)-1]
+		filter.After = &dto.HistoryCursor{CreatedAt: last.CreatedAt, Type: last.Type, Id: last.Id}
+	}
+
+	all, err := repo.GetHistory(ctx, &dto.HistoryFilter{UserId: user1, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, all, paged)
+}
+
+func testSessions(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	id := createUser(t, repo, "user1")
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	for _, sessionId := range []string{"sid-1", "sid-2", "sid-3"} {
+		require.NoError(t, repo.CreateSession(ctx, &auth.Session{Id: sessionId, UserId: id, RefreshHash: "hash", ExpiresAt: expiresAt}))
+	}
+
+	session, err := repo.GetSession(ctx, "sid-1")
+	require.NoError(t, err)
+	assert.Equal(t, "user1", session.Username)
+	assert.Equal(t, "hash", session.RefreshHash)
+	assert.True(t, expiresAt.Equal(session.ExpiresAt))
+	assert.Nil(t, session.RevokedAt)
+
+	_, err = repo.GetSession(ctx, "unknown")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+
+	rotated, err := repo.RotateSession(ctx, "sid-1", "hash", "hash-2", expiresAt.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, rotated)
+
+	rotated, err = repo.RotateSession(ctx, "sid-1", "hash", "hash-3", expiresAt)
+	require.NoError(t, err)
+	assert.False(t, rotated, "a refresh hash rotates once")
+
+	require.NoError(t, repo.RevokeSession(ctx, "sid-1"))
+	session, err = repo.GetSession(ctx, "sid-1")
+	require.NoError(t, err)
+	assert.NotNil(t, session.RevokedAt)
+
+	rotated, err = repo.RotateSession(ctx, "sid-1", "hash-2", "hash-3", expiresAt)
+	require.NoError(t, err)
+	assert.False(t, rotated, "revoked sessions do not rotate")
+
+	require.NoError(t, repo.RevokeUserSessions(ctx, id, "sid-2"))
+	session, err = repo.GetSession(ctx, "sid-2")
+	require.NoError(t, err)
+	assert.Nil(t, session.RevokedAt)
+	session, err = repo.GetSession(ctx, "sid-3")
+	require.NoError(t, err)
+	assert.NotNil(t, session.RevokedAt)
+}
+
+func testLoginAttempts(t *testing.T, repo Repository) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	attempts, err := repo.GetLoginAttempts(ctx, "user:user1")
+	require.NoError(t, err)
+	assert.Equal(t, &auth.LoginAttempts{Key: "user:user1"}, attempts)
+
+	for i := 1; i <= 3; i++ {
+		attempts, err = repo.RecordLoginFailure(ctx, "user:user1", now, time.Minute)
+		require.NoError(t, err)
+		assert.Equal(t, i, attempts.Failures)
+	}
+
+	attempts, err = repo.GetLoginAttempts(ctx, "user:user1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts.Failures)
+	assert.True(t, now.Equal(attempts.LastFailureAt))
+
+	later := now.Add(2 * time.Minute)
+	attempts, err = repo.RecordLoginFailure(ctx, "user:user1", later, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts.Failures, "failures outside the window are forgotten")
+	assert.True(t, later.Equal(attempts.LastFailureAt))
+
+	attempts, err = repo.RecordLoginFailure(ctx, "user:user1", later, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts.Failures)
+
+	require.NoError(t, repo.ReleaseLoginAttempt(ctx, "user:user1"))
+	attempts, err = repo.GetLoginAttempts(ctx, "user:user1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts.Failures, "a released attempt is taken back")
+
+	require.NoError(t, repo.ReleaseLoginAttempt(ctx, "user:user1"))
+	attempts, err = repo.GetLoginAttempts(ctx, "user:user1")
+	require.NoError(t, err)
+	assert.Equal(t, &auth.LoginAttempts{Key: "user:user1"}, attempts, "the last released attempt drops the counter")
+
+	require.NoError(t, repo.ReleaseLoginAttempt(ctx, "user:user1"), "unknown keys are ignored")
+
+	_, err = repo.RecordLoginFailure(ctx, "user:user1", later, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, repo.ResetLoginAttempts(ctx, "user:user1"))
+	attempts, err = repo.GetLoginAttempts(ctx, "user:user1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempts.Failures)
+}
+
+// testConcurrentTransfers sends coins back and forth between two users, the
+// pattern that deadlocks when rows are locked in request order.
+func testConcurrentTransfers(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	user1 := createUser(t, repo, "user1")
+	user2 := createUser(t, repo, "user2")
+
+	const transfers = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*transfers)
+	for range transfers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := repo.SendCoin(ctx, "user2", user1, 10, 0, nil)
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := repo.SendCoin(ctx, "user1", user2, 10, 0, nil)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, DefaultCoins, coins(t, repo, user1))
+	assert.Equal(t, DefaultCoins, coins(t, repo, user2))
+	assertLedgerBalanced(t, repo)
+}
+
+// testConcurrentPurchases races more buyers than there is stock and coins.
+func testConcurrentPurchases(t *testing.T, repo Repository) {
+	ctx := context.Background()
+
+	const buyers = 6
+
+	ids := make([]int, buyers)
+	for i := range ids {
+		ids[i] = createUser(t, repo, fmt.Sprintf("buyer%d", i))
+	}
+	createItem(t, repo, "pen", 10, intPtr(3), nil)
+	createItem(t, repo, "car", DefaultCoins/2, nil, nil)
+
+	spender := ids[0]
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		bought    int
+		purchases int
+	)
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.BuyItem(ctx, id, "pen", 1, nil)
+			if err != nil {
+				assert.ErrorIs(t, err, repository.ErrOutOfStock)
+				return
+			}
+
+			mu.Lock()
+			bought++
+			mu.Unlock()
+		}()
+	}
+
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.BuyItem(ctx, spender, "car", 1, nil)
+			if err != nil {
+				assert.ErrorIs(t, err, repository.ErrNotEnoughCoins)
+				return
+			}
+
+			mu.Lock()
+			purchases++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, bought)
+	assert.LessOrEqual(t, purchases, 2)
+	assert.GreaterOrEqual(t, coins(t, repo, spender), 0)
+
+	items, err := repo.GetItems(ctx, &dto.ItemsRequest{SortBy: dto.SortByName})
+	require.NoError(t, err)
+	assert.Equal(t, intPtr(0), items[1].Stock)
+	assertLedgerBalanced(t, repo)
+}
+
+func createUser(t *testing.T, repo Repository, username string) int {
+	t.Helper()
+
+	id, err := repo.CreateUser(context.Background(), username, "hash")
+	require.NoError(t, err)
+
+	return id
+}
+
+func createItem(t *testing.T, repo Repository, name string, price int, stock, maxPerUser *int) *models.Item {
+	t.Helper()
+
+	item, err := repo.CreateItem(context.Background(), &models.Item{Name: name, Price: price, Stock: stock, MaxPerUser: maxPerUser})
+	require.NoError(t, err)
+
+	return item
+}
+
+func coins(t *testing.T, repo Repository, userId int) int {
+	t.Helper()
+
+	info, err := repo.GetInfo(context.Background(), &dto.InfoRequest{Id: userId, Limit: 1})
+	require.NoError(t, err)
+
+	return info.Coins
+}
+
+func password(t *testing.T, repo Repository, username string) string {
+	t.Helper()
+
+	user, err := repo.GetUser(context.Background(), username)
+	require.NoError(t, err)
+
+	return user.Password
+}
+
+func assertLedgerBalanced(t *testing.T, repo Repository) {
+	t.Helper()
+
+	report, err := repo.VerifyLedger(context.Background())
+	require.NoError(t, err)
+	assert.True(t, report.Balanced, "ledger report: %+v", report)
+}
+
+func itemNames(items []dto.Item) []string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+
+	return names
+}
+
+func receivedFrom(received []dto.Received) []string {
+	users := make([]string, 0, len(received))
+	for _, r := range received {
+		users = append(users, r.FromUser)
+	}
+
+	return users
+}
+
+func receivedAmounts(received []dto.Received) []int {
+	amounts := make([]int, 0, len(received))
+	for _, r := range received {
+		amounts = append(amounts, r.Amount)
+	}
+
+	return amounts
+}
+
+func intPtr(value int) *int {
+	return &value
+}
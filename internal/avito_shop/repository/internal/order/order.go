@@ -0,0 +1,30 @@
+// Package order holds the order handling shared by the repository
+// implementations.
+package order
+
+import (
+	"sort"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+)
+
+// MergeItems sums the quantities of items ordered more than once and sorts
+// the lines by item name, so concurrent orders lock their items in the same
+// order.
+func MergeItems(items []dto.OrderItem) []dto.OrderItem {
+	quantities := make(map[string]int, len(items))
+	for _, item := range items {
+		quantities[item.Item] += item.Quantity
+	}
+
+	lines := make([]dto.OrderItem, 0, len(quantities))
+	for name, quantity := range quantities {
+		lines = append(lines, dto.OrderItem{Item: name, Quantity: quantity})
+	}
+
+	sort.Slice(lines, func(i, j int) bool {
+		return lines[i].Item < lines[j].Item
+	})
+
+	return lines
+}
@@ -0,0 +1,21 @@
+package order
+
+import (
+	"testing"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeItems(t *testing.T) {
+	items := []dto.OrderItem{
+		{Item: "pen", Quantity: 1},
+		{Item: "cup", Quantity: 2},
+		{Item: "pen", Quantity: 3},
+	}
+
+	assert.Equal(t, []dto.OrderItem{
+		{Item: "cup", Quantity: 2},
+		{Item: "pen", Quantity: 4},
+	}, MergeItems(items))
+}
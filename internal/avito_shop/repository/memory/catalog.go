@@ -0,0 +1,34 @@
+package memory
+
+import "github.com/dgt4l/avito_shop/internal/avito_shop/models"
+
+// defaultCatalog mirrors the items migrations/000001_init.up.sql seeds into Postgres.
+var defaultCatalog = []models.Item{
+	{Name: "t-shirt", Price: 80},
+	{Name: "cup", Price: 20},
+	{Name: "book", Price: 50},
+	{Name: "pen", Price: 10},
+	{Name: "powerbank", Price: 200},
+	{Name: "hoody", Price: 300},
+	{Name: "umbrella", Price: 200},
+	{Name: "socks", Price: 10},
+	{Name: "wallet", Price: 50},
+	{Name: "pink-hoody", Price: 500},
+}
+
+// SeedCatalog adds the default shop items that are not there yet, the way
+// the Postgres migration does.
+func (r *Repository) SeedCatalog() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, itemModel := range defaultCatalog {
+		if _, ok := r.itemIds[itemModel.Name]; ok {
+			continue
+		}
+
+		itemModel.Id = len(r.items) + 1
+		r.items = append(r.items, &item{Item: itemModel})
+		r.itemIds[itemModel.Name] = itemModel.Id
+	}
+}
@@ -0,0 +1,7 @@
+package memory
+
+import "errors"
+
+// ErrDuplicateKey stands in for the unique violations Postgres reports on
+// keys that are generated randomly and never expected to collide.
+var ErrDuplicateKey = errors.New("duplicate key")
@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+)
+
+type idempotencyKeyId struct {
+	userId int
+	key    string
+}
+
+type idempotencyRecord struct {
+	operation   string
+	requestHash string
+	response    []byte
+}
+
+// lookupIdempotencyKey reports whether the key was already used and, if so,
+// decodes the stored response into response. Keys are only stored together
+// with a response, so a failed request leaves its key free for a retry.
+func (r *Repository) lookupIdempotencyKey(userId int, key *dto.IdempotencyKey, response any) (bool, error) {
+	if key == nil {
+		return false, nil
+	}
+
+	record, ok := r.idempotencyKeys[idempotencyKeyId{userId: userId, key: key.Key}]
+	if !ok {
+		return false, nil
+	}
+
+	if record.operation != key.Operation || record.requestHash != key.RequestHash {
+		return false, repository.ErrIdempotencyKeyReused
+	}
+
+	return true, json.Unmarshal(record.response, response)
+}
+
+func (r *Repository) GetIdempotentResponse(_ context.Context, userId int, key *dto.IdempotencyKey, response any) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.lookupIdempotencyKey(userId, key, response)
+}
+
+func (r *Repository) storeIdempotencyKey(userId int, key *dto.IdempotencyKey, response any) error {
+	if key == nil {
+		return nil
+	}
+
+	stored, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	r.idempotencyKeys[idempotencyKeyId{userId: userId, key: key.Key}] = idempotencyRecord{
+		operation:   key.Operation,
+		requestHash: key.RequestHash,
+		response:    stored,
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+)
+
+const (
+	ledgerKindMint     = "mint"
+	ledgerKindPurchase = "purchase"
+	ledgerKindTransfer = "transfer"
+
+	issuanceAccountCode = "issuance"
+	shopAccountCode     = "shop"
+)
+
+// ledgerAccount names an account in the ledger. User accounts carry the user
+// id so that posting to them also refreshes the cached balance.
+type ledgerAccount struct {
+	code   string
+	userId int
+}
+
+var (
+	issuanceAccount = ledgerAccount{code: issuanceAccountCode}
+	shopAccount     = ledgerAccount{code: shopAccountCode}
+)
+
+func userAccount(userId int) ledgerAccount {
+	return ledgerAccount{code: "user:" + strconv.Itoa(userId), userId: userId}
+}
+
+type ledgerTransfer struct {
+	id   int
+	kind string
+}
+
+// ledgerEntry credits amount to account; a negative amount is a debit.
+type ledgerEntry struct {
+	transferId int
+	account    ledgerAccount
+	amount     int
+}
+
+// postLedgerTransfer records entries as a single ledger transfer and applies
+// them to the cached user balances. The entries must sum to zero, so coins
+// are only ever moved between accounts, never created or lost.
+func (r *Repository) postLedgerTransfer(kind string, entries ...ledgerEntry) error {
+	var sum int
+	for _, entry := range entries {
+		sum += entry.amount
+	}
+
+	if len(entries) < 2 || sum != 0 {
+		return repository.ErrUnbalancedTransfer
+	}
+
+	transfer := ledgerTransfer{id: len(r.ledgerTransfers) + 1, kind: kind}
+	r.ledgerTransfers = append(r.ledgerTransfers, transfer)
+
+	for _, entry := range entries {
+		entry.transferId = transfer.id
+		r.ledgerEntries = append(r.ledgerEntries, entry)
+
+		if entry.account.userId != 0 {
+			r.users[entry.account.userId-1].coins += entry.amount
+		}
+	}
+
+	return nil
+}
+
+// VerifyLedger recomputes every user balance from the ledger and compares it
+// with the cached one, under the read lock so the two agree on one state.
+func (r *Repository) VerifyLedger(_ context.Context) (*dto.LedgerReport, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	report := dto.LedgerReport{
+		UnbalancedTransfers: make([]int, 0),
+		Discrepancies:       make([]dto.BalanceDiscrepancy, 0),
+	}
+
+	transferSums := make([]int, len(r.ledgerTransfers))
+	balances := make(map[string]int)
+	for _, entry := range r.ledgerEntries {
+		transferSums[entry.transferId-1] += entry.amount
+		balances[entry.account.code] += entry.amount
+	}
+
+	for i, sum := range transferSums {
+		if sum != 0 {
+			report.UnbalancedTransfers = append(report.UnbalancedTransfers, i+1)
+		}
+	}
+
+	for _, u := range r.users {
+		if ledger := balances[userAccount(u.Id).code]; ledger != u.coins {
+			report.Discrepancies = append(report.Discrepancies, dto.BalanceDiscrepancy{
+				UserId: u.Id, Username: u.Username, Cached: u.coins, Ledger: ledger,
+			})
+		}
+	}
+
+	report.Balanced = len(report.UnbalancedTransfers) == 0 && len(report.Discrepancies) == 0
+
+	return &report, nil
+}
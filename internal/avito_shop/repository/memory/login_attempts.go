@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+)
+
+// The methods below let Repository act as the auth.LoginAttemptStore.
+
+func (r *Repository) GetLoginAttempts(_ context.Context, key string) (*auth.LoginAttempts, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	attempts, ok := r.loginAttempts[key]
+	if !ok {
+		return &auth.LoginAttempts{Key: key}, nil
+	}
+
+	return &attempts, nil
+}
+
+func (r *Repository) RecordLoginFailure(_ context.Context, key string, now time.Time, window time.Duration) (*auth.LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.loginAttempts[key]
+	if !ok || attempts.LastFailureAt.Before(now.Add(-window)) {
+		attempts = auth.LoginAttempts{Key: key}
+	}
+
+	attempts.Failures++
+	attempts.LastFailureAt = now
+	r.loginAttempts[key] = attempts
+
+	return &attempts, nil
+}
+
+func (r *Repository) ReleaseLoginAttempt(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts, ok := r.loginAttempts[key]
+	if !ok {
+		return nil
+	}
+
+	if attempts.Failures <= 1 {
+		delete(r.loginAttempts, key)
+		return nil
+	}
+
+	attempts.Failures--
+	r.loginAttempts[key] = attempts
+	return nil
+}
+
+func (r *Repository) ResetLoginAttempts(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.loginAttempts, key)
+	return nil
+}
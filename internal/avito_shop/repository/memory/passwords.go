@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+)
+
+type invite struct {
+	createdBy int
+	expiresAt time.Time
+	usedBy    int
+	usedAt    *time.Time
+}
+
+type passwordReset struct {
+	userId    int
+	createdBy int
+	expiresAt time.Time
+	usedAt    *time.Time
+}
+
+// RehashPassword replaces the stored hash only if it is still oldHash, so a
+// rehash on login cannot undo a password change that happened meanwhile.
+func (r *Repository) RehashPassword(_ context.Context, userId int, oldHash, newHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if u, ok := r.userById(userId); ok && u.Password == oldHash {
+		u.Password = newHash
+	}
+
+	return nil
+}
+
+func (r *Repository) UpdatePassword(_ context.Context, userId int, password string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.userById(userId)
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+
+	u.Password = password
+	return nil
+}
+
+// CreatePasswordReset stores the hash of a one-time reset token. Issuing a
+// new token invalidates the ones the user has not redeemed yet.
+func (r *Repository) CreatePasswordReset(_ context.Context, username, tokenHash string, createdBy int, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.userByName(username)
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+
+	if _, ok := r.passwordResets[tokenHash]; ok {
+		return ErrDuplicateKey
+	}
+
+	expiredAt := now()
+	for _, reset := range r.passwordResets {
+		if reset.userId == u.Id && reset.usedAt == nil && reset.expiresAt.After(expiredAt) {
+			reset.expiresAt = expiredAt
+		}
+	}
+
+	r.passwordResets[tokenHash] = &passwordReset{userId: u.Id, createdBy: createdBy, expiresAt: expiresAt}
+	return nil
+}
+
+// ResetPassword redeems a reset token and sets the new password at once, so
+// a token can be used exactly once.
+func (r *Repository) ResetPassword(_ context.Context, tokenHash, password string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	usedAt := now()
+	reset, ok := r.passwordResets[tokenHash]
+	if !ok || reset.usedAt != nil || !reset.expiresAt.After(usedAt) {
+		return 0, repository.ErrInvalidResetToken
+	}
+
+	reset.usedAt = &usedAt
+	r.users[reset.userId-1].Password = password
+
+	return reset.userId, nil
+}
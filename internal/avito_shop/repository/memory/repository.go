@@ -0,0 +1,787 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/repository/internal/order"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+)
+
+// Driver is the db_driver value that selects this repository.
+const Driver = "memory"
+
+const dailyTransferWindow = 24 * time.Hour
+
+type user struct {
+	models.User
+	coins int
+}
+
+type item struct {
+	models.Item
+	retired bool
+}
+
+type transaction struct {
+	id         int
+	fromUserId int
+	toUserId   int
+	amount     int
+	createdAt  time.Time
+}
+
+type purchase struct {
+	id        int
+	userId    int
+	itemId    int
+	quantity  int
+	amount    int
+	createdAt time.Time
+}
+
+// Repository keeps everything the Postgres repository does in process
+// memory and returns the same sentinel errors. A single lock serializes
+// writers, so BuyItem, CreateOrder and SendCoin are atomic: they check every
+// precondition before changing anything. Data is lost on restart, so it is
+// meant for tests and local development.
+type Repository struct {
+	mu  sync.RWMutex
+	cfg repository.DBConfig
+
+	users        []*user
+	userIds      map[string]int
+	items        []*item
+	itemIds      map[string]int
+	inventory    map[int]map[int]int
+	transactions []transaction
+	purchases    []purchase
+
+	idempotencyKeys map[idempotencyKeyId]idempotencyRecord
+	ledgerTransfers []ledgerTransfer
+	ledgerEntries   []ledgerEntry
+
+	sessions       map[string]auth.Session
+	invites        map[string]*invite
+	passwordResets map[string]*passwordReset
+	loginAttempts  map[string]auth.LoginAttempts
+}
+
+// NewRepository returns an empty repository. New users are granted
+// config.DefaultCoins; the rest of config only applies to Postgres.
+func NewRepository(config repository.DBConfig) *Repository {
+	return &Repository{
+		cfg:             config,
+		userIds:         make(map[string]int),
+		itemIds:         make(map[string]int),
+		inventory:       make(map[int]map[int]int),
+		idempotencyKeys: make(map[idempotencyKeyId]idempotencyRecord),
+		sessions:        make(map[string]auth.Session),
+		invites:         make(map[string]*invite),
+		passwordResets:  make(map[string]*passwordReset),
+		loginAttempts:   make(map[string]auth.LoginAttempts),
+	}
+}
+
+func (r *Repository) Close() error {
+	return nil
+}
+
+func (r *Repository) GetUser(_ context.Context, username string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.userByName(username)
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+
+	userModel := u.User
+	return &userModel, nil
+}
+
+func (r *Repository) GetUserById(_ context.Context, id int) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.userById(id)
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+
+	userModel := u.User
+	return &userModel, nil
+}
+
+func (r *Repository) BuyItem(
+	ctx context.Context, userId int, item string, quantity int, key *dto.IdempotencyKey,
+) (*dto.OrderResponse, error) {
+	return r.CreateOrder(ctx, userId, []dto.OrderItem{{Item: item, Quantity: quantity}}, key)
+}
+
+// CreateOrder follows the Postgres checks in the same order, so both report
+// the same error for an order that breaks several rules.
+func (r *Repository) CreateOrder(
+	_ context.Context, userId int, items []dto.OrderItem, key *dto.IdempotencyKey,
+) (*dto.OrderResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var response dto.OrderResponse
+	replayed, err := r.lookupIdempotencyKey(userId, key, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed {
+		response.Replayed = true
+		return &response, nil
+	}
+
+	lines := order.MergeItems(items)
+
+	itemModels := make([]*item, len(lines))
+	for i, line := range lines {
+		itemModel, ok := r.itemByName(line.Item)
+		if !ok {
+			return nil, repository.ErrItemNotFound
+		}
+
+		itemModels[i] = itemModel
+	}
+
+	u, ok := r.userById(userId)
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+
+	var total int
+	for i, line := range lines {
+		itemModel := itemModels[i]
+
+		if itemModel.Stock != nil && *itemModel.Stock < line.Quantity {
+			return nil, repository.ErrOutOfStock
+		}
+
+		if itemModel.MaxPerUser != nil && r.inventory[userId][itemModel.Id]+line.Quantity > *itemModel.MaxPerUser {
+			return nil, repository.ErrPurchaseLimitReached
+		}
+
+		total += itemModel.Price * line.Quantity
+	}
+
+	if u.coins < total {
+		return nil, repository.ErrNotEnoughCoins
+	}
+
+	response.Total = total
+
+	err = r.postLedgerTransfer(
+		ledgerKindPurchase,
+		ledgerEntry{account: userAccount(userId), amount: -total},
+		ledgerEntry{account: shopAccount, amount: total},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := now()
+	for i, line := range lines {
+		itemModel := itemModels[i]
+
+		if itemModel.Stock != nil {
+			stock := *itemModel.Stock - line.Quantity
+			itemModel.Stock = &stock
+		}
+
+		if r.inventory[userId] == nil {
+			r.inventory[userId] = make(map[int]int)
+		}
+		r.inventory[userId][itemModel.Id] += line.Quantity
+
+		p := purchase{
+			id:        len(r.purchases) + 1,
+			userId:    userId,
+			itemId:    itemModel.Id,
+			quantity:  line.Quantity,
+			amount:    itemModel.Price * line.Quantity,
+			createdAt: createdAt,
+		}
+		r.purchases = append(r.purchases, p)
+
+		response.Purchases = append(response.Purchases, dto.Purchase{
+			Id: p.id, Item: itemModel.Name, Quantity: p.quantity, Amount: p.amount, CreatedAt: p.createdAt,
+		})
+	}
+
+	if err := r.storeIdempotencyKey(userId, key, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+// GetInfo returns the full history unless request.Limit restricts every list
+// to the latest entries; with request.Aggregate the history is replaced by
+// per-counterparty totals.
+func (r *Repository) GetInfo(_ context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	userId := request.Id
+
+	u, ok := r.userById(userId)
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+
+	var userInventory []dto.Inventory
+	for itemId, quantity := range r.inventory[userId] {
+		userInventory = append(userInventory, dto.Inventory{Type: r.items[itemId-1].Name, Quantity: quantity})
+	}
+	sort.Slice(userInventory, func(i, j int) bool {
+		return userInventory[i].Type < userInventory[j].Type
+	})
+
+	if request.Aggregate {
+		return &dto.InfoResponse{
+			Coins:     u.coins,
+			Inventory: userInventory,
+			CoinTotals: &dto.CoinTotals{
+				Received: r.counterpartyTotals(userId, false, request.Limit),
+				Sent:     r.counterpartyTotals(userId, true, request.Limit),
+			},
+		}, nil
+	}
+
+	var (
+		userRecieved  []dto.Received
+		userSent      []dto.Sent
+		userPurchases []dto.Purchase
+	)
+
+	// Entries are appended in creation order, so walking backwards yields
+	// the latest first.
+	for i := len(r.transactions) - 1; i >= 0; i-- {
+		t := r.transactions[i]
+
+		if t.toUserId == userId && withinLimit(len(userRecieved), request.Limit) {
+			userRecieved = append(userRecieved, dto.Received{
+				Id: t.id, FromUser: r.users[t.fromUserId-1].Username, Amount: t.amount, CreatedAt: t.createdAt,
+			})
+		}
+
+		if t.fromUserId == userId && withinLimit(len(userSent), request.Limit) {
+			userSent = append(userSent, dto.Sent{
+				Id: t.id, ToUser: r.users[t.toUserId-1].Username, Amount: t.amount, CreatedAt: t.createdAt,
+			})
+		}
+	}
+
+	for i := len(r.purchases) - 1; i >= 0; i-- {
+		p := r.purchases[i]
+
+		if p.userId == userId && withinLimit(len(userPurchases), request.Limit) {
+			userPurchases = append(userPurchases, dto.Purchase{
+				Id: p.id, Item: r.items[p.itemId-1].Name, Quantity: p.quantity, Amount: p.amount, CreatedAt: p.createdAt,
+			})
+		}
+	}
+
+	return &dto.InfoResponse{
+		Coins:     u.coins,
+		Inventory: userInventory,
+		CoinHistory: dto.CoinHistory{
+			Received:  userRecieved,
+			Sent:      userSent,
+			Purchases: userPurchases,
+		},
+	}, nil
+}
+
+func (r *Repository) GetHistory(_ context.Context, filter *dto.HistoryFilter) ([]dto.HistoryEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []dto.HistoryEntry
+	for _, t := range r.transactions {
+		if t.fromUserId == filter.UserId {
+			entries = append(entries, dto.HistoryEntry{
+				Id: t.id, Type: dto.HistoryTypeSent, Counterparty: r.users[t.toUserId-1].Username,
+				Amount: t.amount, CreatedAt: t.createdAt,
+			})
+		}
+
+		if t.toUserId == filter.UserId {
+			entries = append(entries, dto.HistoryEntry{
+				Id: t.id, Type: dto.HistoryTypeReceived, Counterparty: r.users[t.fromUserId-1].Username,
+				Amount: t.amount, CreatedAt: t.createdAt,
+			})
+		}
+	}
+
+	for _, p := range r.purchases {
+		if p.userId == filter.UserId {
+			entries = append(entries, dto.HistoryEntry{
+				Id: p.id, Type: dto.HistoryTypePurchase, Item: r.items[p.itemId-1].Name,
+				Quantity: p.quantity, Amount: p.amount, CreatedAt: p.createdAt,
+			})
+		}
+	}
+
+	entries = slices.DeleteFunc(entries, func(entry dto.HistoryEntry) bool {
+		return !matchesHistoryFilter(entry, filter)
+	})
+
+	slices.SortFunc(entries, func(a, b dto.HistoryEntry) int {
+		return -compareHistoryEntries(a, b)
+	})
+
+	if len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+
+	return append(make([]dto.HistoryEntry, 0, len(entries)), entries...), nil
+}
+
+// SendCoin moves amount from the sender to toUser. dailyLimit caps what the
+// sender may transfer over the last 24 hours, zero means no cap.
+func (r *Repository) SendCoin(
+	_ context.Context, toUser string, fromUserId, amount, dailyLimit int, key *dto.IdempotencyKey,
+) (*dto.SendCoinResponse, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var response dto.SendCoinResponse
+	replayed, err := r.lookupIdempotencyKey(fromUserId, key, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	if replayed {
+		response.Replayed = true
+		return &response, nil
+	}
+
+	to, ok := r.userByName(toUser)
+	if !ok {
+		return nil, repository.ErrUserToNotFound
+	}
+
+	from, ok := r.userById(fromUserId)
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+
+	switch to.Status {
+	case models.UserStatusBlocked:
+		return nil, repository.ErrRecipientBlocked
+	case models.UserStatusDisabled:
+		return nil, repository.ErrRecipientDisabled
+	}
+
+	if from.coins < amount {
+		return nil, repository.ErrNotEnoughCoins
+	}
+
+	createdAt := now()
+	if dailyLimit > 0 {
+		var sentToday int
+		for _, t := range r.transactions {
+			if t.fromUserId == fromUserId && t.createdAt.After(createdAt.Add(-dailyTransferWindow)) {
+				sentToday += t.amount
+			}
+		}
+
+		if sentToday+amount > dailyLimit {
+			return nil, repository.ErrDailyTransferLimit
+		}
+	}
+
+	err = r.postLedgerTransfer(
+		ledgerKindTransfer,
+		ledgerEntry{account: userAccount(fromUserId), amount: -amount},
+		ledgerEntry{account: userAccount(to.Id), amount: amount},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	t := transaction{
+		id:         len(r.transactions) + 1,
+		fromUserId: fromUserId,
+		toUserId:   to.Id,
+		amount:     amount,
+		createdAt:  createdAt,
+	}
+	r.transactions = append(r.transactions, t)
+
+	response = dto.SendCoinResponse{Id: t.id, ToUser: toUser, Amount: amount, CreatedAt: t.createdAt}
+
+	if err := r.storeIdempotencyKey(fromUserId, key, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (r *Repository) GetItems(_ context.Context, request *dto.ItemsRequest) ([]dto.Item, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	items := make([]dto.Item, 0)
+	for _, itemModel := range r.items {
+		if itemModel.retired || itemModel.Price < request.MinPrice {
+			continue
+		}
+
+		if request.MaxPrice != 0 && itemModel.Price > request.MaxPrice {
+			continue
+		}
+
+		items = append(items, dto.Item{
+			Id:         itemModel.Id,
+			Name:       itemModel.Name,
+			Price:      itemModel.Price,
+			Stock:      cloneInt(itemModel.Stock),
+			MaxPerUser: cloneInt(itemModel.MaxPerUser),
+			Available:  itemModel.Stock == nil || *itemModel.Stock > 0,
+		})
+	}
+
+	compare := func(a, b dto.Item) int {
+		switch request.SortBy {
+		case dto.SortByPrice:
+			return cmp.Compare(a.Price, b.Price)
+		case dto.SortByName:
+			return cmp.Compare(a.Name, b.Name)
+		default:
+			return cmp.Compare(a.Id, b.Id)
+		}
+	}
+
+	// Items are kept in id order, so a stable sort leaves ties by id.
+	slices.SortStableFunc(items, func(a, b dto.Item) int {
+		if request.Order == dto.OrderDesc {
+			return compare(b, a)
+		}
+
+		return compare(a, b)
+	})
+
+	return items, nil
+}
+
+func (r *Repository) CreateItem(_ context.Context, request *models.Item) (*models.Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.itemIds[request.Name]; ok {
+		return nil, repository.ErrItemAlreadyExists
+	}
+
+	itemModel := &item{Item: models.Item{
+		Id:         len(r.items) + 1,
+		Name:       request.Name,
+		Price:      request.Price,
+		Stock:      cloneInt(request.Stock),
+		MaxPerUser: cloneInt(request.MaxPerUser),
+	}}
+	r.items = append(r.items, itemModel)
+	r.itemIds[itemModel.Name] = itemModel.Id
+
+	return itemModel.clone(), nil
+}
+
+func (r *Repository) UpdateItemPrice(_ context.Context, id, price int) (*models.Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	itemModel, ok := r.itemById(id)
+	if !ok {
+		return nil, repository.ErrItemNotFound
+	}
+
+	itemModel.Price = price
+	return itemModel.clone(), nil
+}
+
+func (r *Repository) SetItemLimits(_ context.Context, id int, stock, maxPerUser *int) (*models.Item, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	itemModel, ok := r.itemById(id)
+	if !ok {
+		return nil, repository.ErrItemNotFound
+	}
+
+	itemModel.Stock, itemModel.MaxPerUser = cloneInt(stock), cloneInt(maxPerUser)
+	return itemModel.clone(), nil
+}
+
+func (r *Repository) RetireItem(_ context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	itemModel, ok := r.itemById(id)
+	if !ok {
+		return repository.ErrItemNotFound
+	}
+
+	itemModel.retired = true
+	return nil
+}
+
+func (r *Repository) SetUserRole(_ context.Context, username, role string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.userByName(username)
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+
+	u.Role = role
+	return nil
+}
+
+func (r *Repository) SetUserStatus(_ context.Context, username, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.userByName(username)
+	if !ok {
+		return repository.ErrUserNotFound
+	}
+
+	u.Status = status
+	return nil
+}
+
+func (r *Repository) CreateUser(_ context.Context, username, password string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.userIds[username]; ok {
+		return 0, repository.ErrUserAlreadyExists
+	}
+
+	return r.createUser(username, password)
+}
+
+// CreateInvitedUser creates the user and redeems the invite atomically: an
+// invite that is unknown, expired or already used leaves no user behind.
+func (r *Repository) CreateInvitedUser(_ context.Context, username, password, code string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.userIds[username]; ok {
+		return 0, repository.ErrUserAlreadyExists
+	}
+
+	inv, ok := r.invites[code]
+	if !ok || inv.usedAt != nil || !inv.expiresAt.After(now()) {
+		return 0, repository.ErrInvalidInvite
+	}
+
+	id, err := r.createUser(username, password)
+	if err != nil {
+		return 0, err
+	}
+
+	usedAt := now()
+	inv.usedBy, inv.usedAt = id, &usedAt
+
+	return id, nil
+}
+
+func (r *Repository) CreateInvite(_ context.Context, code string, createdBy int, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.userById(createdBy); !ok {
+		return repository.ErrUserNotFound
+	}
+
+	if _, ok := r.invites[code]; ok {
+		return ErrDuplicateKey
+	}
+
+	r.invites[code] = &invite{createdBy: createdBy, expiresAt: expiresAt}
+	return nil
+}
+
+// createUser opens a ledger account for the new user and mints DefaultCoins
+// into it from the issuance account. The caller holds the write lock and has
+// checked that username is free.
+func (r *Repository) createUser(username, password string) (int, error) {
+	u := &user{User: models.User{
+		Id:       len(r.users) + 1,
+		Username: username,
+		Password: password,
+		Role:     models.RoleUser,
+		Status:   models.UserStatusActive,
+	}}
+	r.users = append(r.users, u)
+	r.userIds[username] = u.Id
+
+	if r.cfg.DefaultCoins > 0 {
+		err := r.postLedgerTransfer(
+			ledgerKindMint,
+			ledgerEntry{account: issuanceAccount, amount: -r.cfg.DefaultCoins},
+			ledgerEntry{account: userAccount(u.Id), amount: r.cfg.DefaultCoins},
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return u.Id, nil
+}
+
+func (r *Repository) userById(id int) (*user, bool) {
+	if id < 1 || id > len(r.users) {
+		return nil, false
+	}
+
+	return r.users[id-1], true
+}
+
+func (r *Repository) userByName(username string) (*user, bool) {
+	id, ok := r.userIds[username]
+	if !ok {
+		return nil, false
+	}
+
+	return r.users[id-1], true
+}
+
+// itemById and itemByName skip retired items, like the Postgres queries do.
+func (r *Repository) itemById(id int) (*item, bool) {
+	if id < 1 || id > len(r.items) || r.items[id-1].retired {
+		return nil, false
+	}
+
+	return r.items[id-1], true
+}
+
+func (r *Repository) itemByName(name string) (*item, bool) {
+	id, ok := r.itemIds[name]
+	if !ok {
+		return nil, false
+	}
+
+	return r.itemById(id)
+}
+
+func (r *Repository) counterpartyTotals(userId int, sent bool, limit int) []dto.CounterpartyTotal {
+	totals := make(map[string]*dto.CounterpartyTotal)
+	for _, t := range r.transactions {
+		counterpartyId := t.fromUserId
+		if sent {
+			counterpartyId = t.toUserId
+		}
+
+		if (sent && t.fromUserId != userId) || (!sent && t.toUserId != userId) {
+			continue
+		}
+
+		username := r.users[counterpartyId-1].Username
+		if totals[username] == nil {
+			totals[username] = &dto.CounterpartyTotal{User: username}
+		}
+
+		totals[username].Amount += t.amount
+		totals[username].Count++
+	}
+
+	var result []dto.CounterpartyTotal
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+
+	slices.SortFunc(result, func(a, b dto.CounterpartyTotal) int {
+		if a.Amount != b.Amount {
+			return cmp.Compare(b.Amount, a.Amount)
+		}
+
+		return cmp.Compare(a.User, b.User)
+	})
+
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result
+}
+
+func (i *item) clone() *models.Item {
+	itemModel := i.Item
+	itemModel.Stock, itemModel.MaxPerUser = cloneInt(i.Stock), cloneInt(i.MaxPerUser)
+	return &itemModel
+}
+
+func cloneInt(value *int) *int {
+	if value == nil {
+		return nil
+	}
+
+	v := *value
+	return &v
+}
+
+func withinLimit(count, limit int) bool {
+	return limit <= 0 || count < limit
+}
+
+func matchesHistoryFilter(entry dto.HistoryEntry, filter *dto.HistoryFilter) bool {
+	if filter.Type != "" && entry.Type != filter.Type {
+		return false
+	}
+
+	if filter.Counterparty != "" && entry.Counterparty != filter.Counterparty {
+		return false
+	}
+
+	if filter.From != nil && entry.CreatedAt.Before(*filter.From) {
+		return false
+	}
+
+	if filter.To != nil && !entry.CreatedAt.Before(*filter.To) {
+		return false
+	}
+
+	if filter.After != nil {
+		after := dto.HistoryEntry{CreatedAt: filter.After.CreatedAt, Type: filter.After.Type, Id: filter.After.Id}
+		return compareHistoryEntries(entry, after) < 0
+	}
+
+	return true
+}
+
+// compareHistoryEntries orders entries by (CreatedAt, Type, Id), the key the
+// history cursor points at.
+func compareHistoryEntries(a, b dto.HistoryEntry) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+
+	if c := cmp.Compare(a.Type, b.Type); c != 0 {
+		return c
+	}
+
+	return cmp.Compare(a.Id, b.Id)
+}
+
+// now matches the microsecond precision of Postgres timestamps, so values
+// survive a JSON round trip of an idempotent response unchanged.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
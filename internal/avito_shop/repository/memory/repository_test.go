@@ -0,0 +1,30 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/repository/contract"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepository_Contract(t *testing.T) {
+	contract.Run(t, func(t *testing.T) contract.Repository {
+		return NewRepository(repository.DBConfig{DefaultCoins: contract.DefaultCoins})
+	})
+}
+
+func TestRepository_SeedCatalog(t *testing.T) {
+	repo := NewRepository(repository.DBConfig{})
+
+	repo.SeedCatalog()
+	repo.SeedCatalog()
+
+	items, err := repo.GetItems(context.Background(), &dto.ItemsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, items, len(defaultCatalog))
+	assert.Equal(t, dto.Item{Id: 1, Name: "t-shirt", Price: 80, Available: true}, items[0])
+}
@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+)
+
+// The methods below let Repository act as the auth.SessionStore. Unlike
+// auth.MemorySessionStore they resolve the session username from the users,
+// as the Postgres store does.
+
+func (r *Repository) CreateSession(_ context.Context, session *auth.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.userById(session.UserId); !ok {
+		return repository.ErrUserNotFound
+	}
+
+	if _, ok := r.sessions[session.Id]; ok {
+		return ErrDuplicateKey
+	}
+
+	r.sessions[session.Id] = auth.Session{
+		Id:          session.Id,
+		UserId:      session.UserId,
+		RefreshHash: session.RefreshHash,
+		ExpiresAt:   session.ExpiresAt,
+	}
+	return nil
+}
+
+func (r *Repository) GetSession(_ context.Context, id string) (*auth.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, auth.ErrSessionNotFound
+	}
+
+	session.Username = r.users[session.UserId-1].Username
+	return &session, nil
+}
+
+// RotateSession swaps the refresh hash only if it still equals oldHash, so
+// of two concurrent refreshes with the same token exactly one succeeds.
+func (r *Repository) RotateSession(_ context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok || session.RevokedAt != nil || session.RefreshHash != oldHash {
+		return false, nil
+	}
+
+	session.RefreshHash, session.ExpiresAt = newHash, expiresAt
+	r.sessions[id] = session
+	return true, nil
+}
+
+func (r *Repository) RevokeSession(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok || session.RevokedAt != nil {
+		return nil
+	}
+
+	revokedAt := now()
+	session.RevokedAt = &revokedAt
+	r.sessions[id] = session
+	return nil
+}
+
+func (r *Repository) RevokeUserSessions(_ context.Context, userId int, exceptId string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	revokedAt := now()
+	for id, session := range r.sessions {
+		if session.UserId != userId || id == exceptId || session.RevokedAt != nil {
+			continue
+		}
+
+		session.RevokedAt = &revokedAt
+		r.sessions[id] = session
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	config "github.com/dgt4l/avito_shop/configs/avito_shop"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+	"github.com/dgt4l/avito_shop/migrations"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMigrator_FromBaseline sets a schema up the way the Postgres container
+// did from init.sql, with data in it, and checks that the migrations bring
+// it to the current columns and back down. It runs in a schema of its own,
+// so the tables of the e2e database are left alone.
+func TestMigrator_FromBaseline(t *testing.T) {
+	if os.Getenv(postgresEnv) == "" {
+		t.Skipf("set %s to run the migrations against Postgres", postgresEnv)
+	}
+
+	cfg, err := config.LoadConfig("../../../../test/e2e")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("migrate_baseline_%d", time.Now().UnixNano())
+
+	admin, err := pgx.Connect(ctx, cfg.DBConfig.ConnString())
+	require.NoError(t, err)
+	defer admin.Close(ctx)
+
+	_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema)
+	require.NoError(t, err)
+	defer admin.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE")
+
+	dsn, err := url.Parse(cfg.DBConfig.ConnString())
+	require.NoError(t, err)
+	query := dsn.Query()
+	query.Set("search_path", schema)
+	dsn.RawQuery = query.Encode()
+	cfg.DBConfig.DSN = dsn.String()
+
+	db, err := pgx.Connect(ctx, cfg.DBConfig.ConnString())
+	require.NoError(t, err)
+	defer db.Close(ctx)
+
+	baseline, err := fs.ReadFile(migrations.FS, "000001_init.up.sql")
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, string(baseline))
+	require.NoError(t, err)
+
+	_, err = db.Exec(ctx, `INSERT INTO users (username, password_salt, coins) VALUES ('user1', 'hash', 1000), ('user2', 'hash', 500)`)
+	require.NoError(t, err)
+	_, err = db.Exec(ctx, `INSERT INTO transactions (from_user_id, to_user_id, amount) VALUES (1, 2, 10)`)
+	require.NoError(t, err)
+
+	migrator, err := repository.NewMigrator(cfg.DBConfig)
+	require.NoError(t, err)
+	defer migrator.Close()
+
+	require.NoError(t, migrator.Up(ctx))
+
+	assert.Equal(t, map[string][]string{
+		"users":             {"id", "username", "password_salt", "coins", "role", "status"},
+		"items":             {"id", "name", "price", "retired_at", "stock", "max_per_user"},
+		"inventory":         {"user_id", "item_id", "quantity"},
+		"transactions":      {"id", "from_user_id", "to_user_id", "amount", "created_at"},
+		"purchases":         {"id", "user_id", "item_id", "quantity", "amount", "created_at"},
+		"idempotency_keys":  {"user_id", "key", "operation", "request_hash", "response", "created_at"},
+		"ledger_accounts":   {"code", "user_id"},
+		"ledger_transfers":  {"id", "kind", "created_at"},
+		"ledger_entries":    {"id", "transfer_id", "account", "amount"},
+		"sessions":          {"id", "user_id", "refresh_hash", "expires_at", "revoked_at", "created_at"},
+		"invites":           {"code", "created_by", "expires_at", "used_by", "used_at", "created_at"},
+		"login_attempts":    {"key", "failures", "last_failure_at"},
+		"password_resets":   {"token_hash", "user_id", "created_by", "expires_at", "used_at", "created_at"},
+		"schema_migrations": {"version", "name", "applied_at"},
+	}, columns(t, db, schema))
+
+	var role, status string
+	require.NoError(t, db.QueryRow(ctx, `SELECT role, status FROM users WHERE username = 'user1'`).Scan(&role, &status))
+	assert.Equal(t, "user", role)
+	assert.Equal(t, "active", status)
+
+	var opening int
+	require.NoError(t, db.QueryRow(ctx, `SELECT SUM(amount) FROM ledger_entries WHERE account LIKE 'user:%'`).Scan(&opening))
+	assert.Equal(t, 1500, opening, "existing balances are carried into the ledger")
+
+	var indexed bool
+	require.NoError(t, db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM pg_indexes WHERE schemaname = $1 AND indexname = 'idx_transactions_from_created')`, schema,
+	).Scan(&indexed))
+	assert.True(t, indexed)
+
+	require.NoError(t, migrator.Down(ctx, migrator.Latest()))
+	assert.Equal(t, map[string][]string{
+		"schema_migrations": {"version", "name", "applied_at"},
+	}, columns(t, db, schema))
+}
+
+// columns lists the columns of every table in schema, in table order.
+func columns(t *testing.T, db *pgx.Conn, schema string) map[string][]string {
+	rows, err := db.Query(context.Background(), `SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = $1 ORDER BY table_name, ordinal_position`, schema)
+	require.NoError(t, err)
+	defer rows.Close()
+
+	tables := make(map[string][]string)
+	for rows.Next() {
+		var table, column string
+		require.NoError(t, rows.Scan(&table, &column))
+		tables[table] = append(tables[table], column)
+	}
+	require.NoError(t, rows.Err())
+
+	return tables
+}
@@ -0,0 +1,54 @@
+//go:build libpq
+
+package repository_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	config "github.com/dgt4l/avito_shop/configs/avito_shop"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+	"github.com/stretchr/testify/require"
+)
+
+// BenchmarkGetInfoLibPQ is the lib/pq side of BenchmarkGetInfo, the GetInfo
+// the service ran before the move to pgx:
+//
+//	AVITO_SHOP_TEST_POSTGRES=1 go test -tags libpq -run '^$' -bench GetInfo ./internal/avito_shop/repository/pgsql
+func BenchmarkGetInfoLibPQ(b *testing.B) {
+	if os.Getenv(postgresEnv) == "" {
+		b.Skipf("set %s to benchmark against Postgres", postgresEnv)
+	}
+
+	cfg, err := config.LoadConfig("../../../../test/e2e")
+	require.NoError(b, err)
+
+	repo, err := repository.NewRepository(cfg.DBConfig)
+	require.NoError(b, err)
+	defer repo.Close()
+
+	libpq, err := repository.NewLibPQRepository(cfg.DBConfig)
+	require.NoError(b, err)
+	defer libpq.Close()
+
+	ctx := context.Background()
+	request := &dto.InfoRequest{Id: seedInfoUser(b, repo), Limit: 20}
+
+	expected, err := libpq.GetInfo(ctx, request)
+	require.NoError(b, err)
+	actual, err := repo.GetInfo(ctx, request)
+	require.NoError(b, err)
+	require.Equal(b, expected.Coins, actual.Coins)
+	require.Equal(b, expected.Inventory, actual.Inventory)
+	require.Len(b, actual.CoinHistory.Sent, len(expected.CoinHistory.Sent))
+
+	b.Run("lib/pq sequential", func(b *testing.B) {
+		for range b.N {
+			if _, err := libpq.GetInfo(ctx, request); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	config "github.com/dgt4l/avito_shop/configs/avito_shop"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+	"github.com/stretchr/testify/require"
+)
+
+// BenchmarkGetInfo compares GetInfo, one pipelined pgx batch in a snapshot,
+// with the sequential queries it replaced, both over the same pgx pool:
+//
+//	AVITO_SHOP_TEST_POSTGRES=1 go test -run '^$' -bench GetInfo ./internal/avito_shop/repository/pgsql
+//
+// The gap grows with the network latency to the database. The libpq build tag
+// adds BenchmarkGetInfoLibPQ, the same sequential queries on sqlx and lib/pq.
+func BenchmarkGetInfo(b *testing.B) {
+	if os.Getenv(postgresEnv) == "" {
+		b.Skipf("set %s to benchmark against Postgres", postgresEnv)
+	}
+
+	cfg, err := config.LoadConfig("../../../../test/e2e")
+	require.NoError(b, err)
+
+	repo, err := repository.NewRepository(cfg.DBConfig)
+	require.NoError(b, err)
+	defer repo.Close()
+
+	ctx := context.Background()
+	request := &dto.InfoRequest{Id: seedInfoUser(b, repo), Limit: 20}
+
+	expected, err := repo.GetInfoSequential(ctx, request)
+	require.NoError(b, err)
+	actual, err := repo.GetInfo(ctx, request)
+	require.NoError(b, err)
+	require.Equal(b, expected.Coins, actual.Coins)
+	require.Equal(b, expected.Inventory, actual.Inventory)
+	require.Len(b, actual.CoinHistory.Sent, len(expected.CoinHistory.Sent))
+
+	b.Run("pgx batch", func(b *testing.B) {
+		for range b.N {
+			if _, err := repo.GetInfo(ctx, request); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("pgx sequential", func(b *testing.B) {
+		for range b.N {
+			if _, err := repo.GetInfoSequential(ctx, request); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// seedInfoUser creates a user with some purchases and transfers both ways,
+// so every query of GetInfo returns rows.
+func seedInfoUser(b *testing.B, repo *repository.Repository) int {
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+	user, peer := fmt.Sprintf("bench_%d", suffix), fmt.Sprintf("bench_peer_%d", suffix)
+
+	userId, err := repo.CreateUser(ctx, user, "password")
+	require.NoError(b, err)
+	peerId, err := repo.CreateUser(ctx, peer, "password")
+	require.NoError(b, err)
+
+	for range 10 {
+		_, err = repo.SendCoin(ctx, peer, userId, 5, 0, nil)
+		require.NoError(b, err)
+		_, err = repo.SendCoin(ctx, user, peerId, 3, 0, nil)
+		require.NoError(b, err)
+	}
+
+	for _, item := range []string{"cup", "book", "cup"} {
+		_, err = repo.BuyItem(ctx, userId, item, 1, nil)
+		require.NoError(b, err)
+	}
+
+	return userId
+}
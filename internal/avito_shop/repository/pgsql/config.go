@@ -1,12 +1,187 @@
 package repository
 
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultConnectAttempts  = 10
+	DefaultConnectBaseDelay = 500 * time.Millisecond
+	DefaultConnectMaxDelay  = 5 * time.Second
+)
+
+var defaultConnectRetry = RetryPolicy{
+	MaxAttempts: DefaultConnectAttempts,
+	BaseDelay:   DefaultConnectBaseDelay,
+	MaxDelay:    DefaultConnectMaxDelay,
+}
+
 type DBConfig struct {
-	DBDriver     string `mapstructure:"db_driver"`
-	DBUser       string `mapstructure:"db_user"`
-	DBPass       string `mapstructure:"db_password"`
-	DBHost       string `mapstructure:"db_host"`
-	DBPort       string `mapstructure:"db_port"`
-	DBName       string `mapstructure:"db_name"`
-	DBSSL        string `mapstructure:"db_ssl"`
-	DefaultCoins int    `mapstructure:"default_coins"`
+	DBDriver string `mapstructure:"db_driver"`
+	// DSN is a complete connection string, either a postgres:// URL or
+	// key=value pairs, used instead of the db_* fields below. Whatever neither
+	// sets is read by the driver from the PG* environment variables.
+	DSN    string `mapstructure:"dsn"`
+	DBUser string `mapstructure:"db_user"`
+	DBPass string `mapstructure:"db_password"`
+	DBHost string `mapstructure:"db_host"`
+	DBPort string `mapstructure:"db_port"`
+	DBName string `mapstructure:"db_name"`
+	DBSSL  string `mapstructure:"db_ssl"`
+	// DBSSLRootCert, DBSSLCert and DBSSLKey are file paths for verify-ca and
+	// verify-full modes and for client certificate authentication.
+	DBSSLRootCert string `mapstructure:"db_ssl_root_cert"`
+	DBSSLCert     string `mapstructure:"db_ssl_cert"`
+	DBSSLKey      string `mapstructure:"db_ssl_key"`
+
+	// Pool limits, zero keeps the pgxpool default. MinConns connections are
+	// kept open even when idle; without MaxOpenConns the default maximum is
+	// raised to MinConns if it is smaller.
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MinConns        int           `mapstructure:"min_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+
+	// ConnectTimeout bounds a single connection attempt and ConnectRetry how
+	// often the startup ping is repeated while the database is still booting.
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	ConnectRetry   RetryPolicy   `mapstructure:"connect_retry"`
+	// QueryTimeout is sent as the session statement_timeout, so the server
+	// cancels any single statement that runs longer. TxTimeout bounds each
+	// attempt of a transaction, commit included. Zero disables either.
+	QueryTimeout time.Duration `mapstructure:"query_timeout"`
+	TxTimeout    time.Duration `mapstructure:"tx_timeout"`
+
+	DefaultCoins int `mapstructure:"default_coins"`
+	// AutoMigrate applies pending schema migrations in NewRepository.
+	// Without it they are applied by the migrate command.
+	AutoMigrate bool `mapstructure:"auto_migrate"`
+	// TxRetry applies to the transactions that move coins.
+	TxRetry RetryPolicy `mapstructure:"tx_retry"`
+}
+
+// Validate rejects negative pool sizes and durations, a MinConns above
+// MaxOpenConns and a password without a user, which ConnString has no place
+// for.
+func (c DBConfig) Validate() error {
+	if c.MaxOpenConns < 0 || c.MinConns < 0 {
+		return fmt.Errorf("%w: pool sizes must not be negative", ErrInvalidDBConfig)
+	}
+
+	if c.MaxOpenConns > 0 && c.MinConns > c.MaxOpenConns {
+		return fmt.Errorf("%w: min_conns exceeds max_open_conns", ErrInvalidDBConfig)
+	}
+
+	if c.DSN == "" && c.DBPass != "" && c.DBUser == "" {
+		return fmt.Errorf("%w: db_password is set without db_user", ErrInvalidDBConfig)
+	}
+
+	durations := []time.Duration{
+		c.ConnMaxLifetime, c.ConnMaxIdleTime, c.ConnectTimeout, c.QueryTimeout, c.TxTimeout,
+	}
+	for _, d := range durations {
+		if d < 0 {
+			return fmt.Errorf("%w: timeouts must not be negative", ErrInvalidDBConfig)
+		}
+	}
+
+	return nil
+}
+
+// ConnString returns the connection string for pgx. Without DSN it is a
+// URL built from the db_* fields, with the credentials escaped; fields left
+// empty are omitted so the driver falls back to PG* environment variables.
+// The TLS and timeout settings are added to either form and take precedence
+// over the same parameters in DSN.
+func (c DBConfig) ConnString() string {
+	params := url.Values{}
+	setParam := func(key, value string) {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+
+	setParam("sslmode", c.DBSSL)
+	setParam("sslrootcert", c.DBSSLRootCert)
+	setParam("sslcert", c.DBSSLCert)
+	setParam("sslkey", c.DBSSLKey)
+
+	if c.ConnectTimeout > 0 {
+		// The driver takes whole seconds, round up so a sub-second timeout is
+		// not turned into none at all.
+		seconds := (c.ConnectTimeout + time.Second - 1) / time.Second
+		params.Set("connect_timeout", strconv.FormatInt(int64(seconds), 10))
+	}
+
+	if c.QueryTimeout > 0 {
+		params.Set("statement_timeout", strconv.FormatInt(c.QueryTimeout.Milliseconds(), 10))
+	}
+
+	if c.DSN != "" {
+		return withParams(c.DSN, params)
+	}
+
+	u := url.URL{Scheme: "postgres", Path: "/" + c.DBName}
+	if c.DBUser != "" && c.DBPass != "" {
+		u.User = url.UserPassword(c.DBUser, c.DBPass)
+	} else if c.DBUser != "" {
+		u.User = url.User(c.DBUser)
+	}
+
+	if c.DBHost != "" && c.DBPort != "" {
+		u.Host = net.JoinHostPort(c.DBHost, c.DBPort)
+	} else if c.DBHost != "" {
+		u.Host = c.DBHost
+	} else {
+		setParam("port", c.DBPort)
+	}
+
+	u.RawQuery = params.Encode()
+
+	return u.String()
+}
+
+// withParams adds params to a URL or key=value connection string. Later
+// keys win in the key=value form, so appending is enough there.
+func withParams(dsn string, params url.Values) string {
+	if len(params) == 0 {
+		return dsn
+	}
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			// Left for the driver to report when it parses dsn.
+			return dsn
+		}
+
+		query := u.Query()
+		for key := range params {
+			query.Set(key, params.Get(key))
+		}
+		u.RawQuery = query.Encode()
+
+		return u.String()
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(dsn)
+	for _, key := range keys {
+		value := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(params.Get(key))
+		fmt.Fprintf(&b, " %s='%s'", key, value)
+	}
+
+	return b.String()
 }
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// connect opens the pgx pool described by config and waits for the database
+// to answer, so a container that is still booting does not fail the start.
+func connect(config DBConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := newPoolConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ping(context.Background(), pool.Ping, config.ConnectRetry.withDefaults(defaultConnectRetry))
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// newPoolConfig validates config and turns it into the pgxpool settings.
+// Without MaxOpenConns the pool keeps its default size, raised to MinConns
+// when that is larger, so the connections kept open fit in the pool.
+func newPoolConfig(config DBConfig) (*pgxpool.Config, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(config.ConnString())
+	if err != nil {
+		return nil, err
+	}
+
+	// Every statement is prepared on first use and reused from the
+	// connection's cache afterwards.
+	poolConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+
+	if config.MaxOpenConns > 0 {
+		poolConfig.MaxConns = int32(config.MaxOpenConns)
+	}
+	if config.MinConns > 0 {
+		poolConfig.MinConns = int32(config.MinConns)
+		poolConfig.MaxConns = max(poolConfig.MaxConns, poolConfig.MinConns)
+	}
+	if config.ConnMaxLifetime > 0 {
+		poolConfig.MaxConnLifetime = config.ConnMaxLifetime
+	}
+	if config.ConnMaxIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = config.ConnMaxIdleTime
+	}
+
+	return poolConfig, nil
+}
+
+// ping retries a failing ping with policy's backoff and returns the last
+// error once the attempts are used up.
+func ping(ctx context.Context, pingFn func(context.Context) error, policy RetryPolicy) error {
+	const op = "internal.avito_shop.repository.connect"
+
+	for attempt := 1; ; attempt++ {
+		err := pingFn(ctx)
+		if err == nil || attempt == policy.MaxAttempts {
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		logrus.WithFields(logrus.Fields{"event": op, "attempt": attempt, "delay": delay}).Warn(err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
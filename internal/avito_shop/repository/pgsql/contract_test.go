@@ -0,0 +1,51 @@
+package repository_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	config "github.com/dgt4l/avito_shop/configs/avito_shop"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/repository/contract"
+	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// postgresEnv opts into the contract suite against the database configured
+// for the e2e tests. Every case starts from truncated tables.
+const postgresEnv = "AVITO_SHOP_TEST_POSTGRES"
+
+func TestRepository_Contract(t *testing.T) {
+	if os.Getenv(postgresEnv) == "" {
+		t.Skipf("set %s to run the contract suite against Postgres", postgresEnv)
+	}
+
+	cfg, err := config.LoadConfig("../../../../test/e2e")
+	require.NoError(t, err)
+
+	cfg.DBConfig.DefaultCoins = contract.DefaultCoins
+	// The concurrency cases pile every transaction onto the same rows.
+	cfg.DBConfig.TxRetry = repository.RetryPolicy{MaxAttempts: 100}
+
+	repo, err := repository.NewRepository(cfg.DBConfig)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, cfg.DBConfig.ConnString())
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+
+	contract.Run(t, func(t *testing.T) contract.Repository {
+		_, err := conn.Exec(ctx, `TRUNCATE TABLE users, items, inventory, transactions, purchases, idempotency_keys,
+			ledger_entries, ledger_transfers, ledger_accounts, sessions, invites, password_resets, login_attempts
+			RESTART IDENTITY CASCADE`)
+		require.NoError(t, err)
+
+		_, err = conn.Exec(ctx, `INSERT INTO ledger_accounts (code) VALUES ('issuance'), ('shop')`)
+		require.NoError(t, err)
+
+		return repo
+	})
+}
@@ -9,3 +9,31 @@ var ErrNotEnoughCoins = errors.New("not enough coins")
 var ErrItemNotFound = errors.New("item not found")
 
 var ErrUserToNotFound = errors.New("user receiver not found")
+
+var ErrItemAlreadyExists = errors.New("item already exists")
+
+var ErrOutOfStock = errors.New("item is out of stock")
+
+var ErrPurchaseLimitReached = errors.New("purchase limit for item reached")
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+
+var ErrUnbalancedTransfer = errors.New("ledger transfer is not balanced")
+
+var ErrUserAlreadyExists = errors.New("user already exists")
+
+var ErrInvalidInvite = errors.New("invite code is invalid or expired")
+
+var ErrInvalidResetToken = errors.New("password reset token is invalid or expired")
+
+var ErrDailyTransferLimit = errors.New("daily transfer limit exceeded")
+
+var ErrRecipientBlocked = errors.New("recipient is blocked")
+
+var ErrRecipientDisabled = errors.New("recipient account is disabled")
+
+var ErrSchemaAhead = errors.New("database schema is newer than the binary")
+
+var ErrInvalidMigration = errors.New("invalid migration")
+
+var ErrInvalidDBConfig = errors.New("invalid database config")
@@ -0,0 +1,88 @@
+//go:build libpq
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+)
+
+// LibPQRepository runs GetInfo the way it did before the move to pgx: sqlx
+// over lib/pq, one query and one round trip per part of the response. It is
+// only built with the libpq tag, as the driver baseline of BenchmarkGetInfo.
+type LibPQRepository struct {
+	db *sqlx.DB
+}
+
+func NewLibPQRepository(config DBConfig) (*LibPQRepository, error) {
+	db, err := sqlx.Connect("postgres", config.ConnString())
+	if err != nil {
+		return nil, err
+	}
+
+	return &LibPQRepository{db: db}, nil
+}
+
+func (r *LibPQRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *LibPQRepository) GetInfo(ctx context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error) {
+	userId := request.Id
+
+	var limit *int
+	if request.Limit > 0 {
+		limit = &request.Limit
+	}
+
+	var response dto.InfoResponse
+	err := r.db.QueryRowxContext(ctx, getCoins, userId).Scan(&response.Coins)
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &response.Inventory, getUserInventory, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Aggregate {
+		response.CoinTotals = &dto.CoinTotals{}
+		err = r.db.SelectContext(ctx, &response.CoinTotals.Received, getUserReceivedTotals, userId, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		err = r.db.SelectContext(ctx, &response.CoinTotals.Sent, getUserSentTotals, userId, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		return &response, nil
+	}
+
+	err = r.db.SelectContext(ctx, &response.CoinHistory.Received, getUserRecieved, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &response.CoinHistory.Sent, getUserSent, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &response.CoinHistory.Purchases, getUserPurchases, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
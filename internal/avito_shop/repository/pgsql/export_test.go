@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+)
+
+// GetInfoSequential is GetInfo as it ran before the batch: one query and one
+// round trip per part of the response, outside a transaction. It uses the
+// same pool as GetInfo and is kept as the baseline of BenchmarkGetInfo.
+func (r *Repository) GetInfoSequential(ctx context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error) {
+	userId := request.Id
+
+	var limit *int
+	if request.Limit > 0 {
+		limit = &request.Limit
+	}
+
+	var response dto.InfoResponse
+	err := r.pool.QueryRow(ctx, getCoins, userId).Scan(&response.Coins)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	response.Inventory, err = queryStructs[dto.Inventory](ctx, r.pool, getUserInventory, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Aggregate {
+		response.CoinTotals = &dto.CoinTotals{}
+		response.CoinTotals.Received, err = queryStructs[dto.CounterpartyTotal](ctx, r.pool, getUserReceivedTotals, userId, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		response.CoinTotals.Sent, err = queryStructs[dto.CounterpartyTotal](ctx, r.pool, getUserSentTotals, userId, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		return &response, nil
+	}
+
+	response.CoinHistory.Received, err = queryStructs[dto.Received](ctx, r.pool, getUserRecieved, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	response.CoinHistory.Sent, err = queryStructs[dto.Sent](ctx, r.pool, getUserSent, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	response.CoinHistory.Purchases, err = queryStructs[dto.Purchase](ctx, r.pool, getUserPurchases, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	"github.com/jackc/pgx/v5"
+)
+
+// claimIdempotencyKey reserves the key inside tx. A concurrent transaction
+// holding the same key makes the insert wait until it finishes, so a conflict
+// always sees a committed response. It reports whether the key was already
+// used and, if so, decodes the stored response into response.
+func claimIdempotencyKey(ctx context.Context, tx pgx.Tx, userId int, key *dto.IdempotencyKey, response any) (bool, error) {
+	if key == nil {
+		return false, nil
+	}
+
+	tag, err := tx.Exec(ctx, insertIdempotencyKey, userId, key.Key, key.Operation, key.RequestHash)
+	if err != nil {
+		return false, err
+	}
+
+	if tag.RowsAffected() == 1 {
+		return false, nil
+	}
+
+	return loadIdempotentResponse(ctx, tx, userId, key, response)
+}
+
+// GetIdempotentResponse looks the key up outside a transaction, so a caller
+// can replay a committed request before checking anything that may have
+// changed since. It reports whether the key was used, like claimIdempotencyKey.
+func (r *Repository) GetIdempotentResponse(ctx context.Context, userId int, key *dto.IdempotencyKey, response any) (bool, error) {
+	if key == nil {
+		return false, nil
+	}
+
+	replayed, err := loadIdempotentResponse(ctx, r.pool, userId, key, response)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+
+	return replayed, err
+}
+
+func loadIdempotentResponse(ctx context.Context, q querier, userId int, key *dto.IdempotencyKey, response any) (bool, error) {
+	var (
+		operation   string
+		requestHash string
+		stored      []byte
+	)
+	err := q.QueryRow(ctx, getIdempotencyKey, userId, key.Key).Scan(&operation, &requestHash, &stored)
+	if err != nil {
+		return false, err
+	}
+
+	if operation != key.Operation || requestHash != key.RequestHash {
+		return false, ErrIdempotencyKeyReused
+	}
+
+	return true, json.Unmarshal(stored, response)
+}
+
+func storeIdempotentResponse(ctx context.Context, tx pgx.Tx, userId int, key *dto.IdempotencyKey, response any) error {
+	if key == nil {
+		return nil
+	}
+
+	stored, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, updateIdempotencyKey, stored, userId, key.Key)
+	return err
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+)
+
+const (
+	ledgerKindMint     = "mint"
+	ledgerKindPurchase = "purchase"
+	ledgerKindTransfer = "transfer"
+
+	issuanceAccountCode = "issuance"
+	shopAccountCode     = "shop"
+)
+
+// ledgerAccount names an account in the ledger. User accounts carry the user
+// id so that posting to them also refreshes the cached users.coins balance.
+type ledgerAccount struct {
+	code   string
+	userId int
+}
+
+var (
+	issuanceAccount = ledgerAccount{code: issuanceAccountCode}
+	shopAccount     = ledgerAccount{code: shopAccountCode}
+)
+
+func userAccount(userId int) ledgerAccount {
+	return ledgerAccount{code: "user:" + strconv.Itoa(userId), userId: userId}
+}
+
+// ledgerEntry credits amount to account; a negative amount is a debit.
+type ledgerEntry struct {
+	account ledgerAccount
+	amount  int
+}
+
+// postLedgerTransfer writes entries as a single ledger transfer inside tx and
+// applies them to the users.coins cache. The entries must sum to zero, so
+// coins are only ever moved between accounts, never created or lost.
+func postLedgerTransfer(ctx context.Context, tx pgx.Tx, kind string, entries ...ledgerEntry) error {
+	var sum int
+	for _, entry := range entries {
+		sum += entry.amount
+	}
+
+	if len(entries) < 2 || sum != 0 {
+		return ErrUnbalancedTransfer
+	}
+
+	var transferId int
+	err := tx.QueryRow(ctx, insertLedgerTransfer, kind).Scan(&transferId)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		_, err = tx.Exec(ctx, insertLedgerEntry, transferId, entry.account.code, entry.amount)
+		if err != nil {
+			return err
+		}
+
+		if entry.account.userId == 0 {
+			continue
+		}
+
+		_, err = tx.Exec(ctx, updateUserBalance, entry.amount, entry.account.userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// VerifyLedger recomputes every user balance from the ledger and compares it
+// with the cached users.coins value. Both checks run in one snapshot so
+// concurrent purchases and transfers cannot produce false discrepancies.
+func (r *Repository) VerifyLedger(ctx context.Context) (*dto.LedgerReport, error) {
+	const op = "internal.avito_shop.repository.VerifyLedger"
+
+	var report dto.LedgerReport
+
+	opts := TxOptions{Isolation: pgx.RepeatableRead, ReadOnly: true}
+	err := r.withTx(ctx, op, opts, func(ctx context.Context, tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, getUnbalancedLedgerTransfers)
+		if err != nil {
+			return err
+		}
+
+		report.UnbalancedTransfers, err = pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return err
+		}
+
+		report.Discrepancies, err = queryStructs[dto.BalanceDiscrepancy](ctx, tx, getLedgerDiscrepancies)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Balanced = len(report.UnbalancedTransfers) == 0 && len(report.Discrepancies) == 0
+
+	return &report, nil
+}
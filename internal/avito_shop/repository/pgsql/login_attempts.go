@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+	"github.com/jackc/pgx/v5"
+)
+
+// The methods below let Repository act as the shared auth.LoginAttemptStore,
+// so every replica sees the same failure counters.
+
+func (r *Repository) GetLoginAttempts(ctx context.Context, key string) (*auth.LoginAttempts, error) {
+	attempts, err := queryStruct[auth.LoginAttempts](ctx, r.pool, getLoginAttempts, key)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return &auth.LoginAttempts{Key: key}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// RecordLoginFailure increments the counter in a single upsert, so concurrent
+// failures for the same key are all counted.
+func (r *Repository) RecordLoginFailure(ctx context.Context, key string, now time.Time, window time.Duration) (*auth.LoginAttempts, error) {
+	return queryStruct[auth.LoginAttempts](ctx, r.pool, upsertLoginFailure, key, now, now.Add(-window))
+}
+
+// ReleaseLoginAttempt decrements the counter, or deletes it when this was its
+// last failure, in one statement.
+func (r *Repository) ReleaseLoginAttempt(ctx context.Context, key string) error {
+	_, err := r.pool.Exec(ctx, releaseLoginAttempt, key)
+	return err
+}
+
+func (r *Repository) ResetLoginAttempts(ctx context.Context, key string) error {
+	_, err := r.pool.Exec(ctx, deleteLoginAttempts, key)
+	return err
+}
@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+
+	"github.com/dgt4l/avito_shop/migrations"
+)
+
+const undefinedTableCode = "42P01"
+
+// migrationLockId keys the advisory lock that keeps replicas starting at the
+// same time from applying a migration twice.
+const migrationLockId = 7264351
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrator applies the migrations embedded in the binary and records them in
+// schema_migrations. Each migration runs in its own transaction.
+type Migrator struct {
+	conn       migrationConn
+	pool       *pgxpool.Pool
+	release    func()
+	migrations []Migration
+}
+
+// migrationConn is the part of *pgx.Conn the migrator uses. Everything runs
+// on one connection, which holds the advisory lock between the statements.
+type migrationConn interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// NewMigrator connects to the database without checking or changing the
+// schema, so it also works on a schema that NewRepository refuses.
+func NewMigrator(config DBConfig) (*Migrator, error) {
+	pool, err := connect(config)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	migrator, err := newMigrator(conn.Conn(), migrations.FS)
+	if err != nil {
+		conn.Release()
+		pool.Close()
+		return nil, err
+	}
+	migrator.pool, migrator.release = pool, conn.Release
+
+	return migrator, nil
+}
+
+func newMigrator(conn migrationConn, fsys fs.FS) (*Migrator, error) {
+	loaded, err := loadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{conn: conn, migrations: loaded}, nil
+}
+
+func (m *Migrator) Close() error {
+	if m.release != nil {
+		m.release()
+	}
+
+	if m.pool != nil {
+		m.pool.Close()
+	}
+
+	return nil
+}
+
+// Latest is the schema version the binary was built for.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the latest applied version, zero for an empty database.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.conn.QueryRow(ctx, getSchemaVersion).Scan(&version)
+	if err != nil && isUndefinedTable(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// Check fails with ErrSchemaAhead when the database was migrated by a newer
+// binary, whose schema this one may not be able to use.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if version > m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, binary knows up to %d", ErrSchemaAhead, version, m.Latest())
+	}
+
+	if version < m.Latest() {
+		logrus.WithFields(logrus.Fields{"version": version, "latest": m.Latest()}).Warn("database schema is behind, run migrate up")
+	}
+
+	return nil
+}
+
+// Up applies every migration that has not been applied yet, in version order.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(applied map[int]bool, version int) error {
+		if version > m.Latest() {
+			return fmt.Errorf("%w: database is at version %d, binary knows up to %d", ErrSchemaAhead, version, m.Latest())
+		}
+
+		for _, migration := range m.migrations {
+			if applied[migration.Version] {
+				continue
+			}
+
+			err := m.apply(ctx, migration.Up, insertSchemaMigration, migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			logrus.WithFields(logrus.Fields{"version": migration.Version, "name": migration.Name}).Info("migration applied")
+		}
+
+		return nil
+	})
+}
+
+// Down reverts the steps most recently applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	byVersion := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	return m.withLock(ctx, func(applied map[int]bool, _ int) error {
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+		for _, version := range versions[:min(steps, len(versions))] {
+			migration, ok := byVersion[version]
+			if !ok {
+				return fmt.Errorf("%w: no down migration for version %d", ErrSchemaAhead, version)
+			}
+
+			err := m.apply(ctx, migration.Down, deleteSchemaMigration, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			logrus.WithFields(logrus.Fields{"version": migration.Version, "name": migration.Name}).Info("migration reverted")
+		}
+
+		return nil
+	})
+}
+
+// withLock runs fn holding the migration advisory lock, with the set of
+// applied versions and the latest of them. The configured statement timeout
+// is lifted on the migrator's connection: waiting for another replica's
+// migration or running a long one is not a slow query.
+func (m *Migrator) withLock(
+	ctx context.Context, fn func(applied map[int]bool, version int) error,
+) error {
+	const op = "internal.avito_shop.repository.Migrator"
+
+	if _, err := m.conn.Exec(ctx, disableStatementTimeout); err != nil {
+		return err
+	}
+
+	defer func() {
+		if _, err := m.conn.Exec(context.Background(), resetStatementTimeout); err != nil {
+			logrus.WithFields(logrus.Fields{"event": op}).Error(err)
+		}
+	}()
+
+	if _, err := m.conn.Exec(ctx, lockMigrations, migrationLockId); err != nil {
+		return err
+	}
+
+	defer func() {
+		if _, err := m.conn.Exec(context.Background(), unlockMigrations, migrationLockId); err != nil {
+			logrus.WithFields(logrus.Fields{"event": op}).Error(err)
+		}
+	}()
+
+	if _, err := m.conn.Exec(ctx, createSchemaMigrations); err != nil {
+		return err
+	}
+
+	rows, err := m.conn.Query(ctx, getAppliedMigrations)
+	if err != nil {
+		return err
+	}
+
+	versions, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[int]bool, len(versions))
+	var version int
+	for _, v := range versions {
+		applied[v] = true
+		version = max(version, v)
+	}
+
+	return fn(applied, version)
+}
+
+// apply runs a migration script and records it with record in one
+// transaction, so a failing script leaves neither schema nor version behind.
+func (m *Migrator) apply(ctx context.Context, script, record string, args ...any) error {
+	const op = "internal.avito_shop.repository.Migrator"
+
+	tx, err := m.conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, script)
+	if err == nil {
+		_, err = tx.Exec(ctx, record, args...)
+	}
+	if err != nil {
+		if err := tx.Rollback(ctx); err != nil {
+			logrus.WithFields(logrus.Fields{"event": op}).Error(err)
+		}
+
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// loadMigrations reads the up and down scripts of every version in fsys and
+// returns them sorted by version.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMigration, entry.Name())
+		}
+
+		script, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("%w: version %d is used by %s and %s", ErrInvalidMigration, version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	loaded := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("%w: version %d needs both up and down scripts", ErrInvalidMigration, migration.Version)
+		}
+
+		loaded = append(loaded, *migration)
+	}
+
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].Version < loaded[j].Version
+	})
+
+	return loaded, nil
+}
+
+func isUndefinedTable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == undefinedTableCode
+}
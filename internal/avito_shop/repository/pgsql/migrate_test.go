@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dgt4l/avito_shop/migrations"
+)
+
+var testMigrations = fstest.MapFS{
+	"000001_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT)")},
+	"000001_users.down.sql": {Data: []byte("DROP TABLE users")},
+	"000002_items.up.sql":   {Data: []byte("CREATE TABLE items (id INT)")},
+	"000002_items.down.sql": {Data: []byte("DROP TABLE items")},
+	"README.md":             {Data: []byte("not a migration")},
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		name         string
+		fsys         fstest.MapFS
+		expectedResp func(*testing.T, []Migration, error)
+	}{
+		{
+			name: "sorted by version",
+			fsys: testMigrations,
+			expectedResp: func(t *testing.T, loaded []Migration, err error) {
+				require.NoError(t, err)
+				assert.Equal(t, []Migration{
+					{Version: 1, Name: "users", Up: "CREATE TABLE users (id INT)", Down: "DROP TABLE users"},
+					{Version: 2, Name: "items", Up: "CREATE TABLE items (id INT)", Down: "DROP TABLE items"},
+				}, loaded)
+			},
+		},
+		{
+			name: "missing down script",
+			fsys: fstest.MapFS{"000001_users.up.sql": {Data: []byte("CREATE TABLE users (id INT)")}},
+			expectedResp: func(t *testing.T, loaded []Migration, err error) {
+				assert.Nil(t, loaded)
+				assert.ErrorIs(t, err, ErrInvalidMigration)
+			},
+		},
+		{
+			name: "unversioned file",
+			fsys: fstest.MapFS{"init.sql": {Data: []byte("CREATE TABLE users (id INT)")}},
+			expectedResp: func(t *testing.T, loaded []Migration, err error) {
+				assert.Nil(t, loaded)
+				assert.ErrorIs(t, err, ErrInvalidMigration)
+			},
+		},
+		{
+			name: "version used twice",
+			fsys: fstest.MapFS{
+				"000001_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT)")},
+				"000001_users.down.sql": {Data: []byte("DROP TABLE users")},
+				"000001_items.up.sql":   {Data: []byte("CREATE TABLE items (id INT)")},
+				"000001_items.down.sql": {Data: []byte("DROP TABLE items")},
+			},
+			expectedResp: func(t *testing.T, loaded []Migration, err error) {
+				assert.Nil(t, loaded)
+				assert.ErrorIs(t, err, ErrInvalidMigration)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded, err := loadMigrations(tt.fsys)
+			tt.expectedResp(t, loaded, err)
+		})
+	}
+}
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	loaded, err := loadMigrations(migrations.FS)
+	require.NoError(t, err)
+	require.NotEmpty(t, loaded)
+	assert.Equal(t, 1, loaded[0].Version)
+
+	// Databases set up from init.sql already have some of what a migration
+	// creates, so every statement has to tolerate that.
+	statement := regexp.MustCompile(`(?i)\b(CREATE TABLE|CREATE INDEX|ADD COLUMN|DROP TABLE|DROP INDEX|DROP COLUMN)\b( IF (NOT )?EXISTS)?`)
+	for _, migration := range loaded {
+		for _, script := range []string{migration.Up, migration.Down} {
+			for _, match := range statement.FindAllStringSubmatch(script, -1) {
+				assert.NotEmpty(t, match[2], "%06d_%s: %s without IF [NOT] EXISTS", migration.Version, migration.Name, match[1])
+			}
+		}
+	}
+}
+
+func TestMigrator_Up(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	require.NoError(t, err)
+
+	migrator, err := newMigrator(mock, testMigrations)
+	require.NoError(t, err)
+
+	expectLocked := func(applied ...int) {
+		mock.ExpectExec(regexp.QuoteMeta(disableStatementTimeout)).
+			WillReturnResult(pgxmock.NewResult("SET", 0))
+		mock.ExpectExec(regexp.QuoteMeta(lockMigrations)).
+			WithArgs(migrationLockId).
+			WillReturnResult(pgxmock.NewResult("SELECT", 0))
+		mock.ExpectExec(regexp.QuoteMeta(createSchemaMigrations)).
+			WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+
+		rows := pgxmock.NewRows([]string{"version"})
+		for _, version := range applied {
+			rows.AddRow(version)
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(getAppliedMigrations)).WillReturnRows(rows)
+	}
+
+	expectUnlocked := func() {
+		mock.ExpectExec(regexp.QuoteMeta(unlockMigrations)).
+			WithArgs(migrationLockId).
+			WillReturnResult(pgxmock.NewResult("SELECT", 0))
+		mock.ExpectExec(regexp.QuoteMeta(resetStatementTimeout)).
+			WillReturnResult(pgxmock.NewResult("RESET", 0))
+	}
+
+	tests := []struct {
+		name         string
+		mockExpect   func()
+		expectedResp func(*testing.T, error)
+	}{
+		{
+			name: "applies pending migrations in order",
+			mockExpect: func() {
+				expectLocked(1)
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE items (id INT)")).
+					WillReturnResult(pgxmock.NewResult("RESET", 0))
+				mock.ExpectExec(regexp.QuoteMeta(insertSchemaMigration)).
+					WithArgs(2, "items").
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectCommit()
+				expectUnlocked()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "up to date",
+			mockExpect: func() {
+				expectLocked(1, 2)
+				expectUnlocked()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "failing script is not recorded",
+			mockExpect: func() {
+				expectLocked()
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE users (id INT)")).
+					WillReturnError(&pgconn.PgError{Code: "42P07"})
+				mock.ExpectRollback()
+				expectUnlocked()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "migration 1_users")
+			},
+		},
+		{
+			name: "schema ahead of the binary",
+			mockExpect: func() {
+				expectLocked(1, 2, 3)
+				expectUnlocked()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrSchemaAhead)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			err := migrator.Up(context.Background())
+			tt.expectedResp(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestMigrator_Down(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	require.NoError(t, err)
+
+	migrator, err := newMigrator(mock, testMigrations)
+	require.NoError(t, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(disableStatementTimeout)).
+		WillReturnResult(pgxmock.NewResult("SET", 0))
+	mock.ExpectExec(regexp.QuoteMeta(lockMigrations)).
+		WithArgs(migrationLockId).
+		WillReturnResult(pgxmock.NewResult("SELECT", 0))
+	mock.ExpectExec(regexp.QuoteMeta(createSchemaMigrations)).
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.ExpectQuery(regexp.QuoteMeta(getAppliedMigrations)).
+		WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(1).AddRow(2))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("DROP TABLE items")).
+		WillReturnResult(pgxmock.NewResult("DROP TABLE", 0))
+	mock.ExpectExec(regexp.QuoteMeta(deleteSchemaMigration)).
+		WithArgs(2).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(unlockMigrations)).
+		WithArgs(migrationLockId).
+		WillReturnResult(pgxmock.NewResult("SELECT", 0))
+	mock.ExpectExec(regexp.QuoteMeta(resetStatementTimeout)).
+		WillReturnResult(pgxmock.NewResult("RESET", 0))
+
+	assert.NoError(t, migrator.Down(context.Background(), 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMigrator_Check(t *testing.T) {
+	mock, err := pgxmock.NewConn()
+	require.NoError(t, err)
+
+	migrator, err := newMigrator(mock, testMigrations)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		mockExpect   func()
+		expectedResp func(*testing.T, error)
+	}{
+		{
+			name: "empty database",
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(getSchemaVersion)).
+					WillReturnError(&pgconn.PgError{Code: undefinedTableCode})
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "current schema",
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(getSchemaVersion)).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(2))
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "schema ahead of the binary",
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(getSchemaVersion)).
+					WillReturnRows(pgxmock.NewRows([]string{"version"}).AddRow(3))
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrSchemaAhead)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			err := migrator.Check(context.Background())
+			tt.expectedResp(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
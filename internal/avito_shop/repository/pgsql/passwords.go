@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
+	"github.com/jackc/pgx/v5"
+)
+
+func (r *Repository) GetUserById(ctx context.Context, id int) (*models.User, error) {
+	user, err := queryStruct[models.User](ctx, r.pool, getUserById, id)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, userId int, password string) error {
+	tag, err := r.pool.Exec(ctx, updateUserPassword, password, userId)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	return nil
+}
+
+// CreatePasswordReset stores the hash of a one-time reset token. Issuing a
+// new token invalidates the ones the user has not redeemed yet.
+func (r *Repository) CreatePasswordReset(ctx context.Context, username, tokenHash string, createdBy int, expiresAt time.Time) error {
+	const op = "internal.avito_shop.repository.CreatePasswordReset"
+
+	return r.withTx(ctx, op, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, expirePasswordResets, username); err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, insertPasswordReset, tokenHash, username, createdBy, expiresAt)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return ErrUserNotFound
+		}
+
+		return nil
+	})
+}
+
+// ResetPassword redeems a reset token and sets the new password in one
+// transaction, so a token can be used exactly once.
+func (r *Repository) ResetPassword(ctx context.Context, tokenHash, password string) (int, error) {
+	const op = "internal.avito_shop.repository.ResetPassword"
+
+	var userId int
+	err := r.withTx(ctx, op, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, redeemPasswordReset, tokenHash).Scan(&userId)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidResetToken
+		} else if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, updateUserPassword, password, userId)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return userId, nil
+}
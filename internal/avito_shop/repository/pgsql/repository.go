@@ -2,222 +2,625 @@ package repository
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
-
-	"github.com/jmoiron/sqlx"
-	"github.com/sirupsen/logrus"
+	"time"
 
 	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/repository/internal/order"
+	"github.com/dgt4l/avito_shop/migrations"
 
-	_ "github.com/lib/pq"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const uniqueViolationCode = "23505"
+
+// Repository talks to Postgres through a pgx pool.
 type Repository struct {
-	db  *sqlx.DB
-	cfg DBConfig
+	pool pgxPool
+	cfg  DBConfig
+}
+
+// querier runs statements on the pool or inside a transaction.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
 }
 
+// pgxPool is the part of *pgxpool.Pool the repository uses, so that tests
+// can substitute pgxmock.
+type pgxPool interface {
+	querier
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Close()
+}
+
+// NewRepository connects to the database and, with config.AutoMigrate,
+// brings the schema up to date. It refuses a schema migrated by a newer
+// binary.
 func NewRepository(config DBConfig) (*Repository, error) {
-	db, err := sqlx.Open(
-		"postgres", fmt.Sprintf(
-			"%s://%s:%s@%s:%s/%s?sslmode=%s",
-			config.DBDriver,
-			config.DBUser,
-			config.DBPass,
-			config.DBHost,
-			config.DBPort,
-			config.DBName,
-			config.DBSSL,
-		),
-	)
+	pool, err := connect(config)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.Ping()
-	if err != nil {
+	if err := migrate(pool, config.AutoMigrate); err != nil {
+		pool.Close()
 		return nil, err
 	}
+
 	return &Repository{
-		db:  db,
-		cfg: config,
+		pool: pool,
+		cfg:  config,
 	}, nil
 }
 
+// migrate runs the migrator on a connection borrowed from pool.
+func migrate(pool *pgxpool.Pool, up bool) error {
+	ctx := context.Background()
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	migrator, err := newMigrator(conn.Conn(), migrations.FS)
+	if err == nil && up {
+		err = migrator.Up(ctx)
+	}
+	if err == nil {
+		err = migrator.Check(ctx)
+	}
+
+	return err
+}
+
 func (r *Repository) Close() error {
-	return r.db.Close()
+	r.pool.Close()
+
+	return nil
 }
 
 func (r *Repository) GetUser(ctx context.Context, username string) (*models.User, error) {
-	var user models.User
-	err := r.db.QueryRowxContext(ctx, getFromUsers, username).StructScan(&user)
-
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
+	user, err := queryStruct[models.User](ctx, r.pool, getFromUsers, username)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrUserNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-func (r *Repository) BuyItem(ctx context.Context, userId int, item string) error {
-	const op = "internal.avito_shop.repository.BuyItem"
+func (r *Repository) BuyItem(
+	ctx context.Context, userId int, item string, quantity int, key *dto.IdempotencyKey,
+) (*dto.OrderResponse, error) {
+	return r.CreateOrder(ctx, userId, []dto.OrderItem{{Item: item, Quantity: quantity}}, key)
+}
 
-	tx, err := r.db.BeginTxx(ctx, nil)
-	defer func() {
-		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
-			logrus.WithFields(logrus.Fields{"event": op}).Error(err)
-		}
-	}()
+// CreateOrder debits coins and fills the inventory for every order line in a
+// single serializable transaction, retried on conflicts. Item rows are locked
+// in name order before the user row, so concurrent orders never wait on each
+// other in a cycle.
+func (r *Repository) CreateOrder(
+	ctx context.Context, userId int, items []dto.OrderItem, key *dto.IdempotencyKey,
+) (*dto.OrderResponse, error) {
+	const op = "internal.avito_shop.repository.CreateOrder"
+
+	var response *dto.OrderResponse
+	err := r.withTx(ctx, op, r.moneyTxOptions(), func(ctx context.Context, tx pgx.Tx) error {
+		var err error
+		response, err = createOrder(ctx, tx, userId, items, key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
 
+func createOrder(
+	ctx context.Context, tx pgx.Tx, userId int, items []dto.OrderItem, key *dto.IdempotencyKey,
+) (*dto.OrderResponse, error) {
+	var response dto.OrderResponse
+	replayed, err := claimIdempotencyKey(ctx, tx, userId, key, &response)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var itemModel models.Item
-	err = tx.QueryRowxContext(ctx, getFromItems, item).StructScan(&itemModel)
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
-		return ErrItemNotFound
-	} else if err != nil {
-		return err
+	if replayed {
+		response.Replayed = true
+		return &response, nil
+	}
+
+	lines := order.MergeItems(items)
+
+	itemModels := make([]*models.Item, len(lines))
+	for i, line := range lines {
+		itemModels[i], err = queryStruct[models.Item](ctx, tx, getFromItems, line.Item)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrItemNotFound
+		} else if err != nil {
+			return nil, err
+		}
 	}
 
 	var userCoins int
-	err = tx.QueryRowxContext(ctx, getCoinsFromUser, userId).Scan(&userCoins)
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
-		return ErrUserNotFound
+	err = tx.QueryRow(ctx, getCoinsFromUser, userId).Scan(&userCoins)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
 	} else if err != nil {
-		return err
+		return nil, err
 	}
 
-	if userCoins < itemModel.Price {
-		return ErrNotEnoughCoins
+	var total int
+	for i, line := range lines {
+		itemModel := itemModels[i]
+
+		if itemModel.Stock != nil && *itemModel.Stock < line.Quantity {
+			return nil, ErrOutOfStock
+		}
+
+		if itemModel.MaxPerUser != nil {
+			var owned int
+			err = tx.QueryRow(ctx, getUserItemQuantity, userId, itemModel.Id).Scan(&owned)
+			if err != nil {
+				return nil, err
+			}
+
+			if owned+line.Quantity > *itemModel.MaxPerUser {
+				return nil, ErrPurchaseLimitReached
+			}
+		}
+
+		total += itemModel.Price * line.Quantity
 	}
 
-	_, err = tx.ExecContext(ctx, updateCoinsFromUser, itemModel.Price, userId)
-	if err != nil {
-		return err
+	if userCoins < total {
+		return nil, ErrNotEnoughCoins
 	}
 
-	_, err = tx.ExecContext(ctx, insertToInventory, userId, itemModel.Id)
+	response.Total = total
+
+	err = postLedgerTransfer(
+		ctx, tx, ledgerKindPurchase,
+		ledgerEntry{account: userAccount(userId), amount: -total},
+		ledgerEntry{account: shopAccount, amount: total},
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
+	for i, line := range lines {
+		itemModel := itemModels[i]
+
+		if itemModel.Stock != nil {
+			_, err = tx.Exec(ctx, updateItemStock, line.Quantity, itemModel.Id)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		_, err = tx.Exec(ctx, insertToInventory, userId, itemModel.Id, line.Quantity)
+		if err != nil {
+			return nil, err
+		}
+
+		purchase := dto.Purchase{Item: itemModel.Name, Quantity: line.Quantity, Amount: itemModel.Price * line.Quantity}
+		err = tx.QueryRow(
+			ctx, insertToPurchases, userId, itemModel.Id, purchase.Quantity, purchase.Amount,
+		).Scan(&purchase.Id, &purchase.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		response.Purchases = append(response.Purchases, purchase)
 	}
 
-	return nil
+	if err := storeIdempotentResponse(ctx, tx, userId, key, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
 }
 
-func (r *Repository) GetInfo(ctx context.Context, userId int) (*dto.InfoResponse, error) {
-	var userCoins int
-	err := r.db.QueryRowxContext(ctx, getCoins, userId).Scan(&userCoins)
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
+// GetInfo returns the full history unless request.Limit restricts every list
+// to the latest entries; with request.Aggregate the history is replaced by
+// per-counterparty totals. All queries go out in one round trip, as a single
+// pgx batch between BEGIN and COMMIT of a read-only repeatable-read
+// transaction, so they see the same snapshot. When a statement fails the
+// connection is left in the aborted transaction and the pool discards it on
+// release.
+func (r *Repository) GetInfo(ctx context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error) {
+	userId := request.Id
+
+	var limit *int
+	if request.Limit > 0 {
+		limit = &request.Limit
+	}
+
+	ctx, cancel := r.txContext(ctx)
+	defer cancel()
+
+	var response dto.InfoResponse
+	batch := &pgx.Batch{}
+	batch.Queue(beginSnapshot)
+	batch.Queue(getCoins, userId).QueryRow(func(row pgx.Row) error {
+		return row.Scan(&response.Coins)
+	})
+	batch.Queue(getUserInventory, userId).Query(appendRows(&response.Inventory))
+
+	if request.Aggregate {
+		response.CoinTotals = &dto.CoinTotals{}
+		batch.Queue(getUserReceivedTotals, userId, limit).Query(appendRows(&response.CoinTotals.Received))
+		batch.Queue(getUserSentTotals, userId, limit).Query(appendRows(&response.CoinTotals.Sent))
+	} else {
+		batch.Queue(getUserRecieved, userId, limit).Query(appendRows(&response.CoinHistory.Received))
+		batch.Queue(getUserSent, userId, limit).Query(appendRows(&response.CoinHistory.Sent))
+		batch.Queue(getUserPurchases, userId, limit).Query(appendRows(&response.CoinHistory.Purchases))
+	}
+	batch.Queue(commitSnapshot)
+
+	err := r.pool.SendBatch(ctx, batch).Close()
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
 		return nil, ErrUserNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
-	var userInventory []dto.Inventory
-	err = r.db.SelectContext(ctx, &userInventory, getUserInventory, userId)
+	return &response, nil
+}
+
+// appendRows scans every row into a T by the db tags of its fields. dst is
+// left nil when there are no rows.
+func appendRows[T any](dst *[]T) func(rows pgx.Rows) error {
+	return func(rows pgx.Rows) error {
+		var err error
+		*dst, err = pgx.AppendRows(*dst, rows, pgx.RowToStructByName[T])
+		return err
+	}
+}
+
+func (r *Repository) GetHistory(ctx context.Context, filter *dto.HistoryFilter) ([]dto.HistoryEntry, error) {
+	var (
+		afterTime *time.Time
+		afterType *string
+		afterId   *int
+	)
+	if filter.After != nil {
+		afterTime, afterType, afterId = &filter.After.CreatedAt, &filter.After.Type, &filter.After.Id
+	}
+
+	return queryStructs[dto.HistoryEntry](
+		ctx, r.pool, getUserHistory,
+		filter.UserId, filter.Type, filter.Counterparty, filter.From, filter.To,
+		afterTime, afterType, afterId, filter.Limit,
+	)
+}
+
+// SendCoin moves amount from the sender to toUser in a serializable
+// transaction, retried on conflicts. dailyLimit caps what the sender may
+// transfer over the last 24 hours, zero means no cap; the sum is read under
+// the sender's row lock, so concurrent transfers cannot both slip under it.
+func (r *Repository) SendCoin(
+	ctx context.Context, toUser string, fromUserId, amount, dailyLimit int, key *dto.IdempotencyKey,
+) (*dto.SendCoinResponse, error) {
+	const op = "internal.avito_shop.repository.SendCoin"
+
+	var response *dto.SendCoinResponse
+	err := r.withTx(ctx, op, r.moneyTxOptions(), func(ctx context.Context, tx pgx.Tx) error {
+		var err error
+		response, err = sendCoin(ctx, tx, toUser, fromUserId, amount, dailyLimit, key)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	var userRecieved []dto.Received
-	err = r.db.SelectContext(ctx, &userRecieved, getUserRecieved, userId)
+	return response, nil
+}
+
+// sendCoin locks both users in id order rather than sender first: two users
+// sending to each other at the same time would otherwise deadlock.
+func sendCoin(
+	ctx context.Context, tx pgx.Tx, toUser string, fromUserId, amount, dailyLimit int, key *dto.IdempotencyKey,
+) (*dto.SendCoinResponse, error) {
+	var response dto.SendCoinResponse
+	replayed, err := claimIdempotencyKey(ctx, tx, fromUserId, key, &response)
 	if err != nil {
 		return nil, err
 	}
 
-	var userSent []dto.Sent
-	err = r.db.SelectContext(ctx, &userSent, getUserSent, userId)
-	if err != nil {
+	if replayed {
+		response.Replayed = true
+		return &response, nil
+	}
+
+	var toUserId int
+	err = tx.QueryRow(ctx, getIdFromUsers, toUser).Scan(&toUserId)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserToNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
-	return &dto.InfoResponse{
-		Coins:     userCoins,
-		Inventory: userInventory,
-		CoinHistory: dto.CoinHistory{
-			Received: userRecieved,
-			Sent:     userSent,
-		},
-	}, nil
-}
+	lockOrder := []int{fromUserId, toUserId}
+	if toUserId < fromUserId {
+		lockOrder = []int{toUserId, fromUserId}
+	}
+
+	coins := make(map[int]int, len(lockOrder))
+	statuses := make(map[int]string, len(lockOrder))
+	for _, userId := range lockOrder {
+		var userCoins int
+		var status string
+		err = tx.QueryRow(ctx, getCoinsAndStatusFromUser, userId).Scan(&userCoins, &status)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) && userId == toUserId {
+			return nil, ErrUserToNotFound
+		} else if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		} else if err != nil {
+			return nil, err
+		}
 
-func (r *Repository) SendCoin(ctx context.Context, toUser string, fromUserId, amount int) error {
-	const op = "internal.avito_shop.repository.SendItem"
+		coins[userId], statuses[userId] = userCoins, status
+	}
+
+	// The status is read under the row lock, so a recipient blocked while
+	// the transfer runs waits for it or is seen as blocked.
+	switch statuses[toUserId] {
+	case models.UserStatusBlocked:
+		return nil, ErrRecipientBlocked
+	case models.UserStatusDisabled:
+		return nil, ErrRecipientDisabled
+	}
 
-	tx, err := r.db.BeginTxx(ctx, nil)
-	defer func() {
-		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
-			logrus.WithFields(logrus.Fields{"event": op}).Error(err)
+	if coins[fromUserId] < amount {
+		return nil, ErrNotEnoughCoins
+	}
+
+	if dailyLimit > 0 {
+		var sentToday int
+		if err := tx.QueryRow(ctx, getUserSentToday, fromUserId).Scan(&sentToday); err != nil {
+			return nil, err
 		}
-	}()
 
+		if sentToday+amount > dailyLimit {
+			return nil, ErrDailyTransferLimit
+		}
+	}
+
+	err = postLedgerTransfer(
+		ctx, tx, ledgerKindTransfer,
+		ledgerEntry{account: userAccount(fromUserId), amount: -amount},
+		ledgerEntry{account: userAccount(toUserId), amount: amount},
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	var toUserId int
-	err = tx.QueryRowContext(ctx, getIdFromUsers, toUser).Scan(&toUserId)
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
-		return ErrUserToNotFound
+	response.ToUser, response.Amount = toUser, amount
+	err = tx.QueryRow(ctx, insertToTransactions, fromUserId, toUserId, amount).Scan(&response.Id, &response.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storeIdempotentResponse(ctx, tx, fromUserId, key, &response); err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (r *Repository) GetItems(ctx context.Context, request *dto.ItemsRequest) ([]dto.Item, error) {
+	column, ok := itemsSortColumns[request.SortBy]
+	if !ok {
+		column = itemsSortColumns[dto.SortById]
+	}
+
+	direction, ok := itemsOrderDirections[request.Order]
+	if !ok {
+		direction = itemsOrderDirections[dto.OrderAsc]
+	}
+
+	return queryStructs[dto.Item](ctx, r.pool, fmt.Sprintf(getItems, column, direction), request.MinPrice, request.MaxPrice)
+}
+
+func (r *Repository) CreateItem(ctx context.Context, request *models.Item) (*models.Item, error) {
+	item, err := queryStruct[models.Item](
+		ctx, r.pool, insertToItems, request.Name, request.Price, request.Stock, request.MaxPerUser,
+	)
+	if err != nil && isUniqueViolation(err) {
+		return nil, ErrItemAlreadyExists
 	} else if err != nil {
-		return err
+		return nil, err
 	}
 
-	var userCoins int
-	err = tx.QueryRowxContext(ctx, getCoinsFromUser, fromUserId).Scan(&userCoins)
-	if err != nil && errors.Is(err, sql.ErrNoRows) {
-		return ErrUserNotFound
+	return item, nil
+}
+
+func (r *Repository) UpdateItemPrice(ctx context.Context, id, price int) (*models.Item, error) {
+	item, err := queryStruct[models.Item](ctx, r.pool, updateItemPrice, price, id)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrItemNotFound
 	} else if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = tx.ExecContext(ctx, getCoinsToUser, toUser)
+	return item, nil
+}
+
+func (r *Repository) SetItemLimits(ctx context.Context, id int, stock, maxPerUser *int) (*models.Item, error) {
+	item, err := queryStruct[models.Item](ctx, r.pool, updateItemLimits, stock, maxPerUser, id)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrItemNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+func (r *Repository) RetireItem(ctx context.Context, id int) error {
+	tag, err := r.pool.Exec(ctx, retireItem, id)
 	if err != nil {
 		return err
 	}
 
-	if userCoins < amount {
-		return ErrNotEnoughCoins
+	if tag.RowsAffected() == 0 {
+		return ErrItemNotFound
 	}
 
-	_, err = tx.ExecContext(ctx, updateCoinsFromUser, amount, fromUserId)
+	return nil
+}
+
+func (r *Repository) SetUserRole(ctx context.Context, username, role string) error {
+	tag, err := r.pool.Exec(ctx, updateUserRole, role, username)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.ExecContext(ctx, updateCoinsToUser, amount, toUser)
-	if err != nil {
-		return err
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
 	}
 
-	_, err = tx.ExecContext(ctx, insertToTransactions, fromUserId, toUserId, amount)
+	return nil
+}
+
+func (r *Repository) SetUserStatus(ctx context.Context, username, status string) error {
+	tag, err := r.pool.Exec(ctx, updateUserStatus, status, username)
 	if err != nil {
 		return err
 	}
 
-	if err := tx.Commit(); err != nil {
-		return err
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
 	}
 
 	return nil
 }
 
+// RehashPassword replaces the stored hash only if it is still oldHash, so a
+// rehash on login cannot undo a password change that happened meanwhile.
+func (r *Repository) RehashPassword(ctx context.Context, userId int, oldHash, newHash string) error {
+	_, err := r.pool.Exec(ctx, rehashUserPassword, newHash, userId, oldHash)
+	return err
+}
+
 func (r *Repository) CreateUser(ctx context.Context, username, password string) (int, error) {
+	const op = "internal.avito_shop.repository.CreateUser"
+
 	var id int
-	err := r.db.QueryRowxContext(ctx, insertToUsers, username, password, r.cfg.DefaultCoins).Scan(&id)
+	err := r.withTx(ctx, op, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		var err error
+		id, err = r.createUser(ctx, tx, username, password)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// CreateInvitedUser creates the user and redeems the invite atomically: an
+// invite that is unknown, expired or already used rolls the signup back.
+func (r *Repository) CreateInvitedUser(ctx context.Context, username, password, invite string) (int, error) {
+	const op = "internal.avito_shop.repository.CreateInvitedUser"
+
+	var id int
+	err := r.withTx(ctx, op, TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		var err error
+		id, err = r.createUser(ctx, tx, username, password)
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, redeemInvite, id, invite)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return ErrInvalidInvite
+		}
+
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
+
 	return id, nil
 }
+
+func (r *Repository) CreateInvite(ctx context.Context, code string, createdBy int, expiresAt time.Time) error {
+	_, err := r.pool.Exec(ctx, insertInvite, code, createdBy, expiresAt)
+	return err
+}
+
+// createUser opens a ledger account for the new user and mints DefaultCoins
+// into it from the issuance account.
+func (r *Repository) createUser(ctx context.Context, tx pgx.Tx, username, password string) (int, error) {
+	var id int
+	err := tx.QueryRow(ctx, insertToUsers, username, password).Scan(&id)
+	if err != nil && isUniqueViolation(err) {
+		return 0, ErrUserAlreadyExists
+	} else if err != nil {
+		return 0, err
+	}
+
+	account := userAccount(id)
+	_, err = tx.Exec(ctx, insertLedgerAccount, account.code, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if r.cfg.DefaultCoins > 0 {
+		err = postLedgerTransfer(
+			ctx, tx, ledgerKindMint,
+			ledgerEntry{account: issuanceAccount, amount: -r.cfg.DefaultCoins},
+			ledgerEntry{account: account, amount: r.cfg.DefaultCoins},
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// queryStruct scans the single row returned by sql into a T by the db tags of
+// its fields. It fails with pgx.ErrNoRows when there is no row.
+func queryStruct[T any](ctx context.Context, q querier, sql string, args ...any) (*T, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectOneRow(rows, pgx.RowToAddrOfStructByName[T])
+}
+
+// queryStructs scans every row returned by sql into a T by the db tags of its
+// fields. Unlike appendRows it returns an empty slice when there are no rows.
+func queryStructs[T any](ctx context.Context, q querier, sql string, args ...any) ([]T, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[T])
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
+
@@ -2,24 +2,28 @@ package repository
 
 import (
 	"context"
-	"database/sql"
+	"fmt"
+	"io"
 	"regexp"
 	"testing"
+	"time"
 
-	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/models"
-	"github.com/jmoiron/sqlx"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pashagolub/pgxmock/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestRepository_GetUser(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
-	defer db.Close()
+	defer mock.Close()
 
-	repo := &Repository{db: sqlx.NewDb(db, "sqlmock")}
+	repo := &Repository{pool: mock}
 
 	tests := []struct {
 		name         string
@@ -31,8 +35,8 @@ func TestRepository_GetUser(t *testing.T) {
 			name:     "success GetUser",
 			username: "testuser",
 			mockExpect: func() {
-				rows := sqlmock.NewRows([]string{"id", "username", "password_salt"}).
-					AddRow(1, "testuser", "hashedpassword")
+				rows := pgxmock.NewRows([]string{"id", "username", "password_salt", "role", "status"}).
+					AddRow(1, "testuser", "hashedpassword", "user", "active")
 				mock.ExpectQuery(regexp.QuoteMeta(getFromUsers)).
 					WithArgs("testuser").
 					WillReturnRows(rows)
@@ -41,6 +45,7 @@ func TestRepository_GetUser(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, "testuser", user.Username)
 				assert.Equal(t, "hashedpassword", user.Password)
+				assert.Equal(t, models.RoleUser, user.Role)
 			},
 		},
 		{
@@ -49,7 +54,7 @@ func TestRepository_GetUser(t *testing.T) {
 			mockExpect: func() {
 				mock.ExpectQuery(regexp.QuoteMeta(getFromUsers)).
 					WithArgs("nonexistent").
-					WillReturnError(sql.ErrNoRows)
+					WillReturnError(pgx.ErrNoRows)
 			},
 			expectedResp: func(t *testing.T, user *models.User, err error) {
 				assert.Error(t, err)
@@ -69,11 +74,12 @@ func TestRepository_GetUser(t *testing.T) {
 }
 
 func TestRepository_BuyItem(t *testing.T) {
-	db, mock, err := sqlmock.New()
+	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
-	defer db.Close()
+	defer mock.Close()
 
-	repo := &Repository{db: sqlx.NewDb(db, "sqlmock")}
+	repo := &Repository{pool: mock}
+	createdAt := time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)
 
 	tests := []struct {
 		name         string
@@ -87,21 +93,25 @@ func TestRepository_BuyItem(t *testing.T) {
 			userId: 1,
 			item:   "item1",
 			mockExpect: func() {
-				mock.ExpectBegin()
-				rows := sqlmock.NewRows([]string{"id", "name", "price"}).
-					AddRow(1, "item1", 100)
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				rows := pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).
+					AddRow(1, "item1", 100, nil, nil)
 				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
 					WithArgs("item1").
 					WillReturnRows(rows)
 				mock.ExpectQuery(regexp.QuoteMeta(getCoinsFromUser)).
 					WithArgs(1).
-					WillReturnRows(sqlmock.NewRows([]string{"coins"}).AddRow(200))
-				mock.ExpectExec(regexp.QuoteMeta(updateCoinsFromUser)).
-					WithArgs(100, 1).
-					WillReturnResult(sqlmock.NewResult(1, 1))
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(200))
+				expectLedgerTransfer(mock, ledgerKindPurchase,
+					ledgerEntry{account: userAccount(1), amount: -100},
+					ledgerEntry{account: shopAccount, amount: 100},
+				)
 				mock.ExpectExec(regexp.QuoteMeta(insertToInventory)).
-					WithArgs(1, 1).
-					WillReturnResult(sqlmock.NewResult(1, 1))
+					WithArgs(1, 1, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectQuery(regexp.QuoteMeta(insertToPurchases)).
+					WithArgs(1, 1, 1, 100).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
 				mock.ExpectCommit()
 			},
 			expectedResp: func(t *testing.T, err error) {
@@ -113,10 +123,10 @@ func TestRepository_BuyItem(t *testing.T) {
 			userId: 1,
 			item:   "nonexistent",
 			mockExpect: func() {
-				mock.ExpectBegin()
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
 				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
 					WithArgs("nonexistent").
-					WillReturnError(sql.ErrNoRows)
+					WillReturnError(pgx.ErrNoRows)
 				mock.ExpectRollback()
 			},
 			expectedResp: func(t *testing.T, err error) {
@@ -129,15 +139,15 @@ func TestRepository_BuyItem(t *testing.T) {
 			userId: 1,
 			item:   "item1",
 			mockExpect: func() {
-				mock.ExpectBegin()
-				rows := sqlmock.NewRows([]string{"id", "name", "price"}).
-					AddRow(1, "item1", 100)
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				rows := pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).
+					AddRow(1, "item1", 100, nil, nil)
 				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
 					WithArgs("item1").
 					WillReturnRows(rows)
 				mock.ExpectQuery(regexp.QuoteMeta(getCoinsFromUser)).
 					WithArgs(1).
-					WillReturnRows(sqlmock.NewRows([]string{"coins"}).AddRow(50))
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(50))
 				mock.ExpectRollback()
 			},
 			expectedResp: func(t *testing.T, err error) {
@@ -145,67 +155,368 @@ func TestRepository_BuyItem(t *testing.T) {
 				assert.Equal(t, ErrNotEnoughCoins, err)
 			},
 		},
+		{
+			name:   "successful BuyItem with limited stock",
+			userId: 1,
+			item:   "pink-hoody",
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				rows := pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).
+					AddRow(10, "pink-hoody", 500, intPtr(3), intPtr(2))
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("pink-hoody").
+					WillReturnRows(rows)
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsFromUser)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(1000))
+				mock.ExpectQuery(regexp.QuoteMeta(getUserItemQuantity)).
+					WithArgs(1, 10).
+					WillReturnRows(pgxmock.NewRows([]string{"quantity"}).AddRow(1))
+				expectLedgerTransfer(mock, ledgerKindPurchase,
+					ledgerEntry{account: userAccount(1), amount: -500},
+					ledgerEntry{account: shopAccount, amount: 500},
+				)
+				mock.ExpectExec(regexp.QuoteMeta(updateItemStock)).
+					WithArgs(1, 10).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectExec(regexp.QuoteMeta(insertToInventory)).
+					WithArgs(1, 10, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectQuery(regexp.QuoteMeta(insertToPurchases)).
+					WithArgs(1, 10, 1, 500).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
+				mock.ExpectCommit()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:   "out of stock",
+			userId: 1,
+			item:   "pink-hoody",
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				rows := pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).
+					AddRow(10, "pink-hoody", 500, intPtr(0), nil)
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("pink-hoody").
+					WillReturnRows(rows)
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsFromUser)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(1000))
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, ErrOutOfStock, err)
+			},
+		},
+		{
+			name:   "purchase limit reached",
+			userId: 1,
+			item:   "pink-hoody",
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				rows := pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).
+					AddRow(10, "pink-hoody", 500, nil, intPtr(1))
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("pink-hoody").
+					WillReturnRows(rows)
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsFromUser)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(1000))
+				mock.ExpectQuery(regexp.QuoteMeta(getUserItemQuantity)).
+					WithArgs(1, 10).
+					WillReturnRows(pgxmock.NewRows([]string{"quantity"}).AddRow(1))
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, ErrPurchaseLimitReached, err)
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockExpect()
-			err := repo.BuyItem(context.Background(), tt.userId, tt.item)
+			_, err := repo.BuyItem(context.Background(), tt.userId, tt.item, 1, nil)
 			tt.expectedResp(t, err)
 			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
 
-func TestRepository_GetInfo(t *testing.T) {
-	db, mock, err := sqlmock.New()
+func TestRepository_CreateOrder(t *testing.T) {
+	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
-	defer db.Close()
+	defer mock.Close()
 
-	repo := &Repository{db: sqlx.NewDb(db, "sqlmock")}
+	repo := &Repository{pool: mock}
+	createdAt := time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)
 
 	tests := []struct {
 		name         string
 		userId       int
+		items        []dto.OrderItem
 		mockExpect   func()
-		expectedResp func(*testing.T, *dto.InfoResponse, error)
+		expectedResp func(*testing.T, error)
 	}{
 		{
-			name:   "success GetInfo",
+			name:   "successful CreateOrder",
 			userId: 1,
+			items: []dto.OrderItem{
+				{Item: "pen", Quantity: 3},
+				{Item: "cup", Quantity: 1},
+				{Item: "pen", Quantity: 2},
+			},
 			mockExpect: func() {
-				mock.ExpectQuery(regexp.QuoteMeta(getCoins)).
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("cup").
+					WillReturnRows(pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).AddRow(2, "cup", 20, nil, nil))
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("pen").
+					WillReturnRows(pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).AddRow(4, "pen", 10, nil, nil))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsFromUser)).
 					WithArgs(1).
-					WillReturnRows(sqlmock.NewRows([]string{"coins"}).AddRow(100))
-				mock.ExpectQuery(regexp.QuoteMeta(getUserInventory)).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(1000))
+				expectLedgerTransfer(mock, ledgerKindPurchase,
+					ledgerEntry{account: userAccount(1), amount: -70},
+					ledgerEntry{account: shopAccount, amount: 70},
+				)
+				mock.ExpectExec(regexp.QuoteMeta(insertToInventory)).
+					WithArgs(1, 2, 1).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectQuery(regexp.QuoteMeta(insertToPurchases)).
+					WithArgs(1, 2, 1, 20).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
+				mock.ExpectExec(regexp.QuoteMeta(insertToInventory)).
+					WithArgs(1, 4, 5).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectQuery(regexp.QuoteMeta(insertToPurchases)).
+					WithArgs(1, 4, 5, 50).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
+				mock.ExpectCommit()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:   "not enough coins for whole order",
+			userId: 1,
+			items: []dto.OrderItem{
+				{Item: "hoody", Quantity: 2},
+				{Item: "cup", Quantity: 1},
+			},
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("cup").
+					WillReturnRows(pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).AddRow(2, "cup", 20, nil, nil))
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("hoody").
+					WillReturnRows(pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).AddRow(6, "hoody", 300, nil, nil))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsFromUser)).
 					WithArgs(1).
-					WillReturnRows(sqlmock.NewRows([]string{"name", "quantity"}).AddRow("item1", 1))
-				mock.ExpectQuery(regexp.QuoteMeta(getUserRecieved)).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(600))
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, ErrNotEnoughCoins, err)
+			},
+		},
+		{
+			name:   "unknown item rolls back the order",
+			userId: 1,
+			items: []dto.OrderItem{
+				{Item: "cup", Quantity: 1},
+				{Item: "yacht", Quantity: 1},
+			},
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("cup").
+					WillReturnRows(pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).AddRow(2, "cup", 20, nil, nil))
+				mock.ExpectQuery(regexp.QuoteMeta(getFromItems)).
+					WithArgs("yacht").
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, ErrItemNotFound, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			_, err := repo.CreateOrder(context.Background(), tt.userId, tt.items, nil)
+			tt.expectedResp(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_SendCoin(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+	createdAt := time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)
+	key := &dto.IdempotencyKey{Key: "key-1", Operation: "sendCoin", RequestHash: "hash"}
+
+	tests := []struct {
+		name         string
+		key          *dto.IdempotencyKey
+		dailyLimit   int
+		mockExpect   func()
+		expectedResp func(*testing.T, *dto.SendCoinResponse, error)
+	}{
+		{
+			name:       "successful SendCoin stores the response",
+			key:        key,
+			dailyLimit: 100,
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectExec(regexp.QuoteMeta(insertIdempotencyKey)).
+					WithArgs(1, "key-1", "sendCoin", "hash").
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+					WithArgs("user2").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
 					WithArgs(1).
-					WillReturnRows(sqlmock.NewRows([]string{"from_user", "amount"}).AddRow("user2", 50))
-				mock.ExpectQuery(regexp.QuoteMeta(getUserSent)).
+					WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+					WithArgs(2).
+					WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+				mock.ExpectQuery(regexp.QuoteMeta(getUserSentToday)).
 					WithArgs(1).
-					WillReturnRows(sqlmock.NewRows([]string{"to_user", "amount"}).AddRow("user3", 30))
+					WillReturnRows(pgxmock.NewRows([]string{"sum"}).AddRow(40))
+				expectLedgerTransfer(mock, ledgerKindTransfer,
+					ledgerEntry{account: userAccount(1), amount: -50},
+					ledgerEntry{account: userAccount(2), amount: 50},
+				)
+				mock.ExpectQuery(regexp.QuoteMeta(insertToTransactions)).
+					WithArgs(1, 2, 50).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(7, createdAt))
+				mock.ExpectExec(regexp.QuoteMeta(updateIdempotencyKey)).
+					WithArgs(pgxmock.AnyArg(), 1, "key-1").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectCommit()
 			},
-			expectedResp: func(t *testing.T, info *dto.InfoResponse, err error) {
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
 				assert.NoError(t, err)
-				assert.Equal(t, 100, info.Coins)
-				assert.Equal(t, 1, len(info.Inventory))
-				assert.Equal(t, 1, len(info.CoinHistory.Received))
-				assert.Equal(t, 1, len(info.CoinHistory.Sent))
+				assert.Equal(t, &dto.SendCoinResponse{Id: 7, ToUser: "user2", Amount: 50, CreatedAt: createdAt}, response)
 			},
 		},
 		{
-			name:   "user not found",
-			userId: 1,
+			name: "replayed key returns the stored response",
+			key:  key,
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectExec(regexp.QuoteMeta(insertIdempotencyKey)).
+					WithArgs(1, "key-1", "sendCoin", "hash").
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 0))
+				mock.ExpectQuery(regexp.QuoteMeta(getIdempotencyKey)).
+					WithArgs(1, "key-1").
+					WillReturnRows(pgxmock.NewRows([]string{"operation", "request_hash", "response"}).
+						AddRow("sendCoin", "hash", []byte(`{"id":7,"toUser":"user2","amount":50,"createdAt":"2025-02-14T12:00:00Z"}`)))
+				mock.ExpectCommit()
+			},
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, &dto.SendCoinResponse{Id: 7, ToUser: "user2", Amount: 50, CreatedAt: createdAt, Replayed: true}, response)
+			},
+		},
+		{
+			name: "key reused with a different request",
+			key:  key,
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectExec(regexp.QuoteMeta(insertIdempotencyKey)).
+					WithArgs(1, "key-1", "sendCoin", "hash").
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 0))
+				mock.ExpectQuery(regexp.QuoteMeta(getIdempotencyKey)).
+					WithArgs(1, "key-1").
+					WillReturnRows(pgxmock.NewRows([]string{"operation", "request_hash", "response"}).
+						AddRow("sendCoin", "other-hash", []byte(`{}`)))
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
+				assert.Nil(t, response)
+				assert.Equal(t, ErrIdempotencyKeyReused, err)
+			},
+		},
+		{
+			name: "not enough coins without key",
 			mockExpect: func() {
-				mock.ExpectQuery(regexp.QuoteMeta(getCoins)).
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+					WithArgs("user2").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
 					WithArgs(1).
-					WillReturnError(sql.ErrNoRows)
+					WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(10, models.UserStatusActive))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+					WithArgs(2).
+					WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+				mock.ExpectRollback()
 			},
-			expectedResp: func(t *testing.T, info *dto.InfoResponse, err error) {
-				assert.Error(t, err)
-				assert.Equal(t, ErrUserNotFound, err)
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
+				assert.Nil(t, response)
+				assert.Equal(t, ErrNotEnoughCoins, err)
+			},
+		},
+		{
+			name:       "daily limit exceeded",
+			dailyLimit: 100,
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+					WithArgs("user2").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+					WithArgs(2).
+					WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+				mock.ExpectQuery(regexp.QuoteMeta(getUserSentToday)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"sum"}).AddRow(60))
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
+				assert.Nil(t, response)
+				assert.Equal(t, ErrDailyTransferLimit, err)
+			},
+		},
+		{
+			name: "recipient blocked",
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+					WithArgs("user2").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+				mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+					WithArgs(2).
+					WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusBlocked))
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
+				assert.Nil(t, response)
+				assert.Equal(t, ErrRecipientBlocked, err)
 			},
 		},
 	}
@@ -213,39 +524,173 @@ func TestRepository_GetInfo(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockExpect()
-			info, err := repo.GetInfo(context.Background(), tt.userId)
-			tt.expectedResp(t, info, err)
+			response, err := repo.SendCoin(context.Background(), "user2", 1, 50, tt.dailyLimit, tt.key)
+			tt.expectedResp(t, response, err)
 			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
 
-func TestRepository_CreateUser(t *testing.T) {
-	db, mock, err := sqlmock.New()
+func TestRepository_GetIdempotentResponse(t *testing.T) {
+	mock, err := pgxmock.NewPool()
 	require.NoError(t, err)
-	defer db.Close()
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+	ctx := context.Background()
+	key := &dto.IdempotencyKey{Key: "key-1", Operation: "sendCoin", RequestHash: "hash"}
+
+	mock.ExpectQuery(regexp.QuoteMeta(getIdempotencyKey)).
+		WithArgs(1, "key-1").
+		WillReturnRows(pgxmock.NewRows([]string{"operation", "request_hash", "response"}).
+			AddRow("sendCoin", "hash", []byte(`{"id":7,"toUser":"user2","amount":50}`)))
+
+	var response dto.SendCoinResponse
+	replayed, err := repo.GetIdempotentResponse(ctx, 1, key, &response)
+	assert.NoError(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, dto.SendCoinResponse{Id: 7, ToUser: "user2", Amount: 50}, response)
+
+	mock.ExpectQuery(regexp.QuoteMeta(getIdempotencyKey)).
+		WithArgs(1, "key-1").
+		WillReturnError(pgx.ErrNoRows)
+
+	replayed, err = repo.GetIdempotentResponse(ctx, 1, key, &response)
+	assert.NoError(t, err)
+	assert.False(t, replayed)
+
+	replayed, err = repo.GetIdempotentResponse(ctx, 1, nil, &response)
+	assert.NoError(t, err)
+	assert.False(t, replayed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_SendCoin_LocksLowerIdFirst(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+	createdAt := time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+	mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+		WithArgs("user2").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+		WithArgs(2).
+		WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+	mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+		WithArgs(3).
+		WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+	expectLedgerTransfer(mock, ledgerKindTransfer,
+		ledgerEntry{account: userAccount(3), amount: -50},
+		ledgerEntry{account: userAccount(2), amount: 50},
+	)
+	mock.ExpectQuery(regexp.QuoteMeta(insertToTransactions)).
+		WithArgs(3, 2, 50).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(7, createdAt))
+	mock.ExpectCommit()
+
+	response, err := repo.SendCoin(context.Background(), "user2", 3, 50, 0, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &dto.SendCoinResponse{Id: 7, ToUser: "user2", Amount: 50, CreatedAt: createdAt}, response)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_SendCoin_Retry(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{
+		pool: mock,
+		cfg:  DBConfig{TxRetry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}},
+	}
+	createdAt := time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)
 
-	repo := &Repository{db: sqlx.NewDb(db, "sqlmock"), cfg: DBConfig{DefaultCoins: 100}}
+	expectSuccess := func() {
+		mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+		mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+			WithArgs("user2").
+			WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(2))
+		mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+			WithArgs(1).
+			WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+		mock.ExpectQuery(regexp.QuoteMeta(getCoinsAndStatusFromUser)).
+			WithArgs(2).
+			WillReturnRows(pgxmock.NewRows([]string{"coins", "status"}).AddRow(1000, models.UserStatusActive))
+		expectLedgerTransfer(mock, ledgerKindTransfer,
+			ledgerEntry{account: userAccount(1), amount: -50},
+			ledgerEntry{account: userAccount(2), amount: 50},
+		)
+		mock.ExpectQuery(regexp.QuoteMeta(insertToTransactions)).
+			WithArgs(1, 2, 50).
+			WillReturnRows(pgxmock.NewRows([]string{"id", "created_at"}).AddRow(7, createdAt))
+	}
 
 	tests := []struct {
 		name         string
-		username     string
-		password     string
 		mockExpect   func()
-		expectedResp func(*testing.T, int, error)
+		expectedResp func(*testing.T, *dto.SendCoinResponse, error)
 	}{
 		{
-			name:     "success CreateUser",
-			username: "testuser",
-			password: "testpassword",
+			name: "serialization failure at commit is retried",
 			mockExpect: func() {
-				mock.ExpectQuery(regexp.QuoteMeta(insertToUsers)).
-					WithArgs("testuser", "testpassword", 100).
-					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				expectSuccess()
+				mock.ExpectCommit().WillReturnError(&pgconn.PgError{Code: serializationFailureCode})
+				expectSuccess()
+				mock.ExpectCommit()
 			},
-			expectedResp: func(t *testing.T, id int, err error) {
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
 				assert.NoError(t, err)
-				assert.Equal(t, 1, id)
+				assert.Equal(t, &dto.SendCoinResponse{Id: 7, ToUser: "user2", Amount: 50, CreatedAt: createdAt}, response)
+			},
+		},
+		{
+			name: "deadlock is retried",
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+					WithArgs("user2").
+					WillReturnError(&pgconn.PgError{Code: deadlockDetectedCode})
+				mock.ExpectRollback()
+				expectSuccess()
+				mock.ExpectCommit()
+			},
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, &dto.SendCoinResponse{Id: 7, ToUser: "user2", Amount: 50, CreatedAt: createdAt}, response)
+			},
+		},
+		{
+			name: "gives up after max attempts",
+			mockExpect: func() {
+				for range 2 {
+					mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+					mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+						WithArgs("user2").
+						WillReturnError(&pgconn.PgError{Code: serializationFailureCode})
+					mock.ExpectRollback()
+				}
+			},
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
+				assert.Nil(t, response)
+				assert.True(t, isRetryable(err))
+			},
+		},
+		{
+			name: "other errors are not retried",
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.Serializable})
+				mock.ExpectQuery(regexp.QuoteMeta(getIdFromUsers)).
+					WithArgs("user2").
+					WillReturnError(io.ErrUnexpectedEOF)
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, response *dto.SendCoinResponse, err error) {
+				assert.Nil(t, response)
+				assert.Equal(t, io.ErrUnexpectedEOF, err)
 			},
 		},
 	}
@@ -253,9 +698,1016 @@ func TestRepository_CreateUser(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.mockExpect()
-			id, err := repo.CreateUser(context.Background(), tt.username, tt.password)
-			tt.expectedResp(t, id, err)
+			response, err := repo.SendCoin(context.Background(), "user2", 1, 50, 0, nil)
+			tt.expectedResp(t, response, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{}.withDefaults(defaultTxRetry)
+	assert.Equal(t, RetryPolicy{MaxAttempts: DefaultTxMaxAttempts, BaseDelay: DefaultTxBaseDelay, MaxDelay: DefaultTxMaxDelay}, policy)
+	assert.Equal(t, 3, RetryPolicy{MaxAttempts: 3}.withDefaults(defaultConnectRetry).MaxAttempts)
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		ceiling := min(DefaultTxBaseDelay<<(attempt-1), DefaultTxMaxDelay)
+		for range 100 {
+			delay := policy.backoff(attempt)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.Less(t, delay, ceiling)
+		}
+	}
+}
+
+func TestRepository_WithTx_Timeout(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock, cfg: DBConfig{TxTimeout: 10 * time.Millisecond}}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = repo.withTx(context.Background(), "test", TxOptions{}, func(ctx context.Context, tx pgx.Tx) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPing(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	tests := []struct {
+		name         string
+		mockExpect   func(pgxmock.PgxPoolIface)
+		expectedResp func(*testing.T, error)
+	}{
+		{
+			name: "database comes up",
+			mockExpect: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectPing().WillReturnError(io.ErrUnexpectedEOF)
+				mock.ExpectPing().WillReturnError(io.ErrUnexpectedEOF)
+				mock.ExpectPing()
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "attempts used up",
+			mockExpect: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectPing().WillReturnError(io.ErrUnexpectedEOF)
+				mock.ExpectPing().WillReturnError(io.ErrUnexpectedEOF)
+				mock.ExpectPing().WillReturnError(io.ErrUnexpectedEOF)
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			require.NoError(t, err)
+			defer mock.Close()
+
+			tt.mockExpect(mock)
+			err = ping(context.Background(), mock.Ping, policy)
+			tt.expectedResp(t, err)
 			assert.NoError(t, mock.ExpectationsWereMet())
 		})
 	}
 }
+
+func TestRepository_GetInfo(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+	createdAt := time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)
+	limit := 5
+
+	// expectSkipped declares the history part of the batch, which a failed
+	// statement keeps from running.
+	expectSkipped := func(batch *pgxmock.ExpectedBatch) {
+		for _, query := range []string{getUserRecieved, getUserSent, getUserPurchases} {
+			batch.ExpectQuery(regexp.QuoteMeta(query)).WithArgs(1, (*int)(nil)).Maybe()
+		}
+		batch.ExpectExec(regexp.QuoteMeta(commitSnapshot)).Maybe()
+	}
+
+	tests := []struct {
+		name         string
+		request      *dto.InfoRequest
+		mockExpect   func()
+		expectedResp func(*testing.T, *dto.InfoResponse, error)
+	}{
+		{
+			name:    "success GetInfo",
+			request: &dto.InfoRequest{Id: 1},
+			mockExpect: func() {
+				batch := mock.ExpectBatch()
+				batch.ExpectExec(regexp.QuoteMeta(beginSnapshot)).
+					WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+				batch.ExpectQuery(regexp.QuoteMeta(getCoins)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(100))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserInventory)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"name", "quantity"}).AddRow("item1", 1))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserRecieved)).
+					WithArgs(1, (*int)(nil)).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "from_user", "amount", "created_at"}).
+						AddRow(7, "user2", 50, createdAt))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserSent)).
+					WithArgs(1, (*int)(nil)).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "to_user", "amount", "created_at"}).
+						AddRow(8, "user3", 30, createdAt))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserPurchases)).
+					WithArgs(1, (*int)(nil)).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "item", "quantity", "amount", "created_at"}).
+						AddRow(3, "item1", 1, 20, createdAt))
+				batch.ExpectExec(regexp.QuoteMeta(commitSnapshot)).
+					WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+			},
+			expectedResp: func(t *testing.T, info *dto.InfoResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 100, info.Coins)
+				assert.Equal(t, []dto.Inventory{{Type: "item1", Quantity: 1}}, info.Inventory)
+				assert.Equal(t, []dto.Received{{Id: 7, FromUser: "user2", Amount: 50, CreatedAt: createdAt}}, info.CoinHistory.Received)
+				assert.Equal(t, []dto.Sent{{Id: 8, ToUser: "user3", Amount: 30, CreatedAt: createdAt}}, info.CoinHistory.Sent)
+				assert.Equal(t, []dto.Purchase{{Id: 3, Item: "item1", Quantity: 1, Amount: 20, CreatedAt: createdAt}}, info.CoinHistory.Purchases)
+			},
+		},
+		{
+			name:    "latest entries only",
+			request: &dto.InfoRequest{Id: 1, Limit: limit},
+			mockExpect: func() {
+				batch := mock.ExpectBatch()
+				batch.ExpectExec(regexp.QuoteMeta(beginSnapshot)).
+					WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+				batch.ExpectQuery(regexp.QuoteMeta(getCoins)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(100))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserInventory)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"name", "quantity"}))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserRecieved)).
+					WithArgs(1, &limit).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "from_user", "amount", "created_at"}))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserSent)).
+					WithArgs(1, &limit).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "to_user", "amount", "created_at"}))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserPurchases)).
+					WithArgs(1, &limit).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "item", "quantity", "amount", "created_at"}))
+				batch.ExpectExec(regexp.QuoteMeta(commitSnapshot)).
+					WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+			},
+			expectedResp: func(t *testing.T, info *dto.InfoResponse, err error) {
+				assert.NoError(t, err)
+				assert.Nil(t, info.Inventory)
+				assert.Nil(t, info.CoinTotals)
+			},
+		},
+		{
+			name:    "aggregated totals",
+			request: &dto.InfoRequest{Id: 1, Aggregate: true},
+			mockExpect: func() {
+				batch := mock.ExpectBatch()
+				batch.ExpectExec(regexp.QuoteMeta(beginSnapshot)).
+					WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+				batch.ExpectQuery(regexp.QuoteMeta(getCoins)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}).AddRow(100))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserInventory)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"name", "quantity"}))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserReceivedTotals)).
+					WithArgs(1, (*int)(nil)).
+					WillReturnRows(pgxmock.NewRows([]string{"username", "amount", "count"}).AddRow("user2", 150, 3))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserSentTotals)).
+					WithArgs(1, (*int)(nil)).
+					WillReturnRows(pgxmock.NewRows([]string{"username", "amount", "count"}).AddRow("user3", 30, 1))
+				batch.ExpectExec(regexp.QuoteMeta(commitSnapshot)).
+					WillReturnResult(pgxmock.NewResult("COMMIT", 0))
+			},
+			expectedResp: func(t *testing.T, info *dto.InfoResponse, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, &dto.CoinTotals{
+					Received: []dto.CounterpartyTotal{{User: "user2", Amount: 150, Count: 3}},
+					Sent:     []dto.CounterpartyTotal{{User: "user3", Amount: 30, Count: 1}},
+				}, info.CoinTotals)
+				assert.Nil(t, info.CoinHistory.Received)
+			},
+		},
+		{
+			name:    "user not found",
+			request: &dto.InfoRequest{Id: 1},
+			mockExpect: func() {
+				batch := mock.ExpectBatch()
+				batch.ExpectExec(regexp.QuoteMeta(beginSnapshot)).
+					WillReturnResult(pgxmock.NewResult("BEGIN", 0))
+				batch.ExpectQuery(regexp.QuoteMeta(getCoins)).
+					WithArgs(1).
+					WillReturnRows(pgxmock.NewRows([]string{"coins"}))
+				batch.ExpectQuery(regexp.QuoteMeta(getUserInventory)).WithArgs(1).Maybe()
+				expectSkipped(batch)
+			},
+			expectedResp: func(t *testing.T, info *dto.InfoResponse, err error) {
+				assert.Nil(t, info)
+				assert.Equal(t, ErrUserNotFound, err)
+			},
+		},
+		{
+			name:    "snapshot not taken",
+			request: &dto.InfoRequest{Id: 1},
+			mockExpect: func() {
+				batch := mock.ExpectBatch()
+				batch.ExpectExec(regexp.QuoteMeta(beginSnapshot)).
+					WillReturnError(&pgconn.PgError{Code: "25001"})
+				batch.ExpectQuery(regexp.QuoteMeta(getCoins)).WithArgs(1).Maybe()
+				batch.ExpectQuery(regexp.QuoteMeta(getUserInventory)).WithArgs(1).Maybe()
+				expectSkipped(batch)
+			},
+			expectedResp: func(t *testing.T, info *dto.InfoResponse, err error) {
+				assert.Nil(t, info)
+				var pgErr *pgconn.PgError
+				assert.ErrorAs(t, err, &pgErr)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			info, err := repo.GetInfo(context.Background(), tt.request)
+			tt.expectedResp(t, info, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_CreateUser(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock, cfg: DBConfig{DefaultCoins: 100}}
+
+	tests := []struct {
+		name         string
+		username     string
+		password     string
+		mockExpect   func()
+		expectedResp func(*testing.T, int, error)
+	}{
+		{
+			name:     "success CreateUser",
+			username: "testuser",
+			password: "testpassword",
+			mockExpect: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(insertToUsers)).
+					WithArgs("testuser", "testpassword").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec(regexp.QuoteMeta(insertLedgerAccount)).
+					WithArgs("user:1", 1).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				expectLedgerTransfer(mock, ledgerKindMint,
+					ledgerEntry{account: issuanceAccount, amount: -100},
+					ledgerEntry{account: userAccount(1), amount: 100},
+				)
+				mock.ExpectCommit()
+			},
+			expectedResp: func(t *testing.T, id int, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 1, id)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			id, err := repo.CreateUser(context.Background(), tt.username, tt.password)
+			tt.expectedResp(t, id, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_CreateInvitedUser(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+
+	tests := []struct {
+		name         string
+		mockExpect   func()
+		expectedResp func(*testing.T, int, error)
+	}{
+		{
+			name: "invite redeemed",
+			mockExpect: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(insertToUsers)).
+					WithArgs("user1", "hash").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(5))
+				mock.ExpectExec(regexp.QuoteMeta(insertLedgerAccount)).
+					WithArgs("user:5", 5).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectExec(regexp.QuoteMeta(redeemInvite)).
+					WithArgs(5, "invite").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectCommit()
+			},
+			expectedResp: func(t *testing.T, id int, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 5, id)
+			},
+		},
+		{
+			name: "used invite rolls the signup back",
+			mockExpect: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(insertToUsers)).
+					WithArgs("user1", "hash").
+					WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(6))
+				mock.ExpectExec(regexp.QuoteMeta(insertLedgerAccount)).
+					WithArgs("user:6", 6).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectExec(regexp.QuoteMeta(redeemInvite)).
+					WithArgs(6, "invite").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, id int, err error) {
+				assert.Equal(t, ErrInvalidInvite, err)
+			},
+		},
+		{
+			name: "username taken",
+			mockExpect: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(insertToUsers)).
+					WithArgs("user1", "hash").
+					WillReturnError(&pgconn.PgError{Code: uniqueViolationCode})
+				mock.ExpectRollback()
+			},
+			expectedResp: func(t *testing.T, id int, err error) {
+				assert.Equal(t, ErrUserAlreadyExists, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			id, err := repo.CreateInvitedUser(context.Background(), "user1", "hash", "invite")
+			tt.expectedResp(t, id, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_VerifyLedger(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+
+	tests := []struct {
+		name         string
+		mockExpect   func()
+		expectedResp func(*testing.T, *dto.LedgerReport, error)
+	}{
+		{
+			name: "balanced ledger",
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+				mock.ExpectQuery(regexp.QuoteMeta(getUnbalancedLedgerTransfers)).
+					WillReturnRows(pgxmock.NewRows([]string{"transfer_id"}))
+				mock.ExpectQuery(regexp.QuoteMeta(getLedgerDiscrepancies)).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "username", "cached", "ledger"}))
+				mock.ExpectCommit()
+			},
+			expectedResp: func(t *testing.T, report *dto.LedgerReport, err error) {
+				assert.NoError(t, err)
+				assert.True(t, report.Balanced)
+				assert.Empty(t, report.UnbalancedTransfers)
+				assert.Empty(t, report.Discrepancies)
+			},
+		},
+		{
+			name: "cached balance drifted from the ledger",
+			mockExpect: func() {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+				mock.ExpectQuery(regexp.QuoteMeta(getUnbalancedLedgerTransfers)).
+					WillReturnRows(pgxmock.NewRows([]string{"transfer_id"}).AddRow(12))
+				mock.ExpectQuery(regexp.QuoteMeta(getLedgerDiscrepancies)).
+					WillReturnRows(pgxmock.NewRows([]string{"user_id", "username", "cached", "ledger"}).
+						AddRow(3, "user3", 900, 850))
+				mock.ExpectCommit()
+			},
+			expectedResp: func(t *testing.T, report *dto.LedgerReport, err error) {
+				assert.NoError(t, err)
+				assert.False(t, report.Balanced)
+				assert.Equal(t, []int{12}, report.UnbalancedTransfers)
+				assert.Equal(t, []dto.BalanceDiscrepancy{{UserId: 3, Username: "user3", Cached: 900, Ledger: 850}}, report.Discrepancies)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			report, err := repo.VerifyLedger(context.Background())
+			tt.expectedResp(t, report, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPostLedgerTransfer_Unbalanced(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	mock.ExpectBegin()
+	tx, err := mock.Begin(context.Background())
+	require.NoError(t, err)
+
+	err = postLedgerTransfer(context.Background(), tx, ledgerKindTransfer,
+		ledgerEntry{account: userAccount(1), amount: -50},
+		ledgerEntry{account: userAccount(2), amount: 40},
+	)
+	assert.Equal(t, ErrUnbalancedTransfer, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_Sessions(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+	ctx := context.Background()
+	expiresAt := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(getSession)).
+		WithArgs("sid").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "user_id", "username", "refresh_hash", "expires_at", "revoked_at"}).
+			AddRow("sid", 1, "user1", "hash", expiresAt, nil))
+
+	session, err := repo.GetSession(ctx, "sid")
+	assert.NoError(t, err)
+	assert.Equal(t, &auth.Session{Id: "sid", UserId: 1, Username: "user1", RefreshHash: "hash", ExpiresAt: expiresAt}, session)
+
+	mock.ExpectQuery(regexp.QuoteMeta(getSession)).
+		WithArgs("missing").
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err = repo.GetSession(ctx, "missing")
+	assert.Equal(t, auth.ErrSessionNotFound, err)
+
+	mock.ExpectExec(regexp.QuoteMeta(rotateSession)).
+		WithArgs("new-hash", expiresAt, "sid", "hash").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(regexp.QuoteMeta(rotateSession)).
+		WithArgs("other-hash", expiresAt, "sid", "hash").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	rotated, err := repo.RotateSession(ctx, "sid", "hash", "new-hash", expiresAt)
+	assert.NoError(t, err)
+	assert.True(t, rotated)
+
+	rotated, err = repo.RotateSession(ctx, "sid", "hash", "other-hash", expiresAt)
+	assert.NoError(t, err)
+	assert.False(t, rotated)
+
+	mock.ExpectExec(regexp.QuoteMeta(revokeUserSessions)).
+		WithArgs(1, "sid").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+
+	assert.NoError(t, repo.RevokeUserSessions(ctx, 1, "sid"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_LoginAttempts(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+	ctx := context.Background()
+	now := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(getLoginAttempts)).
+		WithArgs("user:unknown").
+		WillReturnError(pgx.ErrNoRows)
+
+	attempts, err := repo.GetLoginAttempts(ctx, "user:unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, &auth.LoginAttempts{Key: "user:unknown"}, attempts)
+
+	mock.ExpectQuery(regexp.QuoteMeta(upsertLoginFailure)).
+		WithArgs("user:user1", now, now.Add(-15*time.Minute)).
+		WillReturnRows(pgxmock.NewRows([]string{"key", "failures", "last_failure_at"}).
+			AddRow("user:user1", 3, now))
+
+	attempts, err = repo.RecordLoginFailure(ctx, "user:user1", now, 15*time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, &auth.LoginAttempts{Key: "user:user1", Failures: 3, LastFailureAt: now}, attempts)
+
+	mock.ExpectExec(regexp.QuoteMeta(releaseLoginAttempt)).
+		WithArgs("user:user1").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	assert.NoError(t, repo.ReleaseLoginAttempt(ctx, "user:user1"))
+
+	mock.ExpectExec(regexp.QuoteMeta(deleteLoginAttempts)).
+		WithArgs("user:user1").
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	assert.NoError(t, repo.ResetLoginAttempts(ctx, "user:user1"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_GetItems(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+
+	tests := []struct {
+		name         string
+		request      *dto.ItemsRequest
+		mockExpect   func()
+		expectedResp func(*testing.T, []dto.Item, error)
+	}{
+		{
+			name:    "success GetItems sorted by price",
+			request: &dto.ItemsRequest{SortBy: dto.SortByPrice, Order: dto.OrderDesc, MinPrice: 10, MaxPrice: 100},
+			mockExpect: func() {
+				rows := pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user", "available"}).
+					AddRow(3, "book", 50, nil, nil, true).
+					AddRow(2, "cup", 20, nil, nil, true)
+				mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(getItems, "price", "DESC"))).
+					WithArgs(10, 100).
+					WillReturnRows(rows)
+			},
+			expectedResp: func(t *testing.T, items []dto.Item, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []dto.Item{
+					{Id: 3, Name: "book", Price: 50, Available: true},
+					{Id: 2, Name: "cup", Price: 20, Available: true},
+				}, items)
+			},
+		},
+		{
+			name:    "empty catalog",
+			request: &dto.ItemsRequest{},
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(fmt.Sprintf(getItems, "id", "ASC"))).
+					WithArgs(0, 0).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user", "available"}))
+			},
+			expectedResp: func(t *testing.T, items []dto.Item, err error) {
+				assert.NoError(t, err)
+				assert.NotNil(t, items)
+				assert.Empty(t, items)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			items, err := repo.GetItems(context.Background(), tt.request)
+			tt.expectedResp(t, items, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_CreateItem(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+
+	tests := []struct {
+		name         string
+		item         string
+		price        int
+		mockExpect   func()
+		expectedResp func(*testing.T, *models.Item, error)
+	}{
+		{
+			name:  "success CreateItem",
+			item:  "sticker",
+			price: 5,
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(insertToItems)).
+					WithArgs("sticker", 5, (*int)(nil), (*int)(nil)).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).AddRow(11, "sticker", 5, nil, nil))
+			},
+			expectedResp: func(t *testing.T, item *models.Item, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, &models.Item{Id: 11, Name: "sticker", Price: 5}, item)
+			},
+		},
+		{
+			name:  "item already exists",
+			item:  "pen",
+			price: 10,
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(insertToItems)).
+					WithArgs("pen", 10, (*int)(nil), (*int)(nil)).
+					WillReturnError(&pgconn.PgError{Code: uniqueViolationCode})
+			},
+			expectedResp: func(t *testing.T, item *models.Item, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, ErrItemAlreadyExists, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			item, err := repo.CreateItem(context.Background(), &models.Item{Name: tt.item, Price: tt.price})
+			tt.expectedResp(t, item, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_UpdateItemPrice(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+
+	tests := []struct {
+		name         string
+		id           int
+		price        int
+		mockExpect   func()
+		expectedResp func(*testing.T, *models.Item, error)
+	}{
+		{
+			name:  "success UpdateItemPrice",
+			id:    4,
+			price: 15,
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(updateItemPrice)).
+					WithArgs(15, 4).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "name", "price", "stock", "max_per_user"}).AddRow(4, "pen", 15, nil, nil))
+			},
+			expectedResp: func(t *testing.T, item *models.Item, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, 15, item.Price)
+			},
+		},
+		{
+			name:  "item not found or retired",
+			id:    42,
+			price: 15,
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(updateItemPrice)).
+					WithArgs(15, 42).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			expectedResp: func(t *testing.T, item *models.Item, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, ErrItemNotFound, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			item, err := repo.UpdateItemPrice(context.Background(), tt.id, tt.price)
+			tt.expectedResp(t, item, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_RetireItem(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+
+	tests := []struct {
+		name         string
+		id           int
+		mockExpect   func()
+		expectedResp func(*testing.T, error)
+	}{
+		{
+			name: "success RetireItem",
+			id:   4,
+			mockExpect: func() {
+				mock.ExpectExec(regexp.QuoteMeta(retireItem)).
+					WithArgs(4).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "item already retired",
+			id:   4,
+			mockExpect: func() {
+				mock.ExpectExec(regexp.QuoteMeta(retireItem)).
+					WithArgs(4).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, ErrItemNotFound, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			err := repo.RetireItem(context.Background(), tt.id)
+			tt.expectedResp(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_RehashPassword(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+
+	mock.ExpectExec(regexp.QuoteMeta(rehashUserPassword)).
+		WithArgs("new-hash", 1, "old-hash").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	assert.NoError(t, repo.RehashPassword(context.Background(), 1, "old-hash", "new-hash"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRepository_PasswordReset(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+	ctx := context.Background()
+	expiresAt := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		mockExpect func()
+		call       func() error
+		wantErr    error
+	}{
+		{
+			name: "create reset",
+			mockExpect: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(expirePasswordResets)).
+					WithArgs("user1").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectExec(regexp.QuoteMeta(insertPasswordReset)).
+					WithArgs("hash", "user1", 7, expiresAt).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+				mock.ExpectCommit()
+			},
+			call: func() error {
+				return repo.CreatePasswordReset(ctx, "user1", "hash", 7, expiresAt)
+			},
+		},
+		{
+			name: "create reset for unknown user",
+			mockExpect: func() {
+				mock.ExpectBegin()
+				mock.ExpectExec(regexp.QuoteMeta(expirePasswordResets)).
+					WithArgs("ghost").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+				mock.ExpectExec(regexp.QuoteMeta(insertPasswordReset)).
+					WithArgs("hash", "ghost", 7, expiresAt).
+					WillReturnResult(pgxmock.NewResult("INSERT 0", 0))
+				mock.ExpectRollback()
+			},
+			call: func() error {
+				return repo.CreatePasswordReset(ctx, "ghost", "hash", 7, expiresAt)
+			},
+			wantErr: ErrUserNotFound,
+		},
+		{
+			name: "redeem reset",
+			mockExpect: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(redeemPasswordReset)).
+					WithArgs("hash").
+					WillReturnRows(pgxmock.NewRows([]string{"user_id"}).AddRow(1))
+				mock.ExpectExec(regexp.QuoteMeta(updateUserPassword)).
+					WithArgs("new-password", 1).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+				mock.ExpectCommit()
+			},
+			call: func() error {
+				userId, err := repo.ResetPassword(ctx, "hash", "new-password")
+				assert.Equal(t, 1, userId)
+				return err
+			},
+		},
+		{
+			name: "redeem used reset",
+			mockExpect: func() {
+				mock.ExpectBegin()
+				mock.ExpectQuery(regexp.QuoteMeta(redeemPasswordReset)).
+					WithArgs("hash").
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			call: func() error {
+				_, err := repo.ResetPassword(ctx, "hash", "new-password")
+				return err
+			},
+			wantErr: ErrInvalidResetToken,
+		},
+		{
+			name: "update password for unknown user",
+			mockExpect: func() {
+				mock.ExpectExec(regexp.QuoteMeta(updateUserPassword)).
+					WithArgs("new-password", 9).
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			call: func() error {
+				return repo.UpdatePassword(ctx, 9, "new-password")
+			},
+			wantErr: ErrUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			assert.Equal(t, tt.wantErr, tt.call())
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_SetUserRole(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+
+	tests := []struct {
+		name         string
+		username     string
+		mockExpect   func()
+		expectedResp func(*testing.T, error)
+	}{
+		{
+			name:     "success SetUserRole",
+			username: "testuser",
+			mockExpect: func() {
+				mock.ExpectExec(regexp.QuoteMeta(updateUserRole)).
+					WithArgs(models.RoleAdmin, "testuser").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:     "user not found",
+			username: "nonexistent",
+			mockExpect: func() {
+				mock.ExpectExec(regexp.QuoteMeta(updateUserRole)).
+					WithArgs(models.RoleAdmin, "nonexistent").
+					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+			},
+			expectedResp: func(t *testing.T, err error) {
+				assert.Error(t, err)
+				assert.Equal(t, ErrUserNotFound, err)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			err := repo.SetUserRole(context.Background(), tt.username, models.RoleAdmin)
+			tt.expectedResp(t, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRepository_GetHistory(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	repo := &Repository{pool: mock}
+	createdAt := time.Date(2025, 2, 14, 12, 0, 0, 0, time.UTC)
+	from := createdAt.Add(-24 * time.Hour)
+	afterType, afterId := dto.HistoryTypeSent, 8
+
+	tests := []struct {
+		name         string
+		filter       *dto.HistoryFilter
+		mockExpect   func()
+		expectedResp func(*testing.T, []dto.HistoryEntry, error)
+	}{
+		{
+			name:   "first page",
+			filter: &dto.HistoryFilter{UserId: 1, Type: dto.HistoryTypeSent, From: &from, Limit: 21},
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(getUserHistory)).
+					WithArgs(1, dto.HistoryTypeSent, "", &from, (*time.Time)(nil), (*time.Time)(nil), (*string)(nil), (*int)(nil), 21).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "type", "counterparty", "item", "quantity", "amount", "created_at"}).
+						AddRow(8, "sent", "user3", "", 0, 30, createdAt))
+			},
+			expectedResp: func(t *testing.T, entries []dto.HistoryEntry, err error) {
+				assert.NoError(t, err)
+				assert.Equal(t, []dto.HistoryEntry{
+					{Id: 8, Type: dto.HistoryTypeSent, Counterparty: "user3", Amount: 30, CreatedAt: createdAt},
+				}, entries)
+			},
+		},
+		{
+			name: "page after cursor",
+			filter: &dto.HistoryFilter{
+				UserId: 1,
+				After:  &dto.HistoryCursor{CreatedAt: createdAt, Type: dto.HistoryTypeSent, Id: 8},
+				Limit:  21,
+			},
+			mockExpect: func() {
+				mock.ExpectQuery(regexp.QuoteMeta(getUserHistory)).
+					WithArgs(1, "", "", (*time.Time)(nil), (*time.Time)(nil), &createdAt, &afterType, &afterId, 21).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "type", "counterparty", "item", "quantity", "amount", "created_at"}))
+			},
+			expectedResp: func(t *testing.T, entries []dto.HistoryEntry, err error) {
+				assert.NoError(t, err)
+				assert.Empty(t, entries)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mockExpect()
+			entries, err := repo.GetHistory(context.Background(), tt.filter)
+			tt.expectedResp(t, entries, err)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func expectLedgerTransfer(mock pgxmock.PgxPoolIface, kind string, entries ...ledgerEntry) {
+	mock.ExpectQuery(regexp.QuoteMeta(insertLedgerTransfer)).
+		WithArgs(kind).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1))
+
+	for _, entry := range entries {
+		mock.ExpectExec(regexp.QuoteMeta(insertLedgerEntry)).
+			WithArgs(1, entry.account.code, entry.amount).
+			WillReturnResult(pgxmock.NewResult("INSERT 0", 1))
+
+		if entry.account.userId != 0 {
+			mock.ExpectExec(regexp.QuoteMeta(updateUserBalance)).
+				WithArgs(entry.amount, entry.account.userId).
+				WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		}
+	}
+}
+
+func intPtr(value int) *int {
+	return &value
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+	"github.com/jackc/pgx/v5"
+)
+
+// The methods below let Repository act as the persistent auth.SessionStore.
+
+func (r *Repository) CreateSession(ctx context.Context, session *auth.Session) error {
+	_, err := r.pool.Exec(ctx, insertSession, session.Id, session.UserId, session.RefreshHash, session.ExpiresAt)
+	return err
+}
+
+func (r *Repository) GetSession(ctx context.Context, id string) (*auth.Session, error) {
+	session, err := queryStruct[auth.Session](ctx, r.pool, getSession, id)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return nil, auth.ErrSessionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// RotateSession swaps the refresh hash only if it still equals oldHash, so
+// of two concurrent refreshes with the same token exactly one succeeds.
+func (r *Repository) RotateSession(ctx context.Context, id, oldHash, newHash string, expiresAt time.Time) (bool, error) {
+	tag, err := r.pool.Exec(ctx, rotateSession, newHash, expiresAt, id, oldHash)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *Repository) RevokeSession(ctx context.Context, id string) error {
+	_, err := r.pool.Exec(ctx, revokeSession, id)
+	return err
+}
+
+func (r *Repository) RevokeUserSessions(ctx context.Context, userId int, exceptId string) error {
+	_, err := r.pool.Exec(ctx, revokeUserSessions, userId, exceptId)
+	return err
+}
@@ -1,31 +1,177 @@
 package repository
 
+import "github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+
 const (
-	getFromUsers = `SELECT id, username, password_salt FROM users WHERE username=$1;`
+	getFromUsers = `SELECT id, username, password_salt, role, status FROM users WHERE username=$1;`
+
+	insertToUsers = `INSERT INTO users (username, password_salt, coins) values ($1, $2, 0) RETURNING id;`
 
-	insertToUsers = `INSERT INTO users (username, password_salt, coins) values ($1, $2, $3) RETURNING id;`
+	getFromItems = `SELECT id, name, price, stock, max_per_user FROM items WHERE name = $1 AND retired_at IS NULL FOR UPDATE`
 
-	getFromItems = `SELECT id, name, price FROM items WHERE name = $1`
+	getUserItemQuantity = `SELECT COALESCE((SELECT quantity FROM inventory WHERE user_id = $1 AND item_id = $2), 0)`
+
+	updateItemStock = `UPDATE items SET stock = stock - $1 WHERE id = $2`
 
 	getCoinsFromUser = `SELECT coins from users WHERE id = $1 FOR UPDATE`
 
-	updateCoinsFromUser = `UPDATE users SET coins = coins - $1 WHERE id = $2`
+	getCoinsAndStatusFromUser = `SELECT coins, status from users WHERE id = $1 FOR UPDATE`
+
+	insertToInventory = `INSERT INTO inventory (user_id, item_id, quantity) VALUES ($1, $2, $3) ON CONFLICT (user_id, item_id) DO UPDATE SET quantity = inventory.quantity + EXCLUDED.quantity`
 
-	insertToInventory = `INSERT INTO inventory (user_id, item_id, quantity) VALUES ($1, $2, 1) ON CONFLICT (user_id, item_id) DO UPDATE SET quantity = inventory.quantity + 1`
+	beginSnapshot = `BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY`
+
+	commitSnapshot = `COMMIT`
 
 	getCoins = `SELECT coins from users where id = $1`
 
 	getUserInventory = `SELECT i.name, quantity from inventory INNER JOIN items i ON i.id = inventory.item_id WHERE user_id = $1`
 
-	getUserRecieved = `SELECT username as from_user, amount FROM transactions INNER JOIN users ON users.id = transactions.from_user_id WHERE to_user_id = $1`
+	getUserRecieved = `SELECT transactions.id, username as from_user, amount, created_at FROM transactions INNER JOIN users ON users.id = transactions.from_user_id WHERE to_user_id = $1 ORDER BY created_at DESC, transactions.id DESC LIMIT $2`
+
+	getUserSent = `SELECT transactions.id, username as to_user, amount, created_at FROM transactions INNER JOIN users ON users.id = transactions.to_user_id WHERE from_user_id = $1 ORDER BY created_at DESC, transactions.id DESC LIMIT $2`
+
+	getUserPurchases = `SELECT p.id, i.name AS item, p.quantity, p.amount, p.created_at FROM purchases p INNER JOIN items i ON i.id = p.item_id WHERE p.user_id = $1 ORDER BY p.created_at DESC, p.id DESC LIMIT $2`
 
-	getUserSent = `SELECT username as to_user, amount FROM transactions INNER JOIN users ON users.id = transactions.to_user_id WHERE from_user_id = $1`
+	getUserReceivedTotals = `SELECT username, SUM(amount) AS amount, COUNT(*) AS count FROM transactions INNER JOIN users ON users.id = transactions.from_user_id WHERE to_user_id = $1 GROUP BY username ORDER BY SUM(amount) DESC, username LIMIT $2`
+
+	getUserSentTotals = `SELECT username, SUM(amount) AS amount, COUNT(*) AS count FROM transactions INNER JOIN users ON users.id = transactions.to_user_id WHERE from_user_id = $1 GROUP BY username ORDER BY SUM(amount) DESC, username LIMIT $2`
+
+	getUserHistory = `SELECT id, type, counterparty, item, quantity, amount, created_at FROM (
+		SELECT t.id, 'sent' AS type, u.username AS counterparty, '' AS item, 0 AS quantity, t.amount, t.created_at
+		FROM transactions t INNER JOIN users u ON u.id = t.to_user_id WHERE t.from_user_id = $1
+		UNION ALL
+		SELECT t.id, 'received', u.username, '', 0, t.amount, t.created_at
+		FROM transactions t INNER JOIN users u ON u.id = t.from_user_id WHERE t.to_user_id = $1
+		UNION ALL
+		SELECT p.id, 'purchase', '', i.name, p.quantity, p.amount, p.created_at
+		FROM purchases p INNER JOIN items i ON i.id = p.item_id WHERE p.user_id = $1
+	) h
+	WHERE ($2 = '' OR h.type = $2)
+		AND ($3 = '' OR h.counterparty = $3)
+		AND ($4::timestamptz IS NULL OR h.created_at >= $4)
+		AND ($5::timestamptz IS NULL OR h.created_at < $5)
+		AND ($6::timestamptz IS NULL OR (h.created_at, h.type, h.id) < ($6::timestamptz, $7::text, $8::int))
+	ORDER BY h.created_at DESC, h.type DESC, h.id DESC
+	LIMIT $9`
+
+	insertToPurchases = `INSERT INTO purchases (user_id, item_id, quantity, amount) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	insertIdempotencyKey = `INSERT INTO idempotency_keys (user_id, key, operation, request_hash) VALUES ($1, $2, $3, $4) ON CONFLICT (user_id, key) DO NOTHING`
+
+	getIdempotencyKey = `SELECT operation, request_hash, response FROM idempotency_keys WHERE user_id = $1 AND key = $2`
+
+	updateIdempotencyKey = `UPDATE idempotency_keys SET response = $1 WHERE user_id = $2 AND key = $3`
 
 	getIdFromUsers = `SELECT id from users WHERE username = $1`
 
-	getCoinsToUser = `SELECT coins from users WHERE username = $1 FOR UPDATE`
+	getUserSentToday = `SELECT COALESCE(SUM(amount), 0) FROM transactions WHERE from_user_id = $1 AND created_at > NOW() - INTERVAL '1 day'`
+
+	insertToTransactions = `INSERT INTO transactions (from_user_id, to_user_id, amount) VALUES ($1, $2, $3) RETURNING id, created_at`
+
+	getItems = `SELECT id, name, price, stock, max_per_user, (stock IS NULL OR stock > 0) AS available FROM items WHERE retired_at IS NULL AND price >= $1 AND ($2 = 0 OR price <= $2) ORDER BY %s %s, id`
+
+	insertToItems = `INSERT INTO items (name, price, stock, max_per_user) VALUES ($1, $2, $3, $4) RETURNING id, name, price, stock, max_per_user`
+
+	updateItemPrice = `UPDATE items SET price = $1 WHERE id = $2 AND retired_at IS NULL RETURNING id, name, price, stock, max_per_user`
+
+	updateItemLimits = `UPDATE items SET stock = $1, max_per_user = $2 WHERE id = $3 AND retired_at IS NULL RETURNING id, name, price, stock, max_per_user`
+
+	retireItem = `UPDATE items SET retired_at = NOW() WHERE id = $1 AND retired_at IS NULL`
+
+	insertLedgerAccount = `INSERT INTO ledger_accounts (code, user_id) VALUES ($1, $2)`
+
+	insertLedgerTransfer = `INSERT INTO ledger_transfers (kind) VALUES ($1) RETURNING id`
+
+	insertLedgerEntry = `INSERT INTO ledger_entries (transfer_id, account, amount) VALUES ($1, $2, $3)`
+
+	updateUserBalance = `UPDATE users SET coins = coins + $1 WHERE id = $2`
+
+	getUnbalancedLedgerTransfers = `SELECT transfer_id FROM ledger_entries GROUP BY transfer_id HAVING SUM(amount) <> 0 ORDER BY transfer_id`
+
+	getLedgerDiscrepancies = `SELECT u.id AS user_id, u.username, u.coins AS cached, COALESCE(SUM(e.amount), 0) AS ledger
+	FROM users u
+	LEFT JOIN ledger_accounts a ON a.user_id = u.id
+	LEFT JOIN ledger_entries e ON e.account = a.code
+	GROUP BY u.id, u.username, u.coins
+	HAVING u.coins <> COALESCE(SUM(e.amount), 0)
+	ORDER BY u.id`
+
+	insertSession = `INSERT INTO sessions (id, user_id, refresh_hash, expires_at) VALUES ($1, $2, $3, $4)`
+
+	getSession = `SELECT s.id, s.user_id, u.username, s.refresh_hash, s.expires_at, s.revoked_at FROM sessions s INNER JOIN users u ON u.id = s.user_id WHERE s.id = $1`
 
-	updateCoinsToUser = `UPDATE users SET coins = coins + $1 WHERE username = $2`
+	rotateSession = `UPDATE sessions SET refresh_hash = $1, expires_at = $2 WHERE id = $3 AND refresh_hash = $4 AND revoked_at IS NULL`
 
-	insertToTransactions = `INSERT INTO transactions (from_user_id, to_user_id, amount) VALUES ($1, $2, $3)`
+	revokeSession = `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	insertInvite = `INSERT INTO invites (code, created_by, expires_at) VALUES ($1, $2, $3)`
+
+	redeemInvite = `UPDATE invites SET used_by = $1, used_at = NOW() WHERE code = $2 AND used_at IS NULL AND expires_at > NOW()`
+
+	updateUserRole = `UPDATE users SET role = $1 WHERE username = $2`
+
+	updateUserStatus = `UPDATE users SET status = $1 WHERE username = $2`
+
+	rehashUserPassword = `UPDATE users SET password_salt = $1 WHERE id = $2 AND password_salt = $3`
+
+	getUserById = `SELECT id, username, password_salt, role, status FROM users WHERE id = $1`
+
+	updateUserPassword = `UPDATE users SET password_salt = $1 WHERE id = $2`
+
+	expirePasswordResets = `UPDATE password_resets SET expires_at = NOW() WHERE user_id = (SELECT id FROM users WHERE username = $1) AND used_at IS NULL AND expires_at > NOW()`
+
+	insertPasswordReset = `INSERT INTO password_resets (token_hash, user_id, created_by, expires_at) SELECT $1, id, $3, $4 FROM users WHERE username = $2`
+
+	redeemPasswordReset = `UPDATE password_resets SET used_at = NOW() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() RETURNING user_id`
+
+	revokeUserSessions = `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+
+	getLoginAttempts = `SELECT key, failures, last_failure_at FROM login_attempts WHERE key = $1`
+
+	upsertLoginFailure = `INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, $2)
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+		last_failure_at = EXCLUDED.last_failure_at
+	RETURNING key, failures, last_failure_at`
+
+	releaseLoginAttempt = `WITH dropped AS (
+		DELETE FROM login_attempts WHERE key = $1 AND failures <= 1
+	)
+	UPDATE login_attempts SET failures = failures - 1 WHERE key = $1 AND failures > 1`
+
+	deleteLoginAttempts = `DELETE FROM login_attempts WHERE key = $1`
+
+	createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`
+
+	getAppliedMigrations = `SELECT version FROM schema_migrations ORDER BY version`
+
+	getSchemaVersion = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+
+	insertSchemaMigration = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+
+	deleteSchemaMigration = `DELETE FROM schema_migrations WHERE version = $1`
+
+	lockMigrations = `SELECT pg_advisory_lock($1)`
+
+	unlockMigrations = `SELECT pg_advisory_unlock($1)`
+
+	disableStatementTimeout = `SET statement_timeout = 0`
+
+	resetStatementTimeout = `RESET statement_timeout`
 )
+
+var itemsSortColumns = map[string]string{
+	dto.SortById:    "id",
+	dto.SortByPrice: "price",
+	dto.SortByName:  "name",
+}
+
+var itemsOrderDirections = map[string]string{
+	dto.OrderAsc:  "ASC",
+	dto.OrderDesc: "DESC",
+}
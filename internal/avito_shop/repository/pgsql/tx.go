@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	serializationFailureCode = "40001"
+	deadlockDetectedCode     = "40P01"
+)
+
+const (
+	DefaultTxMaxAttempts = 5
+	DefaultTxBaseDelay   = 10 * time.Millisecond
+	DefaultTxMaxDelay    = 500 * time.Millisecond
+)
+
+var defaultTxRetry = RetryPolicy{
+	MaxAttempts: DefaultTxMaxAttempts,
+	BaseDelay:   DefaultTxBaseDelay,
+	MaxDelay:    DefaultTxMaxDelay,
+}
+
+// RetryPolicy bounds how often a transaction that lost a serialization
+// conflict or a deadlock is run again. The startup ping is repeated under the
+// same policy while the database is unreachable. The wait before attempt n is
+// drawn uniformly from [0, min(MaxDelay, BaseDelay*2^n)), so clients that
+// collided once do not collide again in lockstep.
+type RetryPolicy struct {
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	BaseDelay   time.Duration `mapstructure:"base_delay"`
+	MaxDelay    time.Duration `mapstructure:"max_delay"`
+}
+
+// withDefaults fills the fields left zero from defaults.
+func (p RetryPolicy) withDefaults(defaults RetryPolicy) RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaults.BaseDelay
+	}
+
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaults.MaxDelay
+	}
+
+	return p
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+
+	return rand.N(min(ceiling, p.MaxDelay))
+}
+
+type TxOptions struct {
+	Isolation pgx.TxIsoLevel
+	ReadOnly  bool
+	Retry     RetryPolicy
+}
+
+// moneyTxOptions is used by every transaction that moves coins.
+func (r *Repository) moneyTxOptions() TxOptions {
+	return TxOptions{Isolation: pgx.Serializable, Retry: r.cfg.TxRetry}
+}
+
+// withTx runs fn in a transaction and commits it. When the transaction fails
+// with a serialization failure or a deadlock, in fn or at commit, it is
+// rolled back and fn runs again from scratch, so fn must not keep state from
+// an earlier attempt. Each attempt is bounded by the configured TxTimeout;
+// fn must use the context it is given, not the caller's.
+func (r *Repository) withTx(
+	ctx context.Context, op string, opts TxOptions, fn func(ctx context.Context, tx pgx.Tx) error,
+) error {
+	policy := opts.Retry.withDefaults(defaultTxRetry)
+
+	for attempt := 1; ; attempt++ {
+		err := r.runTx(ctx, op, opts, fn)
+		if err == nil || !isRetryable(err) || attempt == policy.MaxAttempts {
+			return err
+		}
+
+		delay := policy.backoff(attempt)
+		logrus.WithFields(logrus.Fields{"event": op, "attempt": attempt, "delay": delay}).Warn(err)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (r *Repository) runTx(
+	ctx context.Context, op string, opts TxOptions, fn func(ctx context.Context, tx pgx.Tx) error,
+) error {
+	ctx, cancel := r.txContext(ctx)
+	defer cancel()
+
+	tx, err := r.pool.BeginTx(ctx, opts.pgxOptions())
+	if err != nil {
+		return err
+	}
+
+	if err := fn(ctx, tx); err != nil {
+		if err := tx.Rollback(ctx); err != nil {
+			logrus.WithFields(logrus.Fields{"event": op}).Error(err)
+		}
+
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (o TxOptions) pgxOptions() pgx.TxOptions {
+	options := pgx.TxOptions{IsoLevel: o.Isolation}
+	if o.ReadOnly {
+		options.AccessMode = pgx.ReadOnly
+	}
+
+	return options
+}
+
+// txContext bounds a transaction attempt by the configured TxTimeout.
+func (r *Repository) txContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.cfg.TxTimeout > 0 {
+		return context.WithTimeout(ctx, r.cfg.TxTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == serializationFailureCode || pgErr.Code == deadlockDetectedCode)
+}
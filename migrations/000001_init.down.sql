@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS inventory;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS users;
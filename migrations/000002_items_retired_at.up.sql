@@ -0,0 +1,2 @@
+-- Retired items stay in the table for the purchases that reference them.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS retired_at TIMESTAMP;
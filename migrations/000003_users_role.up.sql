@@ -0,0 +1,3 @@
+-- Existing users become regular users; admins are promoted at startup from
+-- admin_username or through PUT /api/admin/users/{username}/role.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(32) NOT NULL DEFAULT 'user';
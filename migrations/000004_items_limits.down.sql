@@ -0,0 +1,2 @@
+ALTER TABLE items DROP COLUMN IF EXISTS max_per_user;
+ALTER TABLE items DROP COLUMN IF EXISTS stock;
@@ -0,0 +1,3 @@
+-- NULL means no limit, which keeps the items that already exist unlimited.
+ALTER TABLE items ADD COLUMN IF NOT EXISTS stock INT CHECK (stock >= 0);
+ALTER TABLE items ADD COLUMN IF NOT EXISTS max_per_user INT CHECK (max_per_user > 0);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS purchases;
+ALTER TABLE transactions DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,16 @@
+-- Transfers made before timestamps were recorded get the time of the
+-- migration, the closest known bound.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE TABLE IF NOT EXISTS purchases (
+    id SERIAL PRIMARY KEY NOT NULL,
+    user_id INT NOT NULL,
+    item_id INT NOT NULL,
+    quantity INT CHECK (quantity > 0) NOT NULL,
+    amount INT CHECK (amount >= 0) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (item_id) REFERENCES items(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_purchases_user ON purchases (user_id);
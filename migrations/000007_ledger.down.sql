@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_transfers;
+DROP TABLE IF EXISTS ledger_accounts;
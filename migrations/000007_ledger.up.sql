@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    code VARCHAR(64) PRIMARY KEY NOT NULL,
+    user_id INT UNIQUE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS ledger_transfers (
+    id SERIAL PRIMARY KEY NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id SERIAL PRIMARY KEY NOT NULL,
+    transfer_id INT NOT NULL,
+    account VARCHAR(64) NOT NULL,
+    amount INT CHECK (amount <> 0) NOT NULL,
+    FOREIGN KEY (transfer_id) REFERENCES ledger_transfers(id),
+    FOREIGN KEY (account) REFERENCES ledger_accounts(code)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_transfer ON ledger_entries (transfer_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account ON ledger_entries (account);
+
+INSERT INTO ledger_accounts (code)
+VALUES ('issuance'),
+       ('shop')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO ledger_accounts (code, user_id)
+SELECT 'user:' || id, id FROM users
+ON CONFLICT DO NOTHING;
+
+-- Balances that predate the ledger are carried over as one opening transfer
+-- from the issuance account.
+DO $$
+DECLARE
+    opening_id INT;
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM ledger_transfers) AND EXISTS (SELECT 1 FROM users WHERE coins > 0) THEN
+        INSERT INTO ledger_transfers (kind) VALUES ('opening') RETURNING id INTO opening_id;
+
+        INSERT INTO ledger_entries (transfer_id, account, amount)
+        SELECT opening_id, 'user:' || id, coins FROM users WHERE coins > 0
+        UNION ALL
+        SELECT opening_id, 'issuance', -SUM(coins) FROM users WHERE coins > 0;
+    END IF;
+END $$;
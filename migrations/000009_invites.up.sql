@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS invites (
+    code VARCHAR(64) PRIMARY KEY NOT NULL,
+    created_by INT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_by INT UNIQUE,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (created_by) REFERENCES users(id),
+    FOREIGN KEY (used_by) REFERENCES users(id)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key VARCHAR(320) PRIMARY KEY NOT NULL,
+    failures INT CHECK (failures > 0) NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,3 @@
+-- Backs the daily transfer limit, which sums what a user sent since a point
+-- in time.
+CREATE INDEX IF NOT EXISTS idx_transactions_from_created ON transactions (from_user_id, created_at);
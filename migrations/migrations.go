@@ -0,0 +1,16 @@
+// Package migrations embeds the versioned schema migrations, so the service
+// can bring its database up to date by itself. Every version has a pair of
+// files, <version>_<name>.up.sql and <version>_<name>.down.sql.
+//
+// 000001_init is exactly the schema that used to be applied from init.sql by
+// the Postgres container. Every later change is a migration of its own that
+// only adds what is missing: tables and indexes with IF NOT EXISTS, columns
+// with ADD COLUMN IF NOT EXISTS and a default for the rows already there. A
+// database set up from init.sql runs 000001 as a no-op and is brought up to
+// date by the rest.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
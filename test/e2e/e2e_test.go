@@ -2,8 +2,8 @@ package e2e
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -14,8 +14,10 @@ import (
 	"github.com/dgt4l/avito_shop/internal/avito_shop/controller"
 	"github.com/dgt4l/avito_shop/internal/avito_shop/dto"
 	handler "github.com/dgt4l/avito_shop/internal/avito_shop/handler"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/repository/contract"
+	"github.com/dgt4l/avito_shop/internal/avito_shop/repository/memory"
 	repository "github.com/dgt4l/avito_shop/internal/avito_shop/repository/pgsql"
-	"github.com/jmoiron/sqlx"
+	"github.com/jackc/pgx/v5"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -29,14 +31,25 @@ func setupTestServer() (*httptest.Server, func()) {
 
 	logrus.Info("Config loaded successfully")
 
-	db, err := repository.NewRepository(cfg.DBConfig)
-	if err != nil {
-		logrus.Fatalf("Failed to init db: %v", err)
+	var db contract.Repository
+	if cfg.DBConfig.DBDriver == memory.Driver {
+		repo := memory.NewRepository(cfg.DBConfig)
+		repo.SeedCatalog()
+		db = repo
+	} else {
+		repo, err := repository.NewRepository(cfg.DBConfig)
+		if err != nil {
+			logrus.Fatalf("Failed to init db: %v", err)
+		}
+		db = repo
 	}
 
 	logrus.Info("Database initialized successfully")
 
-	authService := auth.NewAuth(cfg.AuthConfig)
+	authService, err := auth.NewAuth(cfg.AuthConfig, db, db)
+	if err != nil {
+		logrus.Fatalf("Failed to init auth: %v", err)
+	}
 
 	logrus.Info("Auth service initialized successfully")
 
@@ -44,7 +57,7 @@ func setupTestServer() (*httptest.Server, func()) {
 
 	logrus.Info("Shop service initialized successfully")
 
-	shopHandler := handler.NewShopHandler(shopService, authService, cfg.AppPort)
+	shopHandler := handler.NewShopHandler(shopService, authService, cfg.AppPort, cfg.HandlerConfig)
 
 	logrus.Info("Shop handler initialized successfully")
 
@@ -56,30 +69,28 @@ func setupTestServer() (*httptest.Server, func()) {
 
 	logrus.Info("Test server started successfully")
 
-	cleanupFunc := func() {
-		conn, err := sqlx.Open(
-			"postgres", fmt.Sprintf(
-				"%s://%s:%s@%s:%s/%s?sslmode=%s",
-				cfg.DBConfig.DBDriver,
-				cfg.DBConfig.DBUser,
-				cfg.DBConfig.DBPass,
-				cfg.DBConfig.DBHost,
-				cfg.DBConfig.DBPort,
-				cfg.DBConfig.DBName,
-				cfg.DBConfig.DBSSL,
-			),
-		)
+	if cfg.DBConfig.DBDriver == memory.Driver {
+		return server, func() {}
+	}
 
+	cleanupFunc := func() {
+		ctx := context.Background()
+		conn, err := pgx.Connect(ctx, cfg.DBConfig.ConnString())
 		if err != nil {
 			logrus.Fatalf("Failed to connect to database: %v", err)
 		}
-		defer conn.Close()
+		defer conn.Close(ctx)
 
-		_, err = conn.Exec("TRUNCATE TABLE users, items, inventory, transactions RESTART IDENTITY CASCADE;")
+		_, err = conn.Exec(ctx, "TRUNCATE TABLE users, items, inventory, transactions, purchases, idempotency_keys, ledger_entries, ledger_transfers, login_attempts RESTART IDENTITY CASCADE;")
 		if err != nil {
 			logrus.Fatalf("Failed to truncate tables: %v", err)
 		}
 
+		_, err = conn.Exec(ctx, "INSERT INTO ledger_accounts (code) VALUES ('issuance'), ('shop') ON CONFLICT DO NOTHING;")
+		if err != nil {
+			logrus.Fatalf("Failed to seed ledger accounts: %v", err)
+		}
+
 		logrus.Info("Database cleanup completed")
 	}
 
@@ -131,10 +142,10 @@ func TestAuth(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 
-		var errResp dto.BadRequestResponse
+		var errResp dto.ErrorResponse
 		err = json.NewDecoder(resp.Body).Decode(&errResp)
 		require.NoError(t, err)
-		assert.Equal(t, "invalid password", errResp.Errors)
+		assert.Equal(t, "invalid username or password", errResp.Errors)
 	})
 }
 
@@ -187,7 +198,7 @@ func TestSendCoin(t *testing.T) {
 
 		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 
-		var errResp dto.BadRequestResponse
+		var errResp dto.ErrorResponse
 		err = json.NewDecoder(resp.Body).Decode(&errResp)
 		require.NoError(t, err)
 		assert.Equal(t, "not enough coins", errResp.Errors)
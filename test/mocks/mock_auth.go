@@ -10,8 +10,11 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 
+	auth "github.com/dgt4l/avito_shop/internal/avito_shop/auth"
+	dto "github.com/dgt4l/avito_shop/internal/avito_shop/dto"
 	models "github.com/dgt4l/avito_shop/internal/avito_shop/models"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -40,26 +43,111 @@ func (m *MockAuthService) EXPECT() *MockAuthServiceMockRecorder {
 	return m.recorder
 }
 
-// GenerateToken mocks base method.
-func (m *MockAuthService) GenerateToken(user *models.User) (string, error) {
+// CheckLogin mocks base method.
+func (m *MockAuthService) CheckLogin(ctx context.Context, username, ip string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GenerateToken", user)
-	ret0, _ := ret[0].(string)
+	ret := m.ctrl.Call(m, "CheckLogin", ctx, username, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckLogin indicates an expected call of CheckLogin.
+func (mr *MockAuthServiceMockRecorder) CheckLogin(ctx, username, ip any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckLogin", reflect.TypeOf((*MockAuthService)(nil).CheckLogin), ctx, username, ip)
+}
+
+// CheckSession mocks base method.
+func (m *MockAuthService) CheckSession(ctx context.Context, sessionId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckSession", ctx, sessionId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckSession indicates an expected call of CheckSession.
+func (mr *MockAuthServiceMockRecorder) CheckSession(ctx, sessionId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckSession", reflect.TypeOf((*MockAuthService)(nil).CheckSession), ctx, sessionId)
+}
+
+// CreateSession mocks base method.
+func (m *MockAuthService) CreateSession(ctx context.Context, user *models.User) (*auth.Tokens, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", ctx, user)
+	ret0, _ := ret[0].(*auth.Tokens)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockAuthServiceMockRecorder) CreateSession(ctx, user any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockAuthService)(nil).CreateSession), ctx, user)
+}
+
+// JWKS mocks base method.
+func (m *MockAuthService) JWKS() *dto.JWKS {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "JWKS")
+	ret0, _ := ret[0].(*dto.JWKS)
+	return ret0
+}
+
+// JWKS indicates an expected call of JWKS.
+func (mr *MockAuthServiceMockRecorder) JWKS() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JWKS", reflect.TypeOf((*MockAuthService)(nil).JWKS))
+}
+
+// LoginFailed mocks base method.
+func (m *MockAuthService) LoginFailed(ctx context.Context, username, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginFailed", ctx, username, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LoginFailed indicates an expected call of LoginFailed.
+func (mr *MockAuthServiceMockRecorder) LoginFailed(ctx, username, ip any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginFailed", reflect.TypeOf((*MockAuthService)(nil).LoginFailed), ctx, username, ip)
+}
+
+// LoginSucceeded mocks base method.
+func (m *MockAuthService) LoginSucceeded(ctx context.Context, username, ip string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginSucceeded", ctx, username, ip)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LoginSucceeded indicates an expected call of LoginSucceeded.
+func (mr *MockAuthServiceMockRecorder) LoginSucceeded(ctx, username, ip any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginSucceeded", reflect.TypeOf((*MockAuthService)(nil).LoginSucceeded), ctx, username, ip)
+}
+
+// ParseRefreshToken mocks base method.
+func (m *MockAuthService) ParseRefreshToken(ctx context.Context, refreshToken string) (*auth.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ParseRefreshToken", ctx, refreshToken)
+	ret0, _ := ret[0].(*auth.Session)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GenerateToken indicates an expected call of GenerateToken.
-func (mr *MockAuthServiceMockRecorder) GenerateToken(user any) *gomock.Call {
+// ParseRefreshToken indicates an expected call of ParseRefreshToken.
+func (mr *MockAuthServiceMockRecorder) ParseRefreshToken(ctx, refreshToken any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GenerateToken", reflect.TypeOf((*MockAuthService)(nil).GenerateToken), user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ParseRefreshToken", reflect.TypeOf((*MockAuthService)(nil).ParseRefreshToken), ctx, refreshToken)
 }
 
 // ParseToken mocks base method.
-func (m *MockAuthService) ParseToken(tokenString string) (int, error) {
+func (m *MockAuthService) ParseToken(tokenString string) (*auth.UserClaims, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "ParseToken", tokenString)
-	ret0, _ := ret[0].(int)
+	ret0, _ := ret[0].(*auth.UserClaims)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -69,3 +157,46 @@ func (mr *MockAuthServiceMockRecorder) ParseToken(tokenString any) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ParseToken", reflect.TypeOf((*MockAuthService)(nil).ParseToken), tokenString)
 }
+
+// RevokeSession mocks base method.
+func (m *MockAuthService) RevokeSession(ctx context.Context, sessionId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", ctx, sessionId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockAuthServiceMockRecorder) RevokeSession(ctx, sessionId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockAuthService)(nil).RevokeSession), ctx, sessionId)
+}
+
+// RevokeUserSessions mocks base method.
+func (m *MockAuthService) RevokeUserSessions(ctx context.Context, userId int, exceptSessionId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserSessions", ctx, userId, exceptSessionId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserSessions indicates an expected call of RevokeUserSessions.
+func (mr *MockAuthServiceMockRecorder) RevokeUserSessions(ctx, userId, exceptSessionId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserSessions", reflect.TypeOf((*MockAuthService)(nil).RevokeUserSessions), ctx, userId, exceptSessionId)
+}
+
+// RotateSession mocks base method.
+func (m *MockAuthService) RotateSession(ctx context.Context, session *auth.Session, user *models.User) (*auth.Tokens, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RotateSession", ctx, session, user)
+	ret0, _ := ret[0].(*auth.Tokens)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RotateSession indicates an expected call of RotateSession.
+func (mr *MockAuthServiceMockRecorder) RotateSession(ctx, session, user any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RotateSession", reflect.TypeOf((*MockAuthService)(nil).RotateSession), ctx, session, user)
+}
@@ -14,6 +14,7 @@ import (
 	reflect "reflect"
 
 	dto "github.com/dgt4l/avito_shop/internal/avito_shop/dto"
+	models "github.com/dgt4l/avito_shop/internal/avito_shop/models"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -57,11 +58,12 @@ func (mr *MockShopServiceMockRecorder) AuthUser(ctx, request any) *gomock.Call {
 }
 
 // BuyItem mocks base method.
-func (m *MockShopService) BuyItem(ctx context.Context, request *dto.BuyItemRequest) error {
+func (m *MockShopService) BuyItem(ctx context.Context, request *dto.BuyItemRequest) (*dto.OrderResponse, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "BuyItem", ctx, request)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(*dto.OrderResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // BuyItem indicates an expected call of BuyItem.
@@ -70,31 +72,281 @@ func (mr *MockShopServiceMockRecorder) BuyItem(ctx, request any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuyItem", reflect.TypeOf((*MockShopService)(nil).BuyItem), ctx, request)
 }
 
+// ChangePassword mocks base method.
+func (m *MockShopService) ChangePassword(ctx context.Context, request *dto.ChangePasswordRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ChangePassword", ctx, request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockShopServiceMockRecorder) ChangePassword(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockShopService)(nil).ChangePassword), ctx, request)
+}
+
+// CreateInvite mocks base method.
+func (m *MockShopService) CreateInvite(ctx context.Context, createdBy int) (*dto.InviteResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInvite", ctx, createdBy)
+	ret0, _ := ret[0].(*dto.InviteResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateInvite indicates an expected call of CreateInvite.
+func (mr *MockShopServiceMockRecorder) CreateInvite(ctx, createdBy any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInvite", reflect.TypeOf((*MockShopService)(nil).CreateInvite), ctx, createdBy)
+}
+
+// CreateItem mocks base method.
+func (m *MockShopService) CreateItem(ctx context.Context, request *dto.CreateItemRequest) (*models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateItem", ctx, request)
+	ret0, _ := ret[0].(*models.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateItem indicates an expected call of CreateItem.
+func (mr *MockShopServiceMockRecorder) CreateItem(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateItem", reflect.TypeOf((*MockShopService)(nil).CreateItem), ctx, request)
+}
+
+// CreateOrder mocks base method.
+func (m *MockShopService) CreateOrder(ctx context.Context, request *dto.OrderRequest) (*dto.OrderResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrder", ctx, request)
+	ret0, _ := ret[0].(*dto.OrderResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrder indicates an expected call of CreateOrder.
+func (mr *MockShopServiceMockRecorder) CreateOrder(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrder", reflect.TypeOf((*MockShopService)(nil).CreateOrder), ctx, request)
+}
+
+// CreatePasswordReset mocks base method.
+func (m *MockShopService) CreatePasswordReset(ctx context.Context, request *dto.PasswordResetRequest) (*dto.PasswordResetResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordReset", ctx, request)
+	ret0, _ := ret[0].(*dto.PasswordResetResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreatePasswordReset indicates an expected call of CreatePasswordReset.
+func (mr *MockShopServiceMockRecorder) CreatePasswordReset(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordReset", reflect.TypeOf((*MockShopService)(nil).CreatePasswordReset), ctx, request)
+}
+
+// GetHistory mocks base method.
+func (m *MockShopService) GetHistory(ctx context.Context, request *dto.HistoryRequest) (*dto.HistoryResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistory", ctx, request)
+	ret0, _ := ret[0].(*dto.HistoryResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory.
+func (mr *MockShopServiceMockRecorder) GetHistory(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistory", reflect.TypeOf((*MockShopService)(nil).GetHistory), ctx, request)
+}
+
 // GetInfo mocks base method.
-func (m *MockShopService) GetInfo(ctx context.Context, userId int) (*dto.InfoResponse, error) {
+func (m *MockShopService) GetInfo(ctx context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetInfo", ctx, userId)
+	ret := m.ctrl.Call(m, "GetInfo", ctx, request)
 	ret0, _ := ret[0].(*dto.InfoResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetInfo indicates an expected call of GetInfo.
-func (mr *MockShopServiceMockRecorder) GetInfo(ctx, userId any) *gomock.Call {
+func (mr *MockShopServiceMockRecorder) GetInfo(ctx, request any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockShopService)(nil).GetInfo), ctx, userId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockShopService)(nil).GetInfo), ctx, request)
 }
 
-// SendCoin mocks base method.
-func (m *MockShopService) SendCoin(ctx context.Context, fromUserId int, request *dto.SendCoinRequest) error {
+// GetItems mocks base method.
+func (m *MockShopService) GetItems(ctx context.Context, request *dto.ItemsRequest) (*dto.ItemsResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendCoin", ctx, fromUserId, request)
+	ret := m.ctrl.Call(m, "GetItems", ctx, request)
+	ret0, _ := ret[0].(*dto.ItemsResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItems indicates an expected call of GetItems.
+func (mr *MockShopServiceMockRecorder) GetItems(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItems", reflect.TypeOf((*MockShopService)(nil).GetItems), ctx, request)
+}
+
+// Logout mocks base method.
+func (m *MockShopService) Logout(ctx context.Context, sessionId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Logout", ctx, sessionId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Logout indicates an expected call of Logout.
+func (mr *MockShopServiceMockRecorder) Logout(ctx, sessionId any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockShopService)(nil).Logout), ctx, sessionId)
+}
+
+// RefreshToken mocks base method.
+func (m *MockShopService) RefreshToken(ctx context.Context, request *dto.RefreshRequest) (*dto.AuthResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefreshToken", ctx, request)
+	ret0, _ := ret[0].(*dto.AuthResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RefreshToken indicates an expected call of RefreshToken.
+func (mr *MockShopServiceMockRecorder) RefreshToken(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshToken", reflect.TypeOf((*MockShopService)(nil).RefreshToken), ctx, request)
+}
+
+// Register mocks base method.
+func (m *MockShopService) Register(ctx context.Context, request *dto.RegisterRequest) (*dto.AuthResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Register", ctx, request)
+	ret0, _ := ret[0].(*dto.AuthResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Register indicates an expected call of Register.
+func (mr *MockShopServiceMockRecorder) Register(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockShopService)(nil).Register), ctx, request)
+}
+
+// ResetPassword mocks base method.
+func (m *MockShopService) ResetPassword(ctx context.Context, request *dto.ResetPasswordRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", ctx, request)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockShopServiceMockRecorder) ResetPassword(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockShopService)(nil).ResetPassword), ctx, request)
+}
+
+// RetireItem mocks base method.
+func (m *MockShopService) RetireItem(ctx context.Context, request *dto.RetireItemRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetireItem", ctx, request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetireItem indicates an expected call of RetireItem.
+func (mr *MockShopServiceMockRecorder) RetireItem(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetireItem", reflect.TypeOf((*MockShopService)(nil).RetireItem), ctx, request)
+}
+
+// SendCoin mocks base method.
+func (m *MockShopService) SendCoin(ctx context.Context, fromUserId int, request *dto.SendCoinRequest) (*dto.SendCoinResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendCoin", ctx, fromUserId, request)
+	ret0, _ := ret[0].(*dto.SendCoinResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // SendCoin indicates an expected call of SendCoin.
 func (mr *MockShopServiceMockRecorder) SendCoin(ctx, fromUserId, request any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCoin", reflect.TypeOf((*MockShopService)(nil).SendCoin), ctx, fromUserId, request)
 }
+
+// SetItemLimits mocks base method.
+func (m *MockShopService) SetItemLimits(ctx context.Context, request *dto.SetItemLimitsRequest) (*models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetItemLimits", ctx, request)
+	ret0, _ := ret[0].(*models.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetItemLimits indicates an expected call of SetItemLimits.
+func (mr *MockShopServiceMockRecorder) SetItemLimits(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetItemLimits", reflect.TypeOf((*MockShopService)(nil).SetItemLimits), ctx, request)
+}
+
+// SetUserRole mocks base method.
+func (m *MockShopService) SetUserRole(ctx context.Context, request *dto.SetRoleRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", ctx, request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole.
+func (mr *MockShopServiceMockRecorder) SetUserRole(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockShopService)(nil).SetUserRole), ctx, request)
+}
+
+// SetUserStatus mocks base method.
+func (m *MockShopService) SetUserStatus(ctx context.Context, request *dto.SetStatusRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserStatus", ctx, request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserStatus indicates an expected call of SetUserStatus.
+func (mr *MockShopServiceMockRecorder) SetUserStatus(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserStatus", reflect.TypeOf((*MockShopService)(nil).SetUserStatus), ctx, request)
+}
+
+// UpdateItem mocks base method.
+func (m *MockShopService) UpdateItem(ctx context.Context, request *dto.UpdateItemRequest) (*models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateItem", ctx, request)
+	ret0, _ := ret[0].(*models.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateItem indicates an expected call of UpdateItem.
+func (mr *MockShopServiceMockRecorder) UpdateItem(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateItem", reflect.TypeOf((*MockShopService)(nil).UpdateItem), ctx, request)
+}
+
+// VerifyLedger mocks base method.
+func (m *MockShopService) VerifyLedger(ctx context.Context) (*dto.LedgerReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyLedger", ctx)
+	ret0, _ := ret[0].(*dto.LedgerReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyLedger indicates an expected call of VerifyLedger.
+func (mr *MockShopServiceMockRecorder) VerifyLedger(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyLedger", reflect.TypeOf((*MockShopService)(nil).VerifyLedger), ctx)
+}
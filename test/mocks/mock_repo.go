@@ -12,6 +12,7 @@ package mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	dto "github.com/dgt4l/avito_shop/internal/avito_shop/dto"
 	models "github.com/dgt4l/avito_shop/internal/avito_shop/models"
@@ -43,17 +44,91 @@ func (m *MockRepository) EXPECT() *MockRepositoryMockRecorder {
 }
 
 // BuyItem mocks base method.
-func (m *MockRepository) BuyItem(ctx context.Context, id int, item string) error {
+func (m *MockRepository) BuyItem(ctx context.Context, id int, item string, quantity int, key *dto.IdempotencyKey) (*dto.OrderResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BuyItem", ctx, id, item)
+	ret := m.ctrl.Call(m, "BuyItem", ctx, id, item, quantity, key)
+	ret0, _ := ret[0].(*dto.OrderResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// BuyItem indicates an expected call of BuyItem.
+func (mr *MockRepositoryMockRecorder) BuyItem(ctx, id, item, quantity, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuyItem", reflect.TypeOf((*MockRepository)(nil).BuyItem), ctx, id, item, quantity, key)
+}
+
+// CreateInvite mocks base method.
+func (m *MockRepository) CreateInvite(ctx context.Context, code string, createdBy int, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInvite", ctx, code, createdBy, expiresAt)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// BuyItem indicates an expected call of BuyItem.
-func (mr *MockRepositoryMockRecorder) BuyItem(ctx, id, item any) *gomock.Call {
+// CreateInvite indicates an expected call of CreateInvite.
+func (mr *MockRepositoryMockRecorder) CreateInvite(ctx, code, createdBy, expiresAt any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInvite", reflect.TypeOf((*MockRepository)(nil).CreateInvite), ctx, code, createdBy, expiresAt)
+}
+
+// CreateInvitedUser mocks base method.
+func (m *MockRepository) CreateInvitedUser(ctx context.Context, username, password, invite string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateInvitedUser", ctx, username, password, invite)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateInvitedUser indicates an expected call of CreateInvitedUser.
+func (mr *MockRepositoryMockRecorder) CreateInvitedUser(ctx, username, password, invite any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateInvitedUser", reflect.TypeOf((*MockRepository)(nil).CreateInvitedUser), ctx, username, password, invite)
+}
+
+// CreateItem mocks base method.
+func (m *MockRepository) CreateItem(ctx context.Context, item *models.Item) (*models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateItem", ctx, item)
+	ret0, _ := ret[0].(*models.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateItem indicates an expected call of CreateItem.
+func (mr *MockRepositoryMockRecorder) CreateItem(ctx, item any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateItem", reflect.TypeOf((*MockRepository)(nil).CreateItem), ctx, item)
+}
+
+// CreateOrder mocks base method.
+func (m *MockRepository) CreateOrder(ctx context.Context, userId int, items []dto.OrderItem, key *dto.IdempotencyKey) (*dto.OrderResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateOrder", ctx, userId, items, key)
+	ret0, _ := ret[0].(*dto.OrderResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateOrder indicates an expected call of CreateOrder.
+func (mr *MockRepositoryMockRecorder) CreateOrder(ctx, userId, items, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateOrder", reflect.TypeOf((*MockRepository)(nil).CreateOrder), ctx, userId, items, key)
+}
+
+// CreatePasswordReset mocks base method.
+func (m *MockRepository) CreatePasswordReset(ctx context.Context, username, tokenHash string, createdBy int, expiresAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePasswordReset", ctx, username, tokenHash, createdBy, expiresAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePasswordReset indicates an expected call of CreatePasswordReset.
+func (mr *MockRepositoryMockRecorder) CreatePasswordReset(ctx, username, tokenHash, createdBy, expiresAt any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BuyItem", reflect.TypeOf((*MockRepository)(nil).BuyItem), ctx, id, item)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePasswordReset", reflect.TypeOf((*MockRepository)(nil).CreatePasswordReset), ctx, username, tokenHash, createdBy, expiresAt)
 }
 
 // CreateUser mocks base method.
@@ -71,19 +146,64 @@ func (mr *MockRepositoryMockRecorder) CreateUser(ctx, username, password any) *g
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockRepository)(nil).CreateUser), ctx, username, password)
 }
 
+// GetHistory mocks base method.
+func (m *MockRepository) GetHistory(ctx context.Context, filter *dto.HistoryFilter) ([]dto.HistoryEntry, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetHistory", ctx, filter)
+	ret0, _ := ret[0].([]dto.HistoryEntry)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetHistory indicates an expected call of GetHistory.
+func (mr *MockRepositoryMockRecorder) GetHistory(ctx, filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetHistory", reflect.TypeOf((*MockRepository)(nil).GetHistory), ctx, filter)
+}
+
+// GetIdempotentResponse mocks base method.
+func (m *MockRepository) GetIdempotentResponse(ctx context.Context, userId int, key *dto.IdempotencyKey, response any) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetIdempotentResponse", ctx, userId, key, response)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetIdempotentResponse indicates an expected call of GetIdempotentResponse.
+func (mr *MockRepositoryMockRecorder) GetIdempotentResponse(ctx, userId, key, response any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIdempotentResponse", reflect.TypeOf((*MockRepository)(nil).GetIdempotentResponse), ctx, userId, key, response)
+}
+
 // GetInfo mocks base method.
-func (m *MockRepository) GetInfo(ctx context.Context, userId int) (*dto.InfoResponse, error) {
+func (m *MockRepository) GetInfo(ctx context.Context, request *dto.InfoRequest) (*dto.InfoResponse, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetInfo", ctx, userId)
+	ret := m.ctrl.Call(m, "GetInfo", ctx, request)
 	ret0, _ := ret[0].(*dto.InfoResponse)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetInfo indicates an expected call of GetInfo.
-func (mr *MockRepositoryMockRecorder) GetInfo(ctx, userId any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) GetInfo(ctx, request any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockRepository)(nil).GetInfo), ctx, request)
+}
+
+// GetItems mocks base method.
+func (m *MockRepository) GetItems(ctx context.Context, request *dto.ItemsRequest) ([]dto.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetItems", ctx, request)
+	ret0, _ := ret[0].([]dto.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetItems indicates an expected call of GetItems.
+func (mr *MockRepositoryMockRecorder) GetItems(ctx, request any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInfo", reflect.TypeOf((*MockRepository)(nil).GetInfo), ctx, userId)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetItems", reflect.TypeOf((*MockRepository)(nil).GetItems), ctx, request)
 }
 
 // GetUser mocks base method.
@@ -101,16 +221,162 @@ func (mr *MockRepositoryMockRecorder) GetUser(ctx, username any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockRepository)(nil).GetUser), ctx, username)
 }
 
-// SendCoin mocks base method.
-func (m *MockRepository) SendCoin(ctx context.Context, toUser string, fromUserId, amount int) error {
+// GetUserById mocks base method.
+func (m *MockRepository) GetUserById(ctx context.Context, id int) (*models.User, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SendCoin", ctx, toUser, fromUserId, amount)
+	ret := m.ctrl.Call(m, "GetUserById", ctx, id)
+	ret0, _ := ret[0].(*models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserById indicates an expected call of GetUserById.
+func (mr *MockRepositoryMockRecorder) GetUserById(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserById", reflect.TypeOf((*MockRepository)(nil).GetUserById), ctx, id)
+}
+
+// RehashPassword mocks base method.
+func (m *MockRepository) RehashPassword(ctx context.Context, userId int, oldHash, newHash string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RehashPassword", ctx, userId, oldHash, newHash)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// RehashPassword indicates an expected call of RehashPassword.
+func (mr *MockRepositoryMockRecorder) RehashPassword(ctx, userId, oldHash, newHash any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RehashPassword", reflect.TypeOf((*MockRepository)(nil).RehashPassword), ctx, userId, oldHash, newHash)
+}
+
+// ResetPassword mocks base method.
+func (m *MockRepository) ResetPassword(ctx context.Context, tokenHash, password string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResetPassword", ctx, tokenHash, password)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResetPassword indicates an expected call of ResetPassword.
+func (mr *MockRepositoryMockRecorder) ResetPassword(ctx, tokenHash, password any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResetPassword", reflect.TypeOf((*MockRepository)(nil).ResetPassword), ctx, tokenHash, password)
+}
+
+// RetireItem mocks base method.
+func (m *MockRepository) RetireItem(ctx context.Context, id int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RetireItem", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RetireItem indicates an expected call of RetireItem.
+func (mr *MockRepositoryMockRecorder) RetireItem(ctx, id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RetireItem", reflect.TypeOf((*MockRepository)(nil).RetireItem), ctx, id)
+}
+
+// SendCoin mocks base method.
+func (m *MockRepository) SendCoin(ctx context.Context, toUser string, fromUserId, amount, dailyLimit int, key *dto.IdempotencyKey) (*dto.SendCoinResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendCoin", ctx, toUser, fromUserId, amount, dailyLimit, key)
+	ret0, _ := ret[0].(*dto.SendCoinResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // SendCoin indicates an expected call of SendCoin.
-func (mr *MockRepositoryMockRecorder) SendCoin(ctx, toUser, fromUserId, amount any) *gomock.Call {
+func (mr *MockRepositoryMockRecorder) SendCoin(ctx, toUser, fromUserId, amount, dailyLimit, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCoin", reflect.TypeOf((*MockRepository)(nil).SendCoin), ctx, toUser, fromUserId, amount, dailyLimit, key)
+}
+
+// SetItemLimits mocks base method.
+func (m *MockRepository) SetItemLimits(ctx context.Context, id int, stock, maxPerUser *int) (*models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetItemLimits", ctx, id, stock, maxPerUser)
+	ret0, _ := ret[0].(*models.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetItemLimits indicates an expected call of SetItemLimits.
+func (mr *MockRepositoryMockRecorder) SetItemLimits(ctx, id, stock, maxPerUser any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetItemLimits", reflect.TypeOf((*MockRepository)(nil).SetItemLimits), ctx, id, stock, maxPerUser)
+}
+
+// SetUserRole mocks base method.
+func (m *MockRepository) SetUserRole(ctx context.Context, username, role string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserRole", ctx, username, role)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserRole indicates an expected call of SetUserRole.
+func (mr *MockRepositoryMockRecorder) SetUserRole(ctx, username, role any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserRole", reflect.TypeOf((*MockRepository)(nil).SetUserRole), ctx, username, role)
+}
+
+// SetUserStatus mocks base method.
+func (m *MockRepository) SetUserStatus(ctx context.Context, username, status string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetUserStatus", ctx, username, status)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetUserStatus indicates an expected call of SetUserStatus.
+func (mr *MockRepositoryMockRecorder) SetUserStatus(ctx, username, status any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUserStatus", reflect.TypeOf((*MockRepository)(nil).SetUserStatus), ctx, username, status)
+}
+
+// UpdateItemPrice mocks base method.
+func (m *MockRepository) UpdateItemPrice(ctx context.Context, id, price int) (*models.Item, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateItemPrice", ctx, id, price)
+	ret0, _ := ret[0].(*models.Item)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateItemPrice indicates an expected call of UpdateItemPrice.
+func (mr *MockRepositoryMockRecorder) UpdateItemPrice(ctx, id, price any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateItemPrice", reflect.TypeOf((*MockRepository)(nil).UpdateItemPrice), ctx, id, price)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockRepository) UpdatePassword(ctx context.Context, userId int, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, userId, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockRepositoryMockRecorder) UpdatePassword(ctx, userId, password any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockRepository)(nil).UpdatePassword), ctx, userId, password)
+}
+
+// VerifyLedger mocks base method.
+func (m *MockRepository) VerifyLedger(ctx context.Context) (*dto.LedgerReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyLedger", ctx)
+	ret0, _ := ret[0].(*dto.LedgerReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyLedger indicates an expected call of VerifyLedger.
+func (mr *MockRepositoryMockRecorder) VerifyLedger(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendCoin", reflect.TypeOf((*MockRepository)(nil).SendCoin), ctx, toUser, fromUserId, amount)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyLedger", reflect.TypeOf((*MockRepository)(nil).VerifyLedger), ctx)
 }